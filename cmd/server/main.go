@@ -2,12 +2,18 @@ package server
 
 import (
 	"asocial/internal/auth"
+	"asocial/internal/canvas"
 	"asocial/internal/config"
 	"asocial/internal/db"
+	"asocial/internal/domain"
 	"asocial/internal/handler"
 	"asocial/internal/middleware"
+	"asocial/internal/presence"
 	"asocial/internal/pubsub"
+	"asocial/internal/ratelimit"
 	"asocial/internal/repository"
+	"asocial/internal/resume"
+	"asocial/internal/sequence"
 	"asocial/internal/service"
 	"context"
 	"log/slog"
@@ -20,6 +26,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/olahol/melody"
+	"github.com/redis/go-redis/v9"
 )
 
 // Run starts the chat server
@@ -42,7 +49,7 @@ func Run() {
 	logger.Info("Configuration loaded",
 		"server_port", cfg.Server.Port,
 		"redis_addr", cfg.Redis.Addr,
-		"redis_channel", cfg.Redis.Channel,
+		"redis_channel_prefix", cfg.Redis.ChannelPrefix,
 	)
 
 	// Initialize database connection
@@ -65,6 +72,9 @@ func Run() {
 	userRepo := repository.NewUserRepository(database.DB)
 	roomRepo := repository.NewRoomRepository(database.DB)
 	settingsRepo := repository.NewRoomUserSettingsRepository(database.DB)
+	messageRepo := repository.NewMessageRepository(database.DB)
+	memberRepo := repository.NewRoomMemberRepository(database.DB)
+	inviteRepo := repository.NewRoomInviteRepository(database.DB)
 
 	// Initialize Firebase
 	firebaseClient, err := auth.InitializeFirebase(context.Background(), cfg.Auth.FirebaseCredentialsPath)
@@ -76,26 +86,181 @@ func Run() {
 	// Initialize Firebase auth service
 	firebaseService := auth.NewFirebaseService(firebaseClient, userRepo, logger)
 
+	// Initialize guest token service for anonymous identities
+	guestSecret := []byte(cfg.Auth.GuestTokenSecret)
+	if len(guestSecret) == 0 {
+		logger.Warn("No guest token secret configured, generating an ephemeral one; guest tokens will not survive restarts")
+		guestSecret, err = auth.GenerateGuestTokenSecret()
+		if err != nil {
+			logger.Error("Failed to generate guest token secret", "error", err)
+			os.Exit(1)
+		}
+	}
+	guestTokens, err := auth.NewGuestTokenService(guestSecret, cfg.Auth.GuestTokenTTL)
+	if err != nil {
+		logger.Error("Failed to initialize guest token service", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize invite token service for room invite links
+	inviteSecret := []byte(cfg.Auth.InviteTokenSecret)
+	if len(inviteSecret) == 0 {
+		// Safe to share, since each kind of token signs with its own key derived from it
+		inviteSecret = guestSecret
+	}
+	inviteTokens, err := auth.NewInviteTokenService(inviteSecret)
+	if err != nil {
+		logger.Error("Failed to initialize invite token service", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize Melody (WebSocket manager)
 	m := melody.New()
 	m.Config.MaxMessageSize = int64(cfg.Server.MaxMessageSize)
 
-	// Initialize Redis pub/sub
-	redisPubSub, err := pubsub.NewRedisPubSub(
-		cfg.Redis.Addr,
-		cfg.Redis.Password,
-		cfg.Redis.Channel,
-		cfg.Redis.DB,
-		logger,
-	)
-	if err != nil {
-		logger.Error("Failed to initialize Redis pub/sub", "error", err)
+	// Initialize the pub/sub backend
+	var pubSubClient service.PubSubClient
+	var presenceStore service.PresenceStore
+	var sweeperLock service.LeaderLock // nil on a single node
+	var sequencer service.Sequencer
+	var redisClient *redis.Client
+	switch cfg.PubSub.Backend {
+	case "redis":
+		redisPubSub, err := pubsub.NewRedisPubSub(
+			cfg.Redis.Addr,
+			cfg.Redis.Password,
+			cfg.Redis.ChannelPrefix,
+			cfg.Redis.DB,
+			logger,
+		)
+		if err != nil {
+			logger.Error("Failed to initialize Redis pub/sub", "error", err)
+			os.Exit(1)
+		}
+		defer redisPubSub.Close()
+		pubSubClient, redisClient = redisPubSub, redisPubSub.Client()
+		presenceStore = presence.NewRedisStore(redisClient, logger)
+		sequencer = sequence.NewRedisSequencer(redisClient)
+		sweeperLock = presence.NewRedisLeaderLock(redisClient, "chat:presence:sweeper", cfg.PubSub.NodeID, 3*cfg.Presence.SweepInterval)
+	case "streams":
+		redisStreams, err := pubsub.NewRedisStreams(
+			cfg.Redis.Addr,
+			cfg.Redis.Password,
+			cfg.Redis.ChannelPrefix,
+			cfg.Redis.DB,
+			cfg.PubSub.StreamMaxLen,
+			logger,
+		)
+		if err != nil {
+			logger.Error("Failed to initialize Redis streams", "error", err)
+			os.Exit(1)
+		}
+		defer redisStreams.Close()
+		pubSubClient, redisClient = redisStreams, redisStreams.Client()
+		presenceStore = presence.NewRedisStore(redisClient, logger)
+		sequencer = sequence.NewRedisSequencer(redisClient)
+		sweeperLock = presence.NewRedisLeaderLock(redisClient, "chat:presence:sweeper", cfg.PubSub.NodeID, 3*cfg.Presence.SweepInterval)
+	case "nats":
+		natsPubSub, err := pubsub.NewNATSPubSub(cfg.PubSub.NATSURL, cfg.Redis.ChannelPrefix, logger)
+		if err != nil {
+			logger.Error("Failed to initialize NATS pub/sub", "error", err)
+			os.Exit(1)
+		}
+		defer natsPubSub.Close()
+		pubSubClient = natsPubSub
+
+		natsPresence, err := presence.NewNATSStore(natsPubSub.Conn(), logger)
+		if err != nil {
+			logger.Error("Failed to initialize NATS presence", "error", err)
+			os.Exit(1)
+		}
+		presenceStore = natsPresence
+
+		natsLock, err := presence.NewNATSLeaderLock(natsPubSub.Conn(), "chat_presence_sweeper", cfg.PubSub.NodeID, 3*cfg.Presence.SweepInterval)
+		if err != nil {
+			logger.Error("Failed to initialize NATS leader lock", "error", err)
+			os.Exit(1)
+		}
+		sweeperLock = natsLock
+
+		natsSequencer, err := sequence.NewNATSSequencer(natsPubSub.Conn())
+		if err != nil {
+			logger.Error("Failed to initialize NATS sequencer", "error", err)
+			os.Exit(1)
+		}
+		sequencer = natsSequencer
+	case "memory":
+		// Single node only: nothing is shared with other replicas
+		pubSubClient = pubsub.NewMemoryPubSub(logger)
+		presenceStore = presence.NewMemoryStore(nil)
+		sequencer = sequence.NewMemorySequencer()
+	default:
+		logger.Error("Unknown pub/sub backend", "backend", cfg.PubSub.Backend)
+		os.Exit(1)
+	}
+	logger.Info("Pub/sub backend configured", "backend", cfg.PubSub.Backend, "node_id", cfg.PubSub.NodeID)
+
+	// Initialize canvas snapshot source
+	var canvasSource service.CanvasSnapshotter
+	switch cfg.Canvas.SnapshotSource {
+	case "redis":
+		if redisClient == nil {
+			logger.Warn("No Redis with this pub/sub backend, keeping canvas snapshots in memory", "backend", cfg.PubSub.Backend)
+			canvasSource = canvas.NewMemoryCache(cfg.Canvas.VisibleWindow, nil)
+			break
+		}
+		canvasSource = canvas.NewRedisCache(redisClient, cfg.Canvas.VisibleWindow, logger)
+	case "memory":
+		canvasSource = canvas.NewMemoryCache(cfg.Canvas.VisibleWindow, nil)
+	case "history":
+		canvasSource = canvas.NewHistorySource(messageRepo, cfg.Canvas.VisibleWindow)
+	case "none":
+	default:
+		logger.Error("Unknown canvas snapshot source", "source", cfg.Canvas.SnapshotSource)
 		os.Exit(1)
 	}
-	defer redisPubSub.Close()
+	logger.Info("Canvas snapshots configured", "source", cfg.Canvas.SnapshotSource, "visible_window", cfg.Canvas.VisibleWindow)
+
+	// Keep each room's recent messages for resumed and backfilling sessions, in Redis when there is one
+	var messageBuffer service.MessageBuffer
+	if redisClient != nil {
+		// Outlast a parked session, and give backfilling clients a few quiet minutes
+		retention := max(2*cfg.Resume.GraceWindow, 5*time.Minute)
+		messageBuffer = resume.NewRedisBuffer(redisClient, cfg.Resume.BufferSize, retention, logger)
+	} else {
+		messageBuffer = resume.NewMemoryBuffer(cfg.Resume.BufferSize)
+	}
+
+	// Initialize session resuming; parked sessions live in Redis when there is one
+	var resumer *service.SessionResumer
+	if cfg.Resume.GraceWindow > 0 {
+		if cfg.Resume.GraceWindow >= presence.SessionTTL {
+			logger.Warn("Resume grace window is not shorter than the presence TTL, parked sessions may lapse", "grace_window", cfg.Resume.GraceWindow)
+		}
+		var resumeStore service.ResumeStore
+		if redisClient != nil {
+			resumeStore = resume.NewRedisStore(redisClient, logger)
+		} else {
+			logger.Warn("No Redis with this pub/sub backend, sessions can only resume on the node they left", "backend", cfg.PubSub.Backend)
+			resumeStore = resume.NewMemoryStore(nil)
+		}
+		resumer = service.NewSessionResumer(resumeStore, messageBuffer, sequencer, cfg.Resume.GraceWindow, logger)
+	}
+	logger.Info("Session resuming configured", "grace_window", cfg.Resume.GraceWindow, "buffer_size", cfg.Resume.BufferSize)
+
+	// Share cursor positions with joiners on any node when there is Redis
+	var cursorStore service.CursorStore
+	if redisClient != nil {
+		cursorStore = canvas.NewRedisCursors(redisClient, logger)
+	} else {
+		cursorStore = canvas.NewMemoryCursors()
+	}
+
+	// Queue frames per session so one slow client can't hold up a room
+	outbound := service.NewOutbound(m, cfg.Server.OutboundQueueSize, cfg.Server.SlowConsumerTimeout, cfg.Canvas.ViewportMargin, logger)
 
 	// Initialize message service
-	msgService := service.NewMessageService(redisPubSub, m, logger)
+	msgService := service.NewMessageService(pubSubClient, sequencer, messageRepo, canvasSource, messageBuffer, cursorStore, outbound, logger)
 
 	// Start subscriber in a goroutine
 	ctx, cancel := context.WithCancel(context.Background())
@@ -107,12 +272,46 @@ func Run() {
 		}
 	}()
 
+	// Announce users whose sessions lapsed, e.g. after another node crashed
+	sweeper := service.NewPresenceSweeper(presenceStore, sweeperLock, msgService, cfg.Presence.SweepInterval, logger)
+	go sweeper.Run(ctx)
+
+	// Bound how often clients may send frames, across nodes when there is Redis
+	var frameLimiter *service.FrameLimiter
+	if cfg.RateLimit.Enabled {
+		var limiter service.RateLimiter
+		if redisClient != nil {
+			limiter = ratelimit.NewRedisLimiter(redisClient, nil)
+		} else {
+			limiter = ratelimit.NewMemoryLimiter(nil)
+		}
+		frameLimiter = service.NewFrameLimiter(limiter, frameLimits(cfg.RateLimit), cfg.RateLimit.MaxStrikes, cfg.RateLimit.StrikeWindow, logger)
+	}
+	logger.Info("Rate limiting configured", "enabled", cfg.RateLimit.Enabled, "max_strikes", cfg.RateLimit.MaxStrikes)
+
+	// Bound how often clients may call the REST API, likewise
+	var httpLimiter middleware.WindowLimiter
+	if cfg.HTTPRateLimit.Enabled {
+		if redisClient != nil {
+			httpLimiter = ratelimit.NewRedisWindowLimiter(redisClient, nil)
+		} else {
+			httpLimiter = ratelimit.NewMemoryWindowLimiter(nil)
+		}
+	}
+	logger.Info("HTTP rate limiting configured", "enabled", cfg.HTTPRateLimit.Enabled)
+	checkUsernameLimit := middleware.RateLimitMiddleware(httpLimiter, routePolicy("check_username", cfg.HTTPRateLimit.CheckUsername), logger)
+	guestLimit := middleware.RateLimitMiddleware(httpLimiter, routePolicy("guest", cfg.HTTPRateLimit.Guest), logger)
+	accountLimit := middleware.RateLimitMiddleware(httpLimiter, routePolicy("account", cfg.HTTPRateLimit.Account), logger)
+	roomsLimit := middleware.RateLimitMiddleware(httpLimiter, routePolicy("rooms", cfg.HTTPRateLimit.Rooms), logger)
+	messagesLimit := middleware.RateLimitMiddleware(httpLimiter, routePolicy("messages", cfg.HTTPRateLimit.Messages), logger)
+
 	// Initialize handlers
-	wsHandler := handler.NewWebSocketHandler(m, msgService, logger)
+	wsHandler := handler.NewWebSocketHandler(m, msgService, presenceStore, resumer, frameLimiter, roomRepo, userRepo, settingsRepo, memberRepo, guestTokens, logger)
 	healthHandler := handler.NewHealthHandler(msgService, logger)
 	isDev := os.Getenv("ENVIRONMENT") != "production"
-	authHandler := handler.NewAuthHandler(firebaseService, logger, cfg.Auth.AppURL, isDev)
-	roomHandler := handler.NewRoomHandler(roomRepo, settingsRepo, userRepo, logger)
+	authHandler := handler.NewAuthHandler(firebaseService, guestTokens, logger, cfg.Auth.AppURL, isDev)
+	roomHandler := handler.NewRoomHandler(roomRepo, settingsRepo, userRepo, memberRepo, inviteRepo, inviteTokens, msgService, logger)
+	messageHandler := handler.NewMessageHandler(roomRepo, messageRepo, memberRepo, logger)
 
 	// Setup Gin router
 	router := gin.Default()
@@ -123,6 +322,7 @@ func Run() {
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -140,26 +340,38 @@ func Run() {
 			"goroutines": runtime.NumGoroutine(),
 		})
 	})
+	router.GET("/api/debug/outbound", func(c *gin.Context) {
+		c.JSON(200, outbound.Stats())
+	})
 
 	// Register auth routes
 	authGroup := router.Group("/api/auth")
 	{
 		// Public routes
-		authGroup.POST("/check-username", authHandler.HandleCheckUsername)
+		authGroup.POST("/check-username", checkUsernameLimit, authHandler.HandleCheckUsername)
+		authGroup.POST("/guest", guestLimit, authHandler.HandleGuestToken)
 
 		// Protected auth routes (middleware auto-creates user on first call)
-		authGroup.GET("/me", middleware.AuthMiddleware(firebaseService, logger), authHandler.HandleMe)
-		authGroup.POST("/logout", middleware.AuthMiddleware(firebaseService, logger), authHandler.HandleLogout)
-		authGroup.PATCH("/username", middleware.AuthMiddleware(firebaseService, logger), authHandler.HandleUpdateUsername)
-		authGroup.DELETE("/account", middleware.AuthMiddleware(firebaseService, logger), authHandler.HandleDeleteAccount)
+		authGroup.GET("/me", middleware.AuthMiddleware(firebaseService, logger), accountLimit, authHandler.HandleMe)
+		authGroup.POST("/logout", middleware.AuthMiddleware(firebaseService, logger), accountLimit, authHandler.HandleLogout)
+		authGroup.PATCH("/username", middleware.AuthMiddleware(firebaseService, logger), accountLimit, authHandler.HandleUpdateUsername)
+		authGroup.DELETE("/account", middleware.AuthMiddleware(firebaseService, logger), accountLimit, authHandler.HandleDeleteAccount)
 	}
 
 	// Register room routes:
 	roomGroup := router.Group("/api/rooms")
 	{
-		roomGroup.GET("/public", roomHandler.HandleListPublicRooms)
-		roomGroup.GET("/:slug", middleware.OptionalAuthMiddleware(firebaseService, logger), roomHandler.HandleGetRoom)
-		roomGroup.POST("/:slug/join", middleware.AuthMiddleware(firebaseService, logger), roomHandler.HandleJoinRoom)
+		roomGroup.GET("/public", roomsLimit, roomHandler.HandleListPublicRooms)
+		roomGroup.GET("/mine", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleListMyRooms)
+		roomGroup.POST("", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleCreateRoom)
+		roomGroup.GET("/:slug", middleware.OptionalAuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleGetRoom)
+		roomGroup.PATCH("/:slug", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleUpdateRoom)
+		roomGroup.DELETE("/:slug", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleDeleteRoom)
+		roomGroup.POST("/:slug/join", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleJoinRoom)
+		roomGroup.GET("/:slug/invites", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleListInvites)
+		roomGroup.POST("/:slug/invites", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleCreateInvite)
+		roomGroup.DELETE("/:slug/invites/:id", middleware.AuthMiddleware(firebaseService, logger), roomsLimit, roomHandler.HandleRevokeInvite)
+		roomGroup.GET("/:slug/messages", middleware.OptionalAuthMiddleware(firebaseService, logger), messagesLimit, messageHandler.HandleListMessages)
   }
 
 	// Register WebSocket route (optionally authenticated)
@@ -188,16 +400,16 @@ func Run() {
 
 	logger.Info("Shutting down server...")
 
-	// Cancel subscriber context
-	cancel()
-
-	// Graceful shutdown with 5 second timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
 
-	// Close all WebSocket connections
-	if err := m.Close(); err != nil {
-		logger.Error("Error closing WebSocket connections", "error", err)
+	// Fail readiness so load balancers stop sending traffic here
+	healthHandler.StartDraining()
+
+	// Refuse new WebSocket connections, ask clients to reconnect elsewhere and announce
+	// their departure while pub/sub and presence are still reachable
+	if err := wsHandler.Drain(shutdownCtx, cfg.Server.DrainReconnectDelay); err != nil {
+		logger.Error("Error draining WebSocket connections", "error", err)
 	}
 
 	// Shutdown HTTP server
@@ -205,5 +417,42 @@ func Run() {
 		logger.Error("Error shutting down HTTP server", "error", err)
 	}
 
+	// Persist chat messages still waiting to be committed
+	msgService.FlushCommits()
+
+	// Stop the subscriber and sweeper
+	cancel()
+
+	// Deferred closes run next: pub/sub (Redis or NATS), then Postgres
 	logger.Info("Server stopped gracefully")
 }
+
+// frameLimits maps the configured budgets to the message types they cover
+func frameLimits(cfg config.RateLimitConfig) map[domain.MessageType]service.FrameLimits {
+	limits := func(c config.FrameRateLimit) service.FrameLimits {
+		return service.FrameLimits{
+			Session: domain.RateLimit{Rate: c.SessionRate, Burst: c.SessionBurst},
+			User:    domain.RateLimit{Rate: c.UserRate, Burst: c.UserBurst},
+			IP:      domain.RateLimit{Rate: c.IPRate, Burst: c.IPBurst},
+		}
+	}
+
+	return map[domain.MessageType]service.FrameLimits{
+		domain.MessageTypeChat:            limits(cfg.Chat),
+		domain.MessageTypeCursorMoved:     limits(cfg.Cursor),
+		domain.MessageTypeViewportUpdate:  limits(cfg.Viewport),
+		domain.MessageTypeUsernameChanged: limits(cfg.Profile),
+		domain.MessageTypeColorChanged:    limits(cfg.Profile),
+		domain.MessageTypeReplay:          limits(cfg.History),
+		domain.MessageTypeBackfill:        limits(cfg.History),
+	}
+}
+
+// routePolicy turns the configured limits of a group of routes into a rate limit policy
+func routePolicy(name string, cfg config.RouteRateLimit) middleware.RateLimitPolicy {
+	return middleware.RateLimitPolicy{
+		Name: name,
+		IP:   domain.WindowLimit{Limit: cfg.IPLimit, Window: cfg.Window},
+		User: domain.WindowLimit{Limit: cfg.UserLimit, Window: cfg.Window},
+	}
+}
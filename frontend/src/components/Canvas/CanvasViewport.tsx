@@ -10,6 +10,7 @@ interface CanvasViewportProps {
   canvasHeight?: number;
   onCanvasClick?: (x: number, y: number) => void;
   onViewportChange?: (x: number, y: number, scale: number) => void;
+  onCanvasPointerMove?: (x: number, y: number) => void;
   viewport?: { x: number; y: number; scale: number };
 }
 
@@ -19,6 +20,7 @@ const CanvasViewport: React.FC<CanvasViewportProps> = ({
   canvasHeight = 5000,
   onCanvasClick,
   onViewportChange,
+  onCanvasPointerMove,
   viewport,
 }) => {
   const [{ x, y, scale }, setTransform] = useState({
@@ -203,6 +205,20 @@ const CanvasViewport: React.FC<CanvasViewportProps> = ({
     pointerDownPos.current = { x: e.clientX, y: e.clientY };
   };
 
+  // Report the pointer in canvas coordinates, e.g. to share it with other users
+  const handlePointerMove = (e: React.PointerEvent) => {
+    if (!onCanvasPointerMove || !containerRef.current) return;
+
+    const rect = containerRef.current.getBoundingClientRect();
+    const canvasX = (e.clientX - rect.left - x) / scale;
+    const canvasY = (e.clientY - rect.top - y) / scale;
+
+    if (canvasX < 0 || canvasX > canvasWidth || canvasY < 0 || canvasY > canvasHeight) {
+      return;
+    }
+    onCanvasPointerMove(canvasX, canvasY);
+  };
+
   const handleClick = (e: React.MouseEvent) => {
     if (!onCanvasClick) return;
 
@@ -258,6 +274,7 @@ const CanvasViewport: React.FC<CanvasViewportProps> = ({
       className="relative w-full h-full overflow-hidden bg-white cursor-crosshair"
       style={{ touchAction: "none", WebkitUserSelect: "none", userSelect: "none" }}
       onPointerDown={handlePointerDown}
+      onPointerMove={handlePointerMove}
       onClick={handleClick}
     >
       {/* Canvas content with transform */}
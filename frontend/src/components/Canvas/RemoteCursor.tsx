@@ -0,0 +1,34 @@
+"use client";
+
+import React from "react";
+
+interface RemoteCursorProps {
+  x: number;
+  y: number;
+  color: string;
+  label?: string;
+}
+
+// Another user's pointer, drawn in canvas coordinates
+const RemoteCursor: React.FC<RemoteCursorProps> = ({ x, y, color, label }) => {
+  return (
+    <div
+      className="absolute pointer-events-none transition-transform duration-75 ease-linear"
+      style={{ left: 0, top: 0, transform: `translate(${x}px, ${y}px)` }}
+    >
+      <svg width="16" height="16" viewBox="0 0 16 16" style={{ display: "block" }}>
+        <path d="M0 0 L0 12 L4 9 L7 15 L9 14 L6 8 L11 8 Z" fill={color} stroke="white" strokeWidth="1" />
+      </svg>
+      {label && (
+        <span
+          className="ml-3 px-1.5 py-0.5 rounded text-xs text-white whitespace-nowrap"
+          style={{ backgroundColor: color }}
+        >
+          {label}
+        </span>
+      )}
+    </div>
+  );
+};
+
+export default RemoteCursor;
@@ -5,6 +5,8 @@ import CanvasViewport from "@/components/Canvas/CanvasViewport";
 import TextMessage from "@/components/Canvas/TextMessage";
 import Sidebar from "@/components/Layout/Sidebar";
 import MiniMap from "@/components/Canvas/MiniMap";
+import RemoteCursor from "@/components/Canvas/RemoteCursor";
+import { useSearchParams } from "next/navigation";
 import { useChatStore } from "@/stores/chatStore";
 import { useWebSocket } from "@/hooks/useWebSocket";
 import { generateUUID } from "@/utils/uuid";
@@ -19,8 +21,12 @@ const Messages: React.FC = () => {
   const addMessage = useChatStore((state) => state.addMessage);
   const updateMessage = useChatStore((state) => state.updateMessage);
 
+  // The room comes from the URL, e.g. /chat?room=late-night-chat; the hook reconnects when it changes
+  const room = useSearchParams().get("room") || undefined;
+
   // Initialize WebSocket connection
-  const { sendMessage, sendUsernameChange, sendColorChange } = useWebSocket({
+  const { sendMessage, sendCursor, sendUsernameChange, sendColorChange } = useWebSocket({
+    room,
     onConnect: () => console.log("Connected to chat server"),
     onDisconnect: () => console.log("Disconnected from chat server"),
   });
@@ -91,6 +97,7 @@ const Messages: React.FC = () => {
           viewport={viewport}
           onCanvasClick={handleCanvasClick}
           onViewportChange={handleViewportChange}
+          onCanvasPointerMove={sendCursor}
         >
           {Object.values(messages).map((message) => (
             <TextMessage
@@ -106,6 +113,17 @@ const Messages: React.FC = () => {
               onContentChange={handleContentChange}
             />
           ))}
+          {Object.values(users)
+            .filter((user) => user.id !== localUserId && user.x !== undefined && user.y !== undefined)
+            .map((user) => (
+              <RemoteCursor
+                key={user.id}
+                x={user.x!}
+                y={user.y!}
+                color={user.color}
+                label={user.username}
+              />
+            ))}
         </CanvasViewport>
       </div>
     </div>
@@ -1,39 +1,88 @@
 import { useEffect, useRef, useState } from "react";
 import { useChatStore } from "@/stores/chatStore";
 import { useAuthStore } from "@/stores/authStore";
-import { getUserDisplayName, getUserColor } from "@/utils/user";
+import { apiClient } from "@/lib/api";
+import { getUserDisplayName, getUserColor, getGuestToken, setGuestToken } from "@/utils/user";
 
 interface UserInfo {
   user_id: string;
   username?: string;
   color?: string;
+  status?: "active" | "idle" | "away";
+  last_active_at?: number;
+  sessions?: number; // Open tabs/connections for this user
+  cursor?: { x: number; y: number }; // Last shared pointer position
+}
+
+interface CanvasItem {
+  message_id: string;
+  user_id: string;
+  username?: string;
+  color?: string;
+  payload: string;
+  position: { x: number; y: number };
+  updated_at: number;
+  age_ms: number;
 }
 
 interface WebSocketMessage {
-  type: "chat" | "user_joined" | "user_left" | "user_sync" | "username_changed" | "color_changed";
+  type: "chat" | "user_joined" | "user_left" | "user_sync" | "canvas_sync" | "username_changed" | "color_changed" | "server_draining" | "viewport_update" | "cursor_moved" | "backfill" | "gap" | "ack" | "error";
   user_id: string;
   message_id?: string;
   payload?: string;
   position?: { x: number; y: number };
   users?: UserInfo[]; // For user_sync messages
+  messages?: CanvasItem[]; // For canvas_sync messages
   username?: string; // For user_joined and username_changed
   color?: string; // For user_joined and color_changed
+  retry_after_ms?: number; // For server_draining: when to reconnect; for rate_limited errors: when to retry
+  resume_token?: string; // For user_sync: reconnect with this to keep our session
+  viewport?: { x: number; y: number; width: number; height: number; zoom: number }; // For viewport_update
+  seq?: number; // Position in the room's sequence, assigned by the server
+  since_seq?: number; // For backfill requests: resend messages after this sequence number; for gap: where the loss starts
+  request_id?: string; // Echoed in the ack or error for the frame that carried it
+  code?: "invalid_message" | "forbidden" | "rate_limited" | "publish_failed" | "too_large"; // For error messages
+  reason?: string; // For error messages
   channel_id: string;
   timestamp: number;
 }
 
+// Close code for sessions disconnected for exceeding their rate limits, and how long to wait before reconnecting
+const RATE_LIMIT_CLOSE_CODE = 4002;
+const RATE_LIMIT_RECONNECT_MS = 10000;
+
+// Close code for sessions in a room that was deleted; there is nothing to reconnect to
+const ROOM_DELETED_CLOSE_CODE = 4003;
+
+// Close code for non-members in a room that was made private; reconnecting would be refused
+const ROOM_RESTRICTED_CLOSE_CODE = 4004;
+
+// Minimum time between viewport updates while panning or zooming
+const VIEWPORT_UPDATE_INTERVAL_MS = 200;
+
+// Minimum time between cursor positions sent; the server throttles to the same rate
+const CURSOR_UPDATE_INTERVAL_MS = 50;
+
+// How long to wait after the server reports a gap before asking for a backfill,
+// so one request covers a burst of gaps
+const BACKFILL_DELAY_MS = 1000;
+
+// Room joined when none is given, matching the server's default
+const DEFAULT_ROOM = "general";
+
 interface UseWebSocketOptions {
-  channelId?: string;
+  room?: string; // Slug of the room to join
   onConnect?: () => void;
   onDisconnect?: () => void;
   onError?: (error: Event) => void;
 }
 
 export const useWebSocket = (options: UseWebSocketOptions = {}) => {
-  const { channelId = "default", onConnect, onDisconnect, onError } = options;
+  const { room = DEFAULT_ROOM, onConnect, onDisconnect, onError } = options;
 
   const socketRef = useRef<WebSocket | null>(null);
   const [isConnected, setIsConnected] = useState(false);
+  const [guestUserId, setGuestUserId] = useState<string | null>(null);
   const localUserId = useChatStore((state) => state.localUserId);
   const firebaseToken = useAuthStore((state) => state.firebaseToken);
   const isAuthenticated = useAuthStore((state) => state.isAuthenticated);
@@ -42,13 +91,22 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
   const addUser = useChatStore((state) => state.addUser);
   const updateUserUsername = useChatStore((state) => state.updateUserUsername);
   const updateUserColor = useChatStore((state) => state.updateUserColor);
+  const updateUserCursor = useChatStore((state) => state.updateUserCursor);
   const removeUser = useChatStore((state) => state.removeUser);
+  const clearRoom = useChatStore((state) => state.clearRoom);
+  const viewport = useChatStore((state) => state.viewport);
+  const lastViewportSentRef = useRef(0);
+  const lastCursorSentRef = useRef(0);
+
+  // Authenticated sockets are identified by the backend user ID; anonymous ones by their server-signed guest ID
+  const connectionUserId = isAuthenticated && backendUser ? backendUser.id : guestUserId ?? "";
 
   // Use refs for callbacks to avoid recreating the effect
   const addMessageRef = useRef(addMessage);
   const addUserRef = useRef(addUser);
   const updateUserUsernameRef = useRef(updateUserUsername);
   const updateUserColorRef = useRef(updateUserColor);
+  const updateUserCursorRef = useRef(updateUserCursor);
   const removeUserRef = useRef(removeUser);
   const onConnectRef = useRef(onConnect);
   const onDisconnectRef = useRef(onDisconnect);
@@ -60,11 +118,17 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
     addUserRef.current = addUser;
     updateUserUsernameRef.current = updateUserUsername;
     updateUserColorRef.current = updateUserColor;
+    updateUserCursorRef.current = updateUserCursor;
     removeUserRef.current = removeUser;
     onConnectRef.current = onConnect;
     onDisconnectRef.current = onDisconnect;
     onErrorRef.current = onError;
-  }, [addMessage, addUser, updateUserUsername, updateUserColor, removeUser, onConnect, onDisconnect, onError]);
+  }, [addMessage, addUser, updateUserUsername, updateUserColor, updateUserCursor, removeUser, onConnect, onDisconnect, onError]);
+
+  // Another room has another canvas and other people in it
+  useEffect(() => {
+    clearRoom();
+  }, [room, clearRoom]);
 
   useEffect(() => {
     if (typeof window === "undefined") return;
@@ -72,26 +136,33 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
     console.log("[WebSocket] Initializing connection...", {
       env: process.env.NODE_ENV,
       localUserId,
-      channelId,
+      room,
     });
 
     // Determine WebSocket URL based on environment
-    const getWebSocketUrl = () => {
+    const getWebSocketUrl = (guestToken: string | null, resumeToken: string | null) => {
       // Prioritize authenticated username over localStorage
       const username = isAuthenticated && backendUser
         ? backendUser.username
         : getUserDisplayName();
       const color = getUserColor();
-      const params = new URLSearchParams({ uid: localUserId });
+      const params = new URLSearchParams();
+      params.set("room", room);
       if (username) {
         params.set("username", username);
       }
       if (color) {
         params.set("color", color);
       }
-      // Add Firebase token if authenticated
+      // Add Firebase token if authenticated, otherwise the signed guest token
       if (firebaseToken) {
         params.set("token", firebaseToken);
+      } else if (guestToken) {
+        params.set("guest_token", guestToken);
+      }
+      // Resume our previous session so the room sees no leave/join and we get what we missed
+      if (resumeToken) {
+        params.set("resume", resumeToken);
       }
 
       // In development: use env var or fallback to default
@@ -105,84 +176,247 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
       return `${protocol}//${window.location.host}/api/chat?${params.toString()}`;
     };
 
-    const wsUrl = getWebSocketUrl();
-    console.log("[WebSocket] Connecting to:", wsUrl);
+    let cancelled = false;
+    let socket: WebSocket | null = null;
+    // Set when the server asks us to reconnect because it is shutting down
+    let reconnectAfterMs: number | null = null;
+    let reconnectTimer: ReturnType<typeof setTimeout> | null = null;
+    // Issued in user_sync; presented when reconnecting after a dropped connection
+    let resumeToken: string | null = null;
+    // Who we connect as; requests sent from here can't wait for connectionUserId to update
+    let socketUserId = isAuthenticated && backendUser ? backendUser.id : "";
+    // Where the backfill waiting to be requested starts
+    let backfillSince: number | null = null;
+    let backfillTimer: ReturnType<typeof setTimeout> | null = null;
+    // Sequence number of the latest applied version of each chat message
+    const chatSeqs = new Map<string, number>();
 
-    const socket = new WebSocket(wsUrl);
-    socketRef.current = socket;
+    // Jumps in seq are normal: chat outside our viewport is never sent to us and queued
+    // updates are replaced by newer ones. Only a gap frame means something was lost.
+    const requestBackfill = (since: number) => {
+      backfillSince = backfillSince === null ? since : Math.min(backfillSince, since);
+      if (backfillTimer) return;
 
-    socket.onopen = () => {
-      console.log("[WebSocket] Connected successfully");
-      setIsConnected(true);
-      onConnectRef.current?.();
+      backfillTimer = setTimeout(() => {
+        backfillTimer = null;
+        const request: WebSocketMessage = {
+          type: "backfill",
+          user_id: socketUserId,
+          since_seq: backfillSince ?? 0,
+          channel_id: room,
+          timestamp: Date.now(),
+        };
+        backfillSince = null;
+        if (!socket || socket.readyState !== WebSocket.OPEN) return;
+        socket.send(JSON.stringify(request));
+      }, BACKFILL_DELAY_MS);
     };
 
-    socket.onmessage = (event) => {
-      console.log("[WebSocket] Message received");
-      try {
-        const data: WebSocketMessage = JSON.parse(event.data);
-
-        // Handle different message types
-        if (data.type === "user_sync") {
-          // Initial sync of all users in channel
-          console.log("[WebSocket] User sync:", data.users);
-          if (data.users) {
-            data.users.forEach((userInfo) => {
-              if (typeof userInfo === "string") {
-                // Backwards compatibility: just user ID
-                addUserRef.current(userInfo);
-              } else {
-                // New format: user object with username and color
-                addUserRef.current(userInfo.user_id, userInfo.username, userInfo.color);
-              }
+    const connect = async () => {
+      // Anonymous users need a server-signed guest identity before connecting
+      let guestToken: string | null = null;
+      if (!firebaseToken) {
+        try {
+          const guest = await apiClient.getGuestToken(getGuestToken() ?? undefined);
+          setGuestToken(guest.token);
+          setGuestUserId(guest.user_id);
+          socketUserId = guest.user_id;
+          guestToken = guest.token;
+        } catch (error) {
+          console.error("[WebSocket] Failed to get guest token:", error);
+          return;
+        }
+      }
+
+      if (cancelled) return;
+
+      const wsUrl = getWebSocketUrl(guestToken, resumeToken);
+      console.log("[WebSocket] Connecting to:", wsUrl);
+
+      socket = new WebSocket(wsUrl);
+      socketRef.current = socket;
+
+      socket.onopen = () => {
+        console.log("[WebSocket] Connected successfully");
+        setIsConnected(true);
+        onConnectRef.current?.();
+      };
+
+      socket.onmessage = (event) => {
+        console.log("[WebSocket] Message received");
+        try {
+          const data: WebSocketMessage = JSON.parse(event.data);
+
+          // Handle different message types
+          if (data.type === "user_sync") {
+            // Initial sync of all users in channel; we count the room's messages from here
+            console.log("[WebSocket] User sync:", data.users);
+            resumeToken = data.resume_token ?? null;
+            if (data.users) {
+              data.users.forEach((userInfo) => {
+                if (typeof userInfo === "string") {
+                  // Backwards compatibility: just user ID
+                  addUserRef.current(userInfo);
+                } else {
+                  // New format: user object with username and color
+                  addUserRef.current(userInfo.user_id, userInfo.username, userInfo.color);
+                  if (userInfo.cursor) {
+                    updateUserCursorRef.current(userInfo.user_id, userInfo.cursor.x, userInfo.cursor.y);
+                  }
+                }
+              });
+            }
+          } else if (data.type === "canvas_sync") {
+            // Messages still visible in the room when we joined
+            console.log("[WebSocket] Canvas sync:", data.messages?.length ?? 0);
+            data.messages?.forEach((item) => {
+              addMessageRef.current(
+                item.message_id,
+                item.user_id,
+                item.payload,
+                item.position.x,
+                item.position.y,
+                item.age_ms
+              );
             });
+          } else if (data.type === "backfill") {
+            // Everything up to here we either got now or would never have received
+            console.log("[WebSocket] Backfilled up to", data.seq);
+          } else if (data.type === "gap") {
+            // The server dropped messages on their way to us
+            console.log("[WebSocket] Messages lost since", data.since_seq);
+            requestBackfill(data.since_seq ?? 0);
+          } else if (data.type === "ack") {
+            // One of our messages reached the room
+          } else if (data.type === "error") {
+            console.warn("[WebSocket] Server rejected a message:", data.code, data.reason, data.request_id);
+          } else if (data.type === "user_joined") {
+            console.log("[WebSocket] User joined:", data.user_id, data.username, data.color);
+            addUserRef.current(data.user_id, data.username, data.color);
+          } else if (data.type === "username_changed") {
+            console.log("[WebSocket] Username changed:", data.user_id, data.username);
+            updateUserUsernameRef.current(data.user_id, data.username || "");
+          } else if (data.type === "color_changed") {
+            console.log("[WebSocket] Color changed:", data.user_id, data.color);
+            updateUserColorRef.current(data.user_id, data.color || "");
+          } else if (data.type === "cursor_moved") {
+            if (data.position) {
+              updateUserCursorRef.current(data.user_id, data.position.x, data.position.y);
+            }
+          } else if (data.type === "user_left") {
+            console.log("[WebSocket] User left:", data.user_id);
+            removeUserRef.current(data.user_id);
+          } else if (data.type === "server_draining") {
+            // The server is going away; reconnect once the hinted delay passes
+            console.log("[WebSocket] Server draining, reconnecting in", data.retry_after_ms, "ms");
+            reconnectAfterMs = data.retry_after_ms ?? 0;
+          } else if (data.type === "chat") {
+            // Handle chat message
+            const { user_id, message_id, payload, position, seq } = data;
+            if (message_id && payload && position) {
+              // A backfilled version may arrive after a newer live one
+              if (seq) {
+                if ((chatSeqs.get(message_id) ?? 0) > seq) return;
+                chatSeqs.set(message_id, seq);
+              }
+              addMessageRef.current(message_id, user_id, payload, position.x, position.y);
+            }
           }
-        } else if (data.type === "user_joined") {
-          console.log("[WebSocket] User joined:", data.user_id, data.username, data.color);
-          addUserRef.current(data.user_id, data.username, data.color);
-        } else if (data.type === "username_changed") {
-          console.log("[WebSocket] Username changed:", data.user_id, data.username);
-          updateUserUsernameRef.current(data.user_id, data.username || "");
-        } else if (data.type === "color_changed") {
-          console.log("[WebSocket] Color changed:", data.user_id, data.color);
-          updateUserColorRef.current(data.user_id, data.color || "");
-        } else if (data.type === "user_left") {
-          console.log("[WebSocket] User left:", data.user_id);
-          removeUserRef.current(data.user_id);
-        } else if (data.type === "chat") {
-          // Handle chat message
-          const { user_id, message_id, payload, position } = data;
-          if (message_id && payload && position) {
-            addMessageRef.current(message_id, user_id, payload, position.x, position.y);
-          }
+        } catch (error) {
+          console.error("[WebSocket] Failed to parse message:", error);
         }
-      } catch (error) {
-        console.error("[WebSocket] Failed to parse message:", error);
-      }
-    };
+      };
 
-    socket.onerror = (error) => {
-      console.error("[WebSocket] Error:", error);
-      onErrorRef.current?.(error);
-    };
+      socket.onerror = (error) => {
+        console.error("[WebSocket] Error:", error);
+        onErrorRef.current?.(error);
+      };
+
+      socket.onclose = (event) => {
+        console.log("[WebSocket] Connection closed:", {
+          code: event.code,
+          reason: event.reason,
+          wasClean: event.wasClean,
+        });
+        setIsConnected(false);
+        onDisconnectRef.current?.();
+
+        // A new connection resyncs from its user_sync
+        if (backfillTimer) {
+          clearTimeout(backfillTimer);
+          backfillTimer = null;
+          backfillSince = null;
+        }
 
-    socket.onclose = (event) => {
-      console.log("[WebSocket] Connection closed:", {
-        code: event.code,
-        reason: event.reason,
-        wasClean: event.wasClean,
-      });
-      setIsConnected(false);
-      onDisconnectRef.current?.();
+        if (cancelled) return;
+
+        if (reconnectAfterMs !== null) {
+          // The server is draining and has already let our session go
+          resumeToken = null;
+          // Spread reconnects so every client of the node doesn't arrive at once
+          const delay = reconnectAfterMs + Math.random() * 1000;
+          reconnectAfterMs = null;
+          reconnectTimer = setTimeout(connect, delay);
+        } else if (event.code === RATE_LIMIT_CLOSE_CODE) {
+          // Disconnected for sending too fast: give the budgets time to refill
+          reconnectTimer = setTimeout(connect, RATE_LIMIT_RECONNECT_MS);
+        } else if (event.code === ROOM_DELETED_CLOSE_CODE || event.code === ROOM_RESTRICTED_CLOSE_CODE) {
+          // The room is gone or closed to us; stay disconnected
+          resumeToken = null;
+        } else if (event.code !== 1000 && resumeToken) {
+          // Dropped connection: come back quickly, within the server's resume grace window
+          reconnectTimer = setTimeout(connect, 1000);
+        }
+      };
     };
 
+    connect();
+
     return () => {
       console.log("[WebSocket] 🧹 Cleanup - closing connection");
-      if (socket.readyState === WebSocket.OPEN || socket.readyState === WebSocket.CONNECTING) {
+      cancelled = true;
+      if (reconnectTimer) {
+        clearTimeout(reconnectTimer);
+      }
+      if (backfillTimer) {
+        clearTimeout(backfillTimer);
+      }
+      if (socket && (socket.readyState === WebSocket.OPEN || socket.readyState === WebSocket.CONNECTING)) {
         socket.close(1000, "Component unmounting");
       }
     };
-  }, [localUserId, channelId, firebaseToken, isAuthenticated, backendUser]); // Reconnect when userId, channelId, or auth state changes
+  }, [localUserId, room, firebaseToken, isAuthenticated, backendUser]); // Reconnect when userId, room, or auth state changes
+
+  // Tell the server which part of the canvas is on screen, so it only sends keystrokes near it
+  useEffect(() => {
+    if (!isConnected) return;
+
+    const wait = Math.max(0, lastViewportSentRef.current + VIEWPORT_UPDATE_INTERVAL_MS - Date.now());
+    const timer = setTimeout(() => {
+      const socket = socketRef.current;
+      if (!socket || socket.readyState !== WebSocket.OPEN) return;
+
+      // The store holds the canvas transform; convert it to the visible rectangle in canvas coordinates
+      const message: WebSocketMessage = {
+        type: "viewport_update",
+        user_id: connectionUserId,
+        viewport: {
+          x: -viewport.x / viewport.scale,
+          y: -viewport.y / viewport.scale,
+          width: window.innerWidth / viewport.scale,
+          height: window.innerHeight / viewport.scale,
+          zoom: viewport.scale,
+        },
+        channel_id: room,
+        timestamp: Date.now(),
+      };
+
+      socket.send(JSON.stringify(message));
+      lastViewportSentRef.current = Date.now();
+    }, wait);
+
+    return () => clearTimeout(timer);
+  }, [viewport, isConnected, connectionUserId, room]);
 
   const sendMessage = (messageId: string, content: string, x: number, y: number) => {
     if (!socketRef.current || socketRef.current.readyState !== WebSocket.OPEN) {
@@ -192,17 +426,40 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
 
     const message: WebSocketMessage = {
       type: "chat",
-      user_id: localUserId,
+      user_id: connectionUserId,
       message_id: messageId,
       payload: content,
       position: { x, y },
-      channel_id: channelId,
+      channel_id: room,
       timestamp: Date.now(),
     };
 
     socketRef.current.send(JSON.stringify(message));
   };
 
+  const sendCursor = (x: number, y: number) => {
+    if (!socketRef.current || socketRef.current.readyState !== WebSocket.OPEN) {
+      return;
+    }
+
+    // Pointer events fire far more often than peers need; drop moves within the interval
+    const now = Date.now();
+    if (now - lastCursorSentRef.current < CURSOR_UPDATE_INTERVAL_MS) {
+      return;
+    }
+    lastCursorSentRef.current = now;
+
+    const message: WebSocketMessage = {
+      type: "cursor_moved",
+      user_id: connectionUserId,
+      position: { x, y },
+      channel_id: room,
+      timestamp: now,
+    };
+
+    socketRef.current.send(JSON.stringify(message));
+  };
+
   const sendUsernameChange = (username: string) => {
     if (!socketRef.current || socketRef.current.readyState !== WebSocket.OPEN) {
       console.warn("WebSocket is not connected");
@@ -211,9 +468,9 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
 
     const message: WebSocketMessage = {
       type: "username_changed",
-      user_id: localUserId,
+      user_id: connectionUserId,
       username,
-      channel_id: channelId,
+      channel_id: room,
       timestamp: Date.now(),
     };
 
@@ -228,9 +485,9 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
 
     const message: WebSocketMessage = {
       type: "color_changed",
-      user_id: localUserId,
+      user_id: connectionUserId,
       color,
-      channel_id: channelId,
+      channel_id: room,
       timestamp: Date.now(),
     };
 
@@ -240,6 +497,7 @@ export const useWebSocket = (options: UseWebSocketOptions = {}) => {
   return {
     isConnected,
     sendMessage,
+    sendCursor,
     sendUsernameChange,
     sendColorChange,
   };
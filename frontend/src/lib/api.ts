@@ -41,6 +41,66 @@ export interface JoinRoomResponse {
   settings: RoomUserSettings;
 }
 
+/**
+ * A room the user owns or has joined
+ */
+export interface MyRoom extends Room {
+  role: "owner" | "admin" | "member";
+  display_name?: string;
+  color?: string;
+  joined_at?: string;
+}
+
+/**
+ * Fields for creating a room; the slug is derived from the name if omitted
+ */
+export interface CreateRoomParams {
+  name: string;
+  slug?: string;
+  description?: string;
+  is_public?: boolean;
+}
+
+/**
+ * An invite link to a room; share `token` as the `invite` query parameter when joining
+ */
+export interface RoomInvite {
+  id: string;
+  token: string;
+  role: "admin" | "member";
+  max_uses?: number | null;
+  uses: number;
+  expires_at: string;
+  created_at: string;
+}
+
+/**
+ * Fields for creating an invite; by default it makes members, has no use limit and lasts 7 days
+ */
+export interface CreateInviteParams {
+  role?: "admin" | "member";
+  max_uses?: number;
+  expires_in?: number; // Seconds
+}
+
+/**
+ * Fields for updating a room; omitted fields are left unchanged
+ */
+export interface UpdateRoomParams {
+  name?: string;
+  description?: string;
+  is_public?: boolean;
+}
+
+/**
+ * Guest token response from backend
+ */
+export interface GuestTokenResponse {
+  token: string;
+  user_id: string;
+  expires_at: string;
+}
+
 /**
  * API client for backend requests
  * Automatically includes Firebase ID token in Authorization header
@@ -83,6 +143,11 @@ class ApiClient {
       );
     }
 
+    // No Content, e.g. after a delete
+    if (response.status === 204) {
+      return undefined as T;
+    }
+
     return response.json();
   }
 
@@ -107,6 +172,17 @@ class ApiClient {
     });
   }
 
+  /**
+   * Get a signed guest token for anonymous WebSocket connections
+   * Passing a still-valid token renews it and keeps the same guest ID
+   */
+  async getGuestToken(token?: string): Promise<GuestTokenResponse> {
+    return this.request<GuestTokenResponse>("/api/auth/guest", {
+      method: "POST",
+      body: JSON.stringify(token ? { token } : {}),
+    });
+  }
+
   /**
    * Logout (revoke Firebase tokens on backend)
    */
@@ -142,17 +218,20 @@ class ApiClient {
 
   /**
    * Join a room
+   * An invite token makes the user a member of a private room
    */
   async joinRoom(
     slug: string,
     displayName?: string,
-    color?: string
+    color?: string,
+    invite?: string
   ): Promise<JoinRoomResponse> {
     const body: { display_name?: string; color?: string } = {};
     if (displayName) body.display_name = displayName;
     if (color) body.color = color;
 
-    return this.request<JoinRoomResponse>(`/api/rooms/${slug}/join`, {
+    const query = invite ? `?invite=${encodeURIComponent(invite)}` : "";
+    return this.request<JoinRoomResponse>(`/api/rooms/${slug}/join${query}`, {
       method: "POST",
       body: JSON.stringify(body),
     });
@@ -171,6 +250,76 @@ class ApiClient {
   async listPublicRooms(): Promise<{ rooms: Room[]; count: number }> {
     return this.request<{ rooms: Room[]; count: number }>("/api/rooms/public");
   }
+
+  /**
+   * List rooms the user owns or has joined
+   */
+  async listMyRooms(): Promise<{ rooms: MyRoom[]; count: number }> {
+    return this.request<{ rooms: MyRoom[]; count: number }>("/api/rooms/mine");
+  }
+
+  /**
+   * Create a room owned by the user
+   * A chosen slug that is taken fails with 409 and suggested alternatives
+   */
+  async createRoom(params: CreateRoomParams): Promise<Room> {
+    return this.request<Room>("/api/rooms", {
+      method: "POST",
+      body: JSON.stringify(params),
+    });
+  }
+
+  /**
+   * Update a room the user owns
+   */
+  async updateRoom(slug: string, params: UpdateRoomParams): Promise<Room> {
+    return this.request<Room>(`/api/rooms/${slug}`, {
+      method: "PATCH",
+      body: JSON.stringify(params),
+    });
+  }
+
+  /**
+   * Delete a room the user owns, disconnecting everyone in it
+   */
+  async deleteRoom(slug: string): Promise<void> {
+    await this.request(`/api/rooms/${slug}`, {
+      method: "DELETE",
+    });
+  }
+
+  /**
+   * Create an invite link to a room the user owns or administers
+   */
+  async createInvite(
+    slug: string,
+    params: CreateInviteParams = {}
+  ): Promise<RoomInvite> {
+    return this.request<RoomInvite>(`/api/rooms/${slug}/invites`, {
+      method: "POST",
+      body: JSON.stringify(params),
+    });
+  }
+
+  /**
+   * List a room's invites that can still be redeemed
+   */
+  async listInvites(
+    slug: string
+  ): Promise<{ invites: RoomInvite[]; count: number }> {
+    return this.request<{ invites: RoomInvite[]; count: number }>(
+      `/api/rooms/${slug}/invites`
+    );
+  }
+
+  /**
+   * Revoke an invite; members who already joined with it stay members
+   */
+  async revokeInvite(slug: string, inviteId: string): Promise<void> {
+    await this.request(`/api/rooms/${slug}/invites/${inviteId}`, {
+      method: "DELETE",
+    });
+  }
 }
 
 // Export singleton instance
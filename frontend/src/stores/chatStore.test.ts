@@ -104,6 +104,27 @@ describe("ChatStore", () => {
       expect(users["user-999"]).toBeUndefined();
     });
 
+    it("should update user cursor", () => {
+      const { addUser, updateUserCursor } = useChatStore.getState();
+
+      addUser("user-123", "Alice", "#ef4444");
+      updateUserCursor("user-123", 120, 340);
+
+      const users = useChatStore.getState().users;
+      expect(users["user-123"].x).toBe(120);
+      expect(users["user-123"].y).toBe(340);
+      expect(users["user-123"].username).toBe("Alice"); // Username should remain
+    });
+
+    it("should not update cursor for non-existent user", () => {
+      const { updateUserCursor } = useChatStore.getState();
+
+      updateUserCursor("user-999", 120, 340);
+
+      const users = useChatStore.getState().users;
+      expect(users["user-999"]).toBeUndefined();
+    });
+
     it("should remove user", () => {
       const { addUser, removeUser } = useChatStore.getState();
 
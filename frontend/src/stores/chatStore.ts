@@ -28,6 +28,8 @@ export interface User {
   id: string;
   color: string;
   username?: string;
+  x?: number; // Last shared cursor position on the canvas
+  y?: number;
 }
 
 interface Viewport {
@@ -44,7 +46,7 @@ interface ChatState {
   localUserId: string;
 
   // Actions - Messages
-  addMessage: (messageId: string, userId: string, content: string, x: number, y: number) => void;
+  addMessage: (messageId: string, userId: string, content: string, x: number, y: number, ageMs?: number) => void;
   updateMessage: (messageId: string, content: string) => void;
   removeMessage: (messageId: string) => void;
   fadeOutMessage: (messageId: string) => void;
@@ -53,8 +55,12 @@ interface ChatState {
   addUser: (userId: string, username?: string, color?: string) => void;
   updateUserUsername: (userId: string, username: string) => void;
   updateUserColor: (userId: string, color: string) => void;
+  updateUserCursor: (userId: string, x: number, y: number) => void;
   removeUser: (userId: string) => void;
 
+  // Actions - Room
+  clearRoom: () => void;
+
   // Actions - Viewport
   setViewport: (viewport: Viewport) => void;
 }
@@ -67,7 +73,7 @@ export const useChatStore = create<ChatState>((set, get) => ({
   localUserId: typeof window !== "undefined" ? getOrCreateUserId() : "",
 
   // Message actions
-  addMessage: (messageId, userId, content, x, y) => {
+  addMessage: (messageId, userId, content, x, y, ageMs = 0) => {
     const state = get();
 
     // Add user if doesn't exist
@@ -81,10 +87,11 @@ export const useChatStore = create<ChatState>((set, get) => ({
       window.clearTimeout(existingMessage.timeoutID);
     }
 
+    // Messages from a canvas snapshot have already been on screen for ageMs
     const userColor = state.users[userId]?.color || generateColor(userId);
     const timeoutID = window.setTimeout(() => {
       state.fadeOutMessage(messageId);
-    }, REMOVE_DELAY);
+    }, Math.max(REMOVE_DELAY - ageMs, 0));
 
     set((state) => ({
       messages: {
@@ -221,6 +228,23 @@ export const useChatStore = create<ChatState>((set, get) => ({
     });
   },
 
+  updateUserCursor: (userId, x, y) => {
+    set((state) => {
+      if (!state.users[userId]) return state;
+
+      return {
+        users: {
+          ...state.users,
+          [userId]: {
+            ...state.users[userId],
+            x,
+            y,
+          },
+        },
+      };
+    });
+  },
+
   removeUser: (userId) => {
     set((state) => {
       const { [userId]: removed, ...rest } = state.users;
@@ -228,6 +252,15 @@ export const useChatStore = create<ChatState>((set, get) => ({
     });
   },
 
+  // Room actions
+  clearRoom: () => {
+    // Drop everything from the previous room; the next user_sync and canvas_sync refill it
+    Object.values(get().messages).forEach((message) => {
+      window.clearTimeout(message.timeoutID);
+    });
+    set({ messages: {}, users: {} });
+  },
+
   // Viewport actions
   setViewport: (viewport) => {
     set({ viewport });
@@ -4,6 +4,7 @@ import { generateUUID } from "./uuid";
 const USER_ID_KEY = "asocial_user_id";
 const USERNAME_KEY = "asocial_username";
 const USER_COLOR_KEY = "asocial_user_color";
+const GUEST_TOKEN_KEY = "asocial_guest_token";
 
 // Available color palette (same as chatStore)
 export const COLOR_PALETTE = [
@@ -88,6 +89,29 @@ export function setUserColor(color: string): void {
   }
 }
 
+/**
+ * Get the server-signed guest token from localStorage
+ * Returns null if no token has been issued yet
+ */
+export function getGuestToken(): string | null {
+  if (typeof window === "undefined") {
+    return null;
+  }
+
+  return localStorage.getItem(GUEST_TOKEN_KEY);
+}
+
+/**
+ * Store the server-signed guest token in localStorage
+ */
+export function setGuestToken(token: string): void {
+  if (typeof window === "undefined") {
+    return;
+  }
+
+  localStorage.setItem(GUEST_TOKEN_KEY, token);
+}
+
 /**
  * Clear all user data from localStorage
  * Useful for "logout" or "reset identity" functionality
@@ -100,4 +124,5 @@ export function clearUserData(): void {
   localStorage.removeItem(USER_ID_KEY);
   localStorage.removeItem(USERNAME_KEY);
   localStorage.removeItem(USER_COLOR_KEY);
+  localStorage.removeItem(GUEST_TOKEN_KEY);
 }
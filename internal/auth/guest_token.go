@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidGuestToken = errors.New("invalid guest token")
+	ErrExpiredGuestToken = errors.New("guest token expired")
+)
+
+// GuestClaims is the signed payload of a guest token
+type GuestClaims struct {
+	GuestID   string `json:"gid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// GuestTokenService issues and verifies server-signed anonymous guest identities
+// Tokens are "<base64url(claims)>.<base64url(HMAC-SHA256(claims))>"
+type GuestTokenService struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewGuestTokenService creates a guest token service signing with the given secret
+func NewGuestTokenService(secret []byte, ttl time.Duration) (*GuestTokenService, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("guest token secret must be at least 32 bytes, got %d", len(secret))
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("guest token TTL must be positive, got %s", ttl)
+	}
+
+	return &GuestTokenService{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}, nil
+}
+
+// GenerateGuestTokenSecret returns a random signing secret
+// Tokens signed with it do not survive a restart, so this is only meant for development
+func GenerateGuestTokenSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate guest token secret: %w", err)
+	}
+	return secret, nil
+}
+
+// Issue signs a token for the given guest ID, generating a new ID if empty
+func (s *GuestTokenService) Issue(guestID string) (string, *GuestClaims, error) {
+	if guestID == "" {
+		guestID = uuid.New().String()
+	}
+
+	now := s.now()
+	claims := &GuestClaims{
+		GuestID:   guestID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	}
+
+	token, err := sealClaims(s.secret, guestTokenPurpose, claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to seal guest claims: %w", err)
+	}
+
+	return token, claims, nil
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (s *GuestTokenService) Verify(token string) (*GuestClaims, error) {
+	var claims GuestClaims
+	if !openClaims(s.secret, guestTokenPurpose, token, &claims) || claims.GuestID == "" {
+		return nil, ErrInvalidGuestToken
+	}
+
+	if s.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredGuestToken
+	}
+
+	return &claims, nil
+}
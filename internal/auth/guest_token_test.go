@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestGuestTokenService(t *testing.T) *GuestTokenService {
+	t.Helper()
+
+	svc, err := NewGuestTokenService([]byte(strings.Repeat("k", 32)), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create guest token service: %v", err)
+	}
+	return svc
+}
+
+func TestGuestTokenService_IssueAndVerify(t *testing.T) {
+	svc := newTestGuestTokenService(t)
+
+	token, issued, err := svc.Issue("")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if issued.GuestID == "" {
+		t.Fatal("Expected a generated guest ID")
+	}
+
+	claims, err := svc.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.GuestID != issued.GuestID {
+		t.Errorf("Expected GuestID %s, got %s", issued.GuestID, claims.GuestID)
+	}
+	if claims.ExpiresAt != issued.ExpiresAt {
+		t.Errorf("Expected ExpiresAt %d, got %d", issued.ExpiresAt, claims.ExpiresAt)
+	}
+}
+
+func TestGuestTokenService_KeepsGuestID(t *testing.T) {
+	svc := newTestGuestTokenService(t)
+
+	token, _, err := svc.Issue("guest-123")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	claims, err := svc.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.GuestID != "guest-123" {
+		t.Errorf("Expected GuestID guest-123, got %s", claims.GuestID)
+	}
+}
+
+func TestGuestTokenService_Expired(t *testing.T) {
+	svc := newTestGuestTokenService(t)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	token, _, err := svc.Issue("")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	svc.now = func() time.Time { return now.Add(time.Hour + time.Second) }
+	if _, err := svc.Verify(token); err != ErrExpiredGuestToken {
+		t.Errorf("Expected ErrExpiredGuestToken, got %v", err)
+	}
+}
+
+func TestGuestTokenService_RejectsForgeries(t *testing.T) {
+	svc := newTestGuestTokenService(t)
+
+	token, _, err := svc.Issue("guest-123")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	other, err := NewGuestTokenService([]byte(strings.Repeat("x", 32)), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create guest token service: %v", err)
+	}
+	forged, _, err := other.Issue("guest-456")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	// An invite token signed with the same secret is not a guest token
+	invites, err := NewInviteTokenService([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("Failed to create invite token service: %v", err)
+	}
+	inviteToken, err := invites.Sign(uuid.New(), uuid.New(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	otherPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "no signature", token: payload},
+		{name: "garbage", token: "not.a-token"},
+		{name: "wrong key", token: forged},
+		{name: "swapped payload", token: otherPayload + "." + sig},
+		{name: "invite token", token: inviteToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Verify(tt.token); err != ErrInvalidGuestToken {
+				t.Errorf("Expected ErrInvalidGuestToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewGuestTokenService_ShortSecret(t *testing.T) {
+	if _, err := NewGuestTokenService([]byte("short"), time.Hour); err == nil {
+		t.Error("Expected error for short secret")
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestInviteTokenService(t *testing.T) *InviteTokenService {
+	t.Helper()
+
+	svc, err := NewInviteTokenService([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("Failed to create invite token service: %v", err)
+	}
+	return svc
+}
+
+func TestInviteTokenService_SignAndVerify(t *testing.T) {
+	svc := newTestInviteTokenService(t)
+	inviteID, roomID := uuid.New(), uuid.New()
+	expiresAt := time.Now().Add(time.Hour)
+
+	token, err := svc.Sign(inviteID, roomID, expiresAt)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	claims, err := svc.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.InviteID != inviteID || claims.RoomID != roomID {
+		t.Errorf("Expected invite %s to room %s, got %s to %s", inviteID, roomID, claims.InviteID, claims.RoomID)
+	}
+	if claims.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("Expected ExpiresAt %d, got %d", expiresAt.Unix(), claims.ExpiresAt)
+	}
+
+	// The same invite always gets the same link
+	again, err := svc.Sign(inviteID, roomID, expiresAt)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if again != token {
+		t.Error("Expected signing an invite twice to give the same token")
+	}
+}
+
+func TestInviteTokenService_Expired(t *testing.T) {
+	svc := newTestInviteTokenService(t)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	token, err := svc.Sign(uuid.New(), uuid.New(), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	svc.now = func() time.Time { return now.Add(time.Hour + time.Second) }
+	if _, err := svc.Verify(token); err != ErrExpiredInviteToken {
+		t.Errorf("Expected ErrExpiredInviteToken, got %v", err)
+	}
+}
+
+func TestInviteTokenService_RejectsForgeries(t *testing.T) {
+	svc := newTestInviteTokenService(t)
+
+	other, err := NewInviteTokenService([]byte(strings.Repeat("x", 32)))
+	if err != nil {
+		t.Fatalf("Failed to create invite token service: %v", err)
+	}
+	forged, err := other.Sign(uuid.New(), uuid.New(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// A guest token signed with the same secret is not an invite
+	guests, err := NewGuestTokenService([]byte(strings.Repeat("k", 32)), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create guest token service: %v", err)
+	}
+	guestToken, _, err := guests.Issue("guest-123")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "garbage", token: "not.a-token"},
+		{name: "wrong key", token: forged},
+		{name: "guest token", token: guestToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Verify(tt.token); err != ErrInvalidInviteToken {
+				t.Errorf("Expected ErrInvalidInviteToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewInviteTokenService_ShortSecret(t *testing.T) {
+	if _, err := NewInviteTokenService([]byte("short")); err == nil {
+		t.Error("Expected error for short secret")
+	}
+}
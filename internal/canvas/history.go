@@ -0,0 +1,94 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxHistoryItems bounds how many history rows go into one snapshot
+const maxHistoryItems = 500
+
+// MessageHistory lists committed messages edited since a point in time
+type MessageHistory interface {
+	ListUpdatedSince(ctx context.Context, roomID uuid.UUID, since time.Time, limit int) ([]*domain.ChatMessage, error)
+}
+
+// HistorySource builds snapshots from the Postgres message history
+// Messages are committed only after their commit delay, which is most of the visible
+// window, so drafts sent through this node are kept in memory and merged in. Drafts
+// typed on other nodes appear once committed.
+type HistorySource struct {
+	history MessageHistory
+	window  time.Duration
+	drafts  *MemoryCache
+}
+
+// NewHistorySource creates a snapshot source reading committed messages from history
+func NewHistorySource(history MessageHistory, window time.Duration) *HistorySource {
+	return &HistorySource{
+		history: history,
+		window:  window,
+		drafts:  NewMemoryCache(window, nil),
+	}
+}
+
+// Record keeps the latest version of a message until history has caught up with it
+func (s *HistorySource) Record(ctx context.Context, msg *domain.Message) error {
+	return s.drafts.Record(ctx, msg)
+}
+
+// Snapshot returns the messages edited within the visible window, oldest edit first
+// A draft newer than its committed version replaces it.
+func (s *HistorySource) Snapshot(ctx context.Context, channelID string) ([]domain.CanvasItem, error) {
+	roomID, err := uuid.Parse(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s is not a room: %w", channelID, err)
+	}
+
+	now := time.Now()
+	messages, err := s.history.ListUpdatedSince(ctx, roomID, now.Add(-s.window), maxHistoryItems)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts, err := s.drafts.Snapshot(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]domain.CanvasItem, 0, len(messages)+len(drafts))
+	index := make(map[string]int, len(messages)+len(drafts)) // Author and message ID -> position in items
+	for _, msg := range messages {
+		index[msg.UserID+":"+msg.ID] = len(items)
+		items = append(items, domain.CanvasItem{
+			MessageID: msg.ID,
+			UserID:    msg.UserID,
+			Username:  msg.Username,
+			Color:     msg.Color,
+			Payload:   msg.Payload,
+			Position:  msg.Position,
+			UpdatedAt: msg.UpdatedAt.UnixMilli(),
+			AgeMs:     now.Sub(msg.UpdatedAt).Milliseconds(),
+		})
+	}
+
+	for _, draft := range drafts {
+		key := draft.UserID + ":" + draft.MessageID
+		if i, ok := index[key]; ok {
+			if draft.UpdatedAt > items[i].UpdatedAt {
+				items[i] = draft
+			}
+			continue
+		}
+		index[key] = len(items)
+		items = append(items, draft)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].UpdatedAt < items[j].UpdatedAt })
+	return items, nil
+}
@@ -0,0 +1,70 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// staticHistory is a MessageHistory returning the same committed messages every time
+type staticHistory []*domain.ChatMessage
+
+func (h staticHistory) ListUpdatedSince(ctx context.Context, roomID uuid.UUID, since time.Time, limit int) ([]*domain.ChatMessage, error) {
+	return h, nil
+}
+
+func TestHistorySource_IncludesDrafts(t *testing.T) {
+	ctx := context.Background()
+	roomID := uuid.New()
+	channelID := roomID.String()
+
+	committedAt := time.Now().Add(-time.Second)
+	history := staticHistory{
+		{ID: "msg-1", RoomID: roomID, UserID: "alice", Payload: "committed", UpdatedAt: committedAt},
+		{ID: "msg-2", RoomID: roomID, UserID: "alice", Payload: "old", UpdatedAt: committedAt},
+	}
+	source := NewHistorySource(history, 5*time.Second)
+
+	// Still being typed, so not committed yet
+	record := func(userID, messageID, payload string) {
+		msg := &domain.Message{
+			Type:      domain.MessageTypeChat,
+			ChannelID: channelID,
+			UserID:    userID,
+			MessageID: &messageID,
+			Payload:   &payload,
+			Position:  &domain.Position{X: 10, Y: 10},
+		}
+		if err := source.Record(ctx, msg); err != nil {
+			t.Fatalf("Failed to record draft: %v", err)
+		}
+	}
+	record("bob", "msg-3", "typing")
+	record("alice", "msg-2", "edited")
+
+	items, err := source.Snapshot(ctx, channelID)
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+
+	got := make(map[string]string, len(items))
+	for _, item := range items {
+		got[item.UserID+":"+item.MessageID] = item.Payload
+	}
+	want := map[string]string{
+		"alice:msg-1": "committed",
+		"alice:msg-2": "edited",
+		"bob:msg-3":   "typing",
+	}
+	if len(got) != len(want) || len(items) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for key, payload := range want {
+		if got[key] != payload {
+			t.Errorf("Expected %s to read %q, got %q", key, payload, got[key])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCache keeps each channel's recently edited messages in process memory
+// It only sees messages sent through this node, so it suits single-node mode.
+type MemoryCache struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	channels map[string]map[string]domain.CanvasItem
+}
+
+// NewMemoryCache creates a canvas cache keeping messages edited within the visible window
+// now drives message ages; nil uses the wall clock.
+func NewMemoryCache(window time.Duration, now func() time.Time) *MemoryCache {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryCache{
+		window:   window,
+		now:      now,
+		channels: make(map[string]map[string]domain.CanvasItem),
+	}
+}
+
+// Record stores the latest version of a chat message
+// A message whose text was deleted is removed from the canvas
+func (c *MemoryCache) Record(ctx context.Context, msg *domain.Message) error {
+	if msg.Type != domain.MessageTypeChat || msg.MessageID == nil || msg.Position == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items, ok := c.channels[msg.ChannelID]
+	if !ok {
+		items = make(map[string]domain.CanvasItem)
+		c.channels[msg.ChannelID] = items
+	}
+
+	if msg.Payload == nil || *msg.Payload == "" {
+		delete(items, *msg.MessageID)
+		return nil
+	}
+
+	items[*msg.MessageID] = domain.CanvasItem{
+		MessageID: *msg.MessageID,
+		UserID:    msg.UserID,
+		Username:  msg.Username,
+		Color:     msg.Color,
+		Payload:   *msg.Payload,
+		Position:  *msg.Position,
+		UpdatedAt: c.now().UnixMilli(),
+	}
+	return nil
+}
+
+// Snapshot returns the messages edited within the visible window, oldest edit first
+func (c *MemoryCache) Snapshot(ctx context.Context, channelID string) ([]domain.CanvasItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixMilli()
+	cutoff := now - c.window.Milliseconds()
+
+	result := []domain.CanvasItem{}
+	for id, item := range c.channels[channelID] {
+		if item.UpdatedAt < cutoff {
+			// Faded, drop it
+			delete(c.channels[channelID], id)
+			continue
+		}
+		item.AgeMs = now - item.UpdatedAt
+		result = append(result, item)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].UpdatedAt < result[j].UpdatedAt })
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sync"
+)
+
+// MemoryCursors keeps each channel's cursor positions in process memory
+// It only sees cursors moved through this node, so it suits single-node mode.
+type MemoryCursors struct {
+	mu       sync.Mutex
+	channels map[string]map[string]domain.Position
+}
+
+// NewMemoryCursors creates an in-memory cursor store
+func NewMemoryCursors() *MemoryCursors {
+	return &MemoryCursors{
+		channels: make(map[string]map[string]domain.Position),
+	}
+}
+
+// Move records a user's pointer position
+func (c *MemoryCursors) Move(ctx context.Context, channelID, userID string, position domain.Position) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursors, ok := c.channels[channelID]
+	if !ok {
+		cursors = make(map[string]domain.Position)
+		c.channels[channelID] = cursors
+	}
+	cursors[userID] = position
+	return nil
+}
+
+// Cursors returns the last position of every user in the channel who shared one
+func (c *MemoryCursors) Cursors(ctx context.Context, channelID string) (map[string]domain.Position, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursors := make(map[string]domain.Position, len(c.channels[channelID]))
+	for userID, position := range c.channels[channelID] {
+		cursors[userID] = position
+	}
+	return cursors, nil
+}
+
+// Remove forgets a user's position
+func (c *MemoryCursors) Remove(ctx context.Context, channelID, userID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursors := c.channels[channelID]
+	delete(cursors, userID)
+	if len(cursors) == 0 {
+		delete(c.channels, channelID)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache keeps each channel's recently edited messages in Redis
+// Every node records the messages its own sessions send, so the cache holds the
+// whole room no matter which node a joiner lands on.
+//
+// Layout per channel:
+//   - chat:canvas:<channel>:items   hash of message_id -> JSON CanvasItem
+//   - chat:canvas:<channel>:updated sorted set of message_id scored by last edit (ms)
+type RedisCache struct {
+	client *redis.Client
+	window time.Duration
+	logger *slog.Logger
+}
+
+// NewRedisCache creates a canvas cache keeping messages edited within the visible window
+func NewRedisCache(client *redis.Client, window time.Duration, logger *slog.Logger) *RedisCache {
+	return &RedisCache{
+		client: client,
+		window: window,
+		logger: logger,
+	}
+}
+
+// Record stores the latest version of a chat message
+// A message whose text was deleted is removed from the canvas
+func (c *RedisCache) Record(ctx context.Context, msg *domain.Message) error {
+	if msg.Type != domain.MessageTypeChat || msg.MessageID == nil || msg.Position == nil {
+		return nil
+	}
+
+	itemsKey, updatedKey := cacheKeys(msg.ChannelID)
+
+	if msg.Payload == nil || *msg.Payload == "" {
+		pipe := c.client.TxPipeline()
+		pipe.HDel(ctx, itemsKey, *msg.MessageID)
+		pipe.ZRem(ctx, updatedKey, *msg.MessageID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to remove canvas item: %w", err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	item := domain.CanvasItem{
+		MessageID: *msg.MessageID,
+		UserID:    msg.UserID,
+		Username:  msg.Username,
+		Color:     msg.Color,
+		Payload:   *msg.Payload,
+		Position:  *msg.Position,
+		UpdatedAt: now.UnixMilli(),
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal canvas item: %w", err)
+	}
+
+	// Keys outlive the window a little so idle rooms clean themselves up
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, itemsKey, item.MessageID, data)
+	pipe.ZAdd(ctx, updatedKey, redis.Z{Score: float64(item.UpdatedAt), Member: item.MessageID})
+	pipe.Expire(ctx, itemsKey, 2*c.window)
+	pipe.Expire(ctx, updatedKey, 2*c.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record canvas item: %w", err)
+	}
+
+	return nil
+}
+
+// Snapshot returns the messages edited within the visible window, oldest edit first
+func (c *RedisCache) Snapshot(ctx context.Context, channelID string) ([]domain.CanvasItem, error) {
+	itemsKey, updatedKey := cacheKeys(channelID)
+	now := time.Now()
+	cutoff := strconv.FormatInt(now.Add(-c.window).UnixMilli(), 10)
+
+	// Drop faded messages before reading
+	stale, err := c.client.ZRangeByScore(ctx, updatedKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stale canvas items: %w", err)
+	}
+	if len(stale) > 0 {
+		pipe := c.client.TxPipeline()
+		pipe.ZRem(ctx, updatedKey, toAny(stale)...)
+		pipe.HDel(ctx, itemsKey, stale...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			c.logger.Warn("Failed to prune canvas items", "error", err, "channel", channelID)
+		}
+	}
+
+	ids, err := c.client.ZRangeByScore(ctx, updatedKey, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read canvas items: %w", err)
+	}
+	if len(ids) == 0 {
+		return []domain.CanvasItem{}, nil
+	}
+
+	values, err := c.client.HMGet(ctx, itemsKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read canvas items: %w", err)
+	}
+
+	items := make([]domain.CanvasItem, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var item domain.CanvasItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			c.logger.Warn("Failed to decode canvas item", "error", err, "channel", channelID)
+			continue
+		}
+		item.AgeMs = now.UnixMilli() - item.UpdatedAt
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// cacheKeys returns the Redis keys for a channel's canvas
+func cacheKeys(channelID string) (items, updated string) {
+	return fmt.Sprintf("chat:canvas:%s:items", channelID), fmt.Sprintf("chat:canvas:%s:updated", channelID)
+}
+
+// toAny converts strings to the variadic form ZRem expects
+func toAny(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
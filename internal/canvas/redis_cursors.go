@@ -0,0 +1,82 @@
+package canvas
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cursorRetention is how long a channel's cursors outlive its last move
+// Users still present keep theirs; the rest expire with the channel once it goes quiet.
+const cursorRetention = time.Hour
+
+// RedisCursors keeps each channel's cursor positions in Redis
+// Every node records the moves of its own sessions, so joiners on any node see all cursors.
+//
+// Layout per channel:
+//   - chat:canvas:<channel>:cursors hash of user_id -> JSON Position
+type RedisCursors struct {
+	client *redis.Client
+	logger *slog.Logger
+}
+
+// NewRedisCursors creates a Redis cursor store
+func NewRedisCursors(client *redis.Client, logger *slog.Logger) *RedisCursors {
+	return &RedisCursors{
+		client: client,
+		logger: logger,
+	}
+}
+
+// cursorsKey returns the hash holding a channel's cursors
+func cursorsKey(channelID string) string {
+	return fmt.Sprintf("chat:canvas:%s:cursors", channelID)
+}
+
+// Move records a user's pointer position
+func (c *RedisCursors) Move(ctx context.Context, channelID, userID string, position domain.Position) error {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cursor: %w", err)
+	}
+
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, cursorsKey(channelID), userID, data)
+	pipe.Expire(ctx, cursorsKey(channelID), cursorRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record cursor: %w", err)
+	}
+	return nil
+}
+
+// Cursors returns the last position of every user in the channel who shared one
+func (c *RedisCursors) Cursors(ctx context.Context, channelID string) (map[string]domain.Position, error) {
+	values, err := c.client.HGetAll(ctx, cursorsKey(channelID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cursors: %w", err)
+	}
+
+	cursors := make(map[string]domain.Position, len(values))
+	for userID, data := range values {
+		var position domain.Position
+		if err := json.Unmarshal([]byte(data), &position); err != nil {
+			c.logger.Warn("Failed to decode cursor", "error", err, "channel", channelID, "user_id", userID)
+			continue
+		}
+		cursors[userID] = position
+	}
+	return cursors, nil
+}
+
+// Remove forgets a user's position
+func (c *RedisCursors) Remove(ctx context.Context, channelID, userID string) error {
+	if err := c.client.HDel(ctx, cursorsKey(channelID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to remove cursor: %w", err)
+	}
+	return nil
+}
@@ -3,31 +3,50 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Auth     AuthConfig     `mapstructure:"auth"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Redis         RedisConfig         `mapstructure:"redis"`
+	PubSub        PubSubConfig        `mapstructure:"pubsub"`
+	Database      DatabaseConfig      `mapstructure:"database"`
+	Auth          AuthConfig          `mapstructure:"auth"`
+	Canvas        CanvasConfig        `mapstructure:"canvas"`
+	Presence      PresenceConfig      `mapstructure:"presence"`
+	Resume        ResumeConfig        `mapstructure:"resume"`
+	RateLimit     RateLimitConfig     `mapstructure:"rate_limit"`
+	HTTPRateLimit HTTPRateLimitConfig `mapstructure:"http_rate_limit"`
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port           string `mapstructure:"port"`
-	MaxConnections int    `mapstructure:"max_connections"`
-	MaxMessageSize int    `mapstructure:"max_message_size"`
+	Port                string        `mapstructure:"port"`
+	MaxConnections      int           `mapstructure:"max_connections"`
+	MaxMessageSize      int           `mapstructure:"max_message_size"`
+	ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout"`      // How long draining sessions may take on SIGTERM
+	DrainReconnectDelay time.Duration `mapstructure:"drain_reconnect_delay"` // Reconnect hint sent to clients when draining
+	OutboundQueueSize   int           `mapstructure:"outbound_queue_size"`   // Broadcast frames queued per session before dropping
+	SlowConsumerTimeout time.Duration `mapstructure:"slow_consumer_timeout"` // How long a session's queue may stay full before it is closed
 }
 
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
-	Addr     string `mapstructure:"addr"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
-	Channel  string `mapstructure:"channel"`
+	Addr          string `mapstructure:"addr"`
+	Password      string `mapstructure:"password"`
+	DB            int    `mapstructure:"db"`
+	ChannelPrefix string `mapstructure:"channel_prefix"` // Per-room channels (or streams) are <prefix><room id>
+}
+
+// PubSubConfig holds configuration for cross-node message delivery
+type PubSubConfig struct {
+	Backend      string `mapstructure:"backend"`        // redis (pub/sub), streams, nats or memory
+	NodeID       string `mapstructure:"node_id"`        // Names this node's locks; defaults to the hostname
+	StreamMaxLen int64  `mapstructure:"stream_max_len"` // Approximate entries kept per room stream
+	NATSURL      string `mapstructure:"nats_url"`
 }
 
 // DatabaseConfig holds database configuration
@@ -42,8 +61,70 @@ type DatabaseConfig struct {
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	FirebaseCredentialsPath string `mapstructure:"firebase_credentials_path"`
-	AppURL                  string `mapstructure:"app_url"`
+	FirebaseCredentialsPath string        `mapstructure:"firebase_credentials_path"`
+	AppURL                  string        `mapstructure:"app_url"`
+	GuestTokenSecret        string        `mapstructure:"guest_token_secret"`
+	GuestTokenTTL           time.Duration `mapstructure:"guest_token_ttl"`
+	InviteTokenSecret       string        `mapstructure:"invite_token_secret"` // The guest token secret if empty
+}
+
+// CanvasConfig holds configuration for the canvas snapshot sent to new joiners
+type CanvasConfig struct {
+	SnapshotSource string        `mapstructure:"snapshot_source"` // redis, memory, history or none
+	VisibleWindow  time.Duration `mapstructure:"visible_window"`
+	ViewportMargin float64       `mapstructure:"viewport_margin"` // Screen pixels around a client's viewport that still receive chat frames
+}
+
+// PresenceConfig holds configuration for tracking who is in each room
+type PresenceConfig struct {
+	SweepInterval time.Duration `mapstructure:"sweep_interval"` // How often lapsed sessions are announced as user_left
+}
+
+// ResumeConfig holds configuration for resuming sessions after a dropped connection
+type ResumeConfig struct {
+	GraceWindow time.Duration `mapstructure:"grace_window"` // How long a disconnected session can be resumed; 0 disables resuming
+	BufferSize  int           `mapstructure:"buffer_size"`  // Recent messages kept per channel for resumed and backfilling sessions
+}
+
+// RateLimitConfig holds the budgets WebSocket frames are drawn from, per message type
+type RateLimitConfig struct {
+	Enabled      bool           `mapstructure:"enabled"`
+	Chat         FrameRateLimit `mapstructure:"chat"`        // Also applies to message types without their own limits
+	Cursor       FrameRateLimit `mapstructure:"cursor"`      // cursor_moved
+	Viewport     FrameRateLimit `mapstructure:"viewport"`    // viewport_update
+	Profile      FrameRateLimit `mapstructure:"profile"`     // username_changed and color_changed, each on its own
+	History      FrameRateLimit `mapstructure:"history"`     // replay and backfill, each on its own
+	MaxStrikes   int            `mapstructure:"max_strikes"` // Rejected frames within strike_window before disconnecting; 0 never disconnects
+	StrikeWindow time.Duration  `mapstructure:"strike_window"`
+}
+
+// FrameRateLimit is how many frames per second, with bursts of how many, a session, user and client IP may send
+// A zero rate is unlimited.
+type FrameRateLimit struct {
+	SessionRate  float64 `mapstructure:"session_rate"`
+	SessionBurst int     `mapstructure:"session_burst"`
+	UserRate     float64 `mapstructure:"user_rate"`
+	UserBurst    int     `mapstructure:"user_burst"`
+	IPRate       float64 `mapstructure:"ip_rate"`
+	IPBurst      int     `mapstructure:"ip_burst"`
+}
+
+// HTTPRateLimitConfig holds how often each group of REST routes may be called
+type HTTPRateLimitConfig struct {
+	Enabled       bool           `mapstructure:"enabled"`
+	CheckUsername RouteRateLimit `mapstructure:"check_username"` // POST /api/auth/check-username
+	Guest         RouteRateLimit `mapstructure:"guest"`          // POST /api/auth/guest
+	Account       RouteRateLimit `mapstructure:"account"`        // The signed-in /api/auth routes
+	Rooms         RouteRateLimit `mapstructure:"rooms"`          // Room lookups, joins and management
+	Messages      RouteRateLimit `mapstructure:"messages"`       // GET /api/rooms/:slug/messages
+}
+
+// RouteRateLimit is how many requests a client IP and a signed-in user may make within any window
+// A zero limit is unlimited.
+type RouteRateLimit struct {
+	Window    time.Duration `mapstructure:"window"`
+	IPLimit   int           `mapstructure:"ip_limit"`
+	UserLimit int           `mapstructure:"user_limit"`
 }
 
 // Load loads configuration from file and environment variables
@@ -54,10 +135,18 @@ func Load(configPath string) (*Config, error) {
 	v.SetDefault("server.port", "3001")
 	v.SetDefault("server.max_connections", 200)
 	v.SetDefault("server.max_message_size", 4096)
+	v.SetDefault("server.shutdown_timeout", "10s")
+	v.SetDefault("server.drain_reconnect_delay", "2s")
+	v.SetDefault("server.outbound_queue_size", 256)
+	v.SetDefault("server.slow_consumer_timeout", "5s")
 	v.SetDefault("redis.addr", "localhost:6379")
 	v.SetDefault("redis.password", "")
 	v.SetDefault("redis.db", 0)
-	v.SetDefault("redis.channel", "chat:messages")
+	v.SetDefault("redis.channel_prefix", "chat:room:")
+	v.SetDefault("pubsub.backend", "redis")
+	v.SetDefault("pubsub.node_id", "")
+	v.SetDefault("pubsub.stream_max_len", 10000)
+	v.SetDefault("pubsub.nats_url", "nats://localhost:4222")
 	v.SetDefault("database.host", "localhost")
 	v.SetDefault("database.port", 5432)
 	v.SetDefault("database.user", "asocial")
@@ -66,6 +155,29 @@ func Load(configPath string) (*Config, error) {
 	v.SetDefault("database.sslmode", "disable")
 	v.SetDefault("auth.firebase_credentials_path", "")
 	v.SetDefault("auth.app_url", "http://localhost")
+	v.SetDefault("auth.guest_token_secret", "")
+	v.SetDefault("auth.guest_token_ttl", "720h")
+	v.SetDefault("auth.invite_token_secret", "")
+	v.SetDefault("canvas.snapshot_source", "redis")
+	v.SetDefault("canvas.visible_window", "5s")
+	v.SetDefault("canvas.viewport_margin", 400)
+	v.SetDefault("presence.sweep_interval", "30s")
+	v.SetDefault("resume.grace_window", "30s")
+	v.SetDefault("resume.buffer_size", 256)
+	v.SetDefault("rate_limit.enabled", true)
+	setFrameRateLimitDefaults(v, "rate_limit.chat", 30, 60, 60, 120, 120, 240)
+	setFrameRateLimitDefaults(v, "rate_limit.cursor", 30, 30, 60, 60, 200, 200)
+	setFrameRateLimitDefaults(v, "rate_limit.viewport", 10, 20, 20, 40, 100, 200)
+	setFrameRateLimitDefaults(v, "rate_limit.profile", 0.2, 5, 0.2, 5, 1, 10)
+	setFrameRateLimitDefaults(v, "rate_limit.history", 1, 5, 2, 10, 10, 20)
+	v.SetDefault("rate_limit.max_strikes", 20)
+	v.SetDefault("rate_limit.strike_window", "10s")
+	v.SetDefault("http_rate_limit.enabled", true)
+	setRouteRateLimitDefaults(v, "http_rate_limit.check_username", time.Minute, 20, 10)
+	setRouteRateLimitDefaults(v, "http_rate_limit.guest", time.Minute, 10, 0)
+	setRouteRateLimitDefaults(v, "http_rate_limit.account", time.Minute, 120, 60)
+	setRouteRateLimitDefaults(v, "http_rate_limit.rooms", time.Minute, 120, 60)
+	setRouteRateLimitDefaults(v, "http_rate_limit.messages", time.Minute, 60, 30)
 
 	// Read config file
 	if configPath != "" {
@@ -84,8 +196,16 @@ func Load(configPath string) (*Config, error) {
 	// Allow environment variable overrides
 	// e.g., ASOCIAL_SERVER_PORT=8080, ASOCIAL_REDIS_ADDR=redis:6379
 	v.BindEnv("server.port", "SERVER_PORT")
+	v.BindEnv("server.shutdown_timeout", "SHUTDOWN_TIMEOUT")
+	v.BindEnv("server.drain_reconnect_delay", "DRAIN_RECONNECT_DELAY")
+	v.BindEnv("server.outbound_queue_size", "OUTBOUND_QUEUE_SIZE")
+	v.BindEnv("server.slow_consumer_timeout", "SLOW_CONSUMER_TIMEOUT")
 	v.BindEnv("redis.addr", "REDIS_ADDR")
 	v.BindEnv("redis.password", "REDIS_PASSWORD")
+	v.BindEnv("pubsub.backend", "PUBSUB_BACKEND")
+	v.BindEnv("pubsub.node_id", "NODE_ID")
+	v.BindEnv("pubsub.stream_max_len", "PUBSUB_STREAM_MAX_LEN")
+	v.BindEnv("pubsub.nats_url", "NATS_URL")
 	v.BindEnv("database.host", "DB_HOST")
 	v.BindEnv("database.port", "DB_PORT")
 	v.BindEnv("database.user", "DB_USER")
@@ -94,6 +214,19 @@ func Load(configPath string) (*Config, error) {
 	v.BindEnv("database.sslmode", "DB_SSLMODE")
 	v.BindEnv("auth.firebase_credentials_path", "FIREBASE_CREDENTIALS_PATH")
 	v.BindEnv("auth.app_url", "APP_URL")
+	v.BindEnv("auth.guest_token_secret", "GUEST_TOKEN_SECRET")
+	v.BindEnv("auth.guest_token_ttl", "GUEST_TOKEN_TTL")
+	v.BindEnv("auth.invite_token_secret", "INVITE_TOKEN_SECRET")
+	v.BindEnv("canvas.snapshot_source", "CANVAS_SNAPSHOT_SOURCE")
+	v.BindEnv("canvas.visible_window", "CANVAS_VISIBLE_WINDOW")
+	v.BindEnv("canvas.viewport_margin", "CANVAS_VIEWPORT_MARGIN")
+	v.BindEnv("presence.sweep_interval", "PRESENCE_SWEEP_INTERVAL")
+	v.BindEnv("resume.grace_window", "RESUME_GRACE_WINDOW")
+	v.BindEnv("resume.buffer_size", "RESUME_BUFFER_SIZE")
+	v.BindEnv("rate_limit.enabled", "RATE_LIMIT_ENABLED")
+	v.BindEnv("rate_limit.max_strikes", "RATE_LIMIT_MAX_STRIKES")
+	v.BindEnv("rate_limit.strike_window", "RATE_LIMIT_STRIKE_WINDOW")
+	v.BindEnv("http_rate_limit.enabled", "HTTP_RATE_LIMIT_ENABLED")
 
 	// Read config file if exists
 	if err := v.ReadInConfig(); err != nil {
@@ -111,5 +244,30 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if cfg.PubSub.NodeID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname for node ID: %w", err)
+		}
+		cfg.PubSub.NodeID = hostname
+	}
+
 	return &cfg, nil
 }
+
+// setFrameRateLimitDefaults sets the default budgets of one message type
+func setFrameRateLimitDefaults(v *viper.Viper, key string, sessionRate float64, sessionBurst int, userRate float64, userBurst int, ipRate float64, ipBurst int) {
+	v.SetDefault(key+".session_rate", sessionRate)
+	v.SetDefault(key+".session_burst", sessionBurst)
+	v.SetDefault(key+".user_rate", userRate)
+	v.SetDefault(key+".user_burst", userBurst)
+	v.SetDefault(key+".ip_rate", ipRate)
+	v.SetDefault(key+".ip_burst", ipBurst)
+}
+
+// setRouteRateLimitDefaults sets the default limits of one group of routes
+func setRouteRateLimitDefaults(v *viper.Viper, key string, window time.Duration, ipLimit, userLimit int) {
+	v.SetDefault(key+".window", window)
+	v.SetDefault(key+".ip_limit", ipLimit)
+	v.SetDefault(key+".user_limit", userLimit)
+}
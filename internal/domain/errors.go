@@ -6,9 +6,18 @@ var (
 	// ErrInvalidMessage indicates the message format is invalid
 	ErrInvalidMessage = errors.New("invalid message format")
 
+	// ErrForbiddenField indicates a client sent a field only the server may set
+	ErrForbiddenField = errors.New("field not allowed from clients")
+
 	// ErrChannelNotFound indicates the channel does not exist
 	ErrChannelNotFound = errors.New("channel not found")
 
+	// ErrRoomSlugTaken indicates another room already has the slug
+	ErrRoomSlugTaken = errors.New("room slug already taken")
+
+	// ErrInviteUnavailable indicates an invite was revoked, has expired or has no uses left
+	ErrInviteUnavailable = errors.New("invite is no longer available")
+
 	// ErrUserNotFound indicates the user does not exist
 	ErrUserNotFound = errors.New("user not found")
 
@@ -17,4 +26,7 @@ var (
 
 	// ErrRedisConnection indicates Redis connection error
 	ErrRedisConnection = errors.New("redis connection error")
+
+	// ErrReplayUnsupported indicates the pub/sub backend keeps no history to replay from
+	ErrReplayUnsupported = errors.New("replay not supported by the pub/sub backend")
 )
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"encoding/json"
+	"math"
 	"time"
 )
 
@@ -15,27 +16,80 @@ const (
 	MessageTypeUserSync        MessageType = "user_sync"
 	MessageTypeUsernameChanged MessageType = "username_changed"
 	MessageTypeColorChanged    MessageType = "color_changed"
+	MessageTypeCanvasSync      MessageType = "canvas_sync"
+	MessageTypeReplay          MessageType = "replay"
+	MessageTypeServerDraining  MessageType = "server_draining"
+	MessageTypeViewportUpdate  MessageType = "viewport_update"
+	MessageTypeCursorMoved     MessageType = "cursor_moved"
+	MessageTypeBackfill        MessageType = "backfill"
+	MessageTypeAck             MessageType = "ack"
+	MessageTypeError           MessageType = "error"
+	MessageTypeRoomDeleted     MessageType = "room_deleted"
+	MessageTypeRoomRestricted  MessageType = "room_restricted"
+	MessageTypeGap             MessageType = "gap"
+)
+
+// SystemUserID is the sender of messages the server makes up itself, e.g. user_sync
+const SystemUserID = "system"
+
+// ErrorCode tells a client why the server rejected one of its frames
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidMessage ErrorCode = "invalid_message" // Undecodable, or missing or invalid fields
+	ErrorCodeForbidden      ErrorCode = "forbidden"       // Not allowed for this session, e.g. another user's ID
+	ErrorCodeRateLimited    ErrorCode = "rate_limited"    // Sent too often; retry later
+	ErrorCodePublishFailed  ErrorCode = "publish_failed"  // Valid, but could not be delivered to the room or answered
+	ErrorCodeTooLarge       ErrorCode = "too_large"       // Frame exceeds the maximum message size
 )
 
 // UserInfo represents a user with ID and optional username and color
 type UserInfo struct {
-	UserID   string  `json:"user_id"`
-	Username *string `json:"username,omitempty"`
-	Color    *string `json:"color,omitempty"`
+	UserID       string         `json:"user_id"`
+	Username     *string        `json:"username,omitempty"`
+	Color        *string        `json:"color,omitempty"`
+	Status       PresenceStatus `json:"status,omitempty"`
+	LastActiveAt int64          `json:"last_active_at,omitempty"` // Unix milliseconds
+	Sessions     int            `json:"sessions,omitempty"`       // Open connections, e.g. tabs
+	Cursor       *Position      `json:"cursor,omitempty"`         // Last shared pointer position
+}
+
+// CanvasItem is a message currently visible on a room's canvas
+type CanvasItem struct {
+	MessageID string   `json:"message_id"`
+	UserID    string   `json:"user_id"`
+	Username  *string  `json:"username,omitempty"`
+	Color     *string  `json:"color,omitempty"`
+	Payload   string   `json:"payload"`
+	Position  Position `json:"position"`
+	UpdatedAt int64    `json:"updated_at"` // Unix milliseconds of the last edit
+	AgeMs     int64    `json:"age_ms"`     // Time since the last edit when the snapshot was taken
 }
 
 // Message represents a chat message or presence event
 type Message struct {
-	Type      MessageType `json:"type"`
-	MessageID *string     `json:"message_id,omitempty"`
-	ChannelID string      `json:"channel_id"`
-	UserID    string      `json:"user_id"`
-	Username  *string     `json:"username,omitempty"` // For user_joined and username_changed
-	Color     *string     `json:"color,omitempty"`    // For user_joined and color_changed
-	Payload   *string     `json:"payload,omitempty"`
-	Position  *Position   `json:"position,omitempty"`
-	Users     []UserInfo  `json:"users,omitempty"` // For user_sync messages
-	Timestamp int64       `json:"timestamp"`
+	Type         MessageType  `json:"type"`
+	MessageID    *string      `json:"message_id,omitempty"`
+	ChannelID    string       `json:"channel_id"`
+	UserID       string       `json:"user_id"`
+	Username     *string      `json:"username,omitempty"` // For user_joined and username_changed
+	Color        *string      `json:"color,omitempty"`    // For user_joined and color_changed
+	Payload      *string      `json:"payload,omitempty"`
+	Position     *Position    `json:"position,omitempty"`
+	Users        []UserInfo   `json:"users,omitempty"`          // For user_sync messages; for room_restricted: who may stay
+	Messages     []CanvasItem `json:"messages,omitempty"`       // For canvas_sync messages
+	Final        bool         `json:"final,omitempty"`          // For chat messages: the author finished editing
+	StreamID     string       `json:"stream_id,omitempty"`      // Position in the room's stream, with the streams backend
+	Since        string       `json:"since,omitempty"`          // For replay requests: resend messages after this stream ID
+	RetryAfterMs int64        `json:"retry_after_ms,omitempty"` // For server_draining: how long to wait before reconnecting; for rate_limited errors: before sending again
+	ResumeToken  string       `json:"resume_token,omitempty"`   // For user_sync: reconnect with this to resume the session
+	Viewport     *Viewport    `json:"viewport,omitempty"`       // For viewport_update: the part of the canvas the client shows
+	Seq          int64        `json:"seq,omitempty"`            // Position in the room's sequence, assigned by the server
+	SinceSeq     int64        `json:"since_seq,omitempty"`      // For backfill requests: resend messages after this sequence number; for gaps: where the loss starts
+	RequestID    string       `json:"request_id,omitempty"`     // Chosen by the client; echoed in the ack or error for its frame
+	Code         ErrorCode    `json:"code,omitempty"`           // For error messages
+	Reason       string       `json:"reason,omitempty"`         // For error messages: human-readable detail
+	Timestamp    int64        `json:"timestamp"`                // Unix milliseconds, assigned by the server when published
 }
 
 // Position represents the x,y coordinates on the canvas
@@ -44,6 +98,25 @@ type Position struct {
 	Y float64 `json:"y"`
 }
 
+// Viewport is the rectangle of the canvas a client shows, in canvas coordinates
+type Viewport struct {
+	X      float64 `json:"x"` // Left edge
+	Y      float64 `json:"y"` // Top edge
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Zoom   float64 `json:"zoom"` // Screen pixels per canvas unit
+}
+
+// Valid reports whether the viewport is a finite rectangle with a positive zoom
+func (v Viewport) Valid() bool {
+	for _, f := range []float64{v.X, v.Y, v.Width, v.Height, v.Zoom} {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return v.Width >= 0 && v.Height >= 0 && v.Zoom > 0
+}
+
 // Encode serializes the message to JSON bytes
 func (m *Message) Encode() []byte {
 	data, _ := json.Marshal(m)
@@ -99,7 +172,7 @@ func NewUserSyncMessage(channelID string, users []UserInfo) *Message {
 	return &Message{
 		Type:      MessageTypeUserSync,
 		ChannelID: channelID,
-		UserID:    "system",
+		UserID:    SystemUserID,
 		Users:     users,
 		Timestamp: time.Now().UnixMilli(),
 	}
@@ -126,3 +199,118 @@ func NewColorChangedMessage(channelID, userID string, color *string) *Message {
 		Timestamp: time.Now().UnixMilli(),
 	}
 }
+
+// NewCanvasSyncMessage creates a canvas sync message with the messages visible in a channel
+func NewCanvasSyncMessage(channelID string, items []CanvasItem) *Message {
+	return &Message{
+		Type:      MessageTypeCanvasSync,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		Messages:  items,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewCursorMovedMessage creates a pointer position update for the user's peers
+func NewCursorMovedMessage(channelID, userID string, position Position) *Message {
+	return &Message{
+		Type:      MessageTypeCursorMoved,
+		ChannelID: channelID,
+		UserID:    userID,
+		Position:  &position,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewBackfillMessage ends a backfill reply
+// seq is the room's sequence number when the backfill was read: the client has now seen
+// everything up to it that it would have received live.
+func NewBackfillMessage(channelID string, seq int64) *Message {
+	return &Message{
+		Type:      MessageTypeBackfill,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		Seq:       seq,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewGapMessage tells a session that broadcasts after sinceSeq were dropped on their way to it
+// The client backfills from there. Messages it never gets for other reasons, because they
+// were outside its viewport or replaced by a newer version, leave gaps in seq without one.
+func NewGapMessage(channelID string, sinceSeq int64) *Message {
+	return &Message{
+		Type:      MessageTypeGap,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		SinceSeq:  sinceSeq,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewAckMessage confirms to its sender that a message was published
+// It carries the message's ID and sequence number, since the sender doesn't get its own
+// chat messages back.
+func NewAckMessage(msg *Message, requestID string) *Message {
+	return &Message{
+		Type:      MessageTypeAck,
+		MessageID: msg.MessageID,
+		ChannelID: msg.ChannelID,
+		UserID:    SystemUserID,
+		RequestID: requestID,
+		Seq:       msg.Seq,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewErrorMessage tells a session why one of its frames was rejected
+func NewErrorMessage(channelID, requestID string, code ErrorCode, reason string) *Message {
+	return &Message{
+		Type:      MessageTypeError,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		RequestID: requestID,
+		Code:      code,
+		Reason:    reason,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewServerDrainingMessage tells a session that the server is shutting down
+// The client should reconnect after retryAfter, when another replica can take it.
+func NewServerDrainingMessage(channelID string, retryAfter time.Duration) *Message {
+	return &Message{
+		Type:         MessageTypeServerDraining,
+		ChannelID:    channelID,
+		UserID:       SystemUserID,
+		RetryAfterMs: retryAfter.Milliseconds(),
+		Timestamp:    time.Now().UnixMilli(),
+	}
+}
+
+// NewRoomDeletedMessage tells every node to disconnect a deleted room's sessions
+// It only travels between nodes; clients see their connection closed instead.
+func NewRoomDeletedMessage(channelID string) *Message {
+	return &Message{
+		Type:      MessageTypeRoomDeleted,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// NewRoomRestrictedMessage tells every node to disconnect a room's sessions but its members'
+// Like room_deleted, it only travels between nodes.
+func NewRoomRestrictedMessage(channelID string, memberIDs []string) *Message {
+	users := make([]UserInfo, len(memberIDs))
+	for i, id := range memberIDs {
+		users[i] = UserInfo{UserID: id}
+	}
+	return &Message{
+		Type:      MessageTypeRoomRestricted,
+		ChannelID: channelID,
+		UserID:    SystemUserID,
+		Users:     users,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 	"time"
 )
@@ -347,3 +348,81 @@ func TestNewUserSyncMessage(t *testing.T) {
 		t.Errorf("User 2 data mismatch: got %+v", msg.Users[1])
 	}
 }
+
+func TestNewCanvasSyncMessage(t *testing.T) {
+	channelID := "default"
+	username := "Alice"
+
+	items := []CanvasItem{
+		{MessageID: "msg-1", UserID: "user-1", Username: &username, Payload: "hello", Position: Position{X: 10, Y: 20}, AgeMs: 1200},
+	}
+
+	msg := NewCanvasSyncMessage(channelID, items)
+
+	if msg.Type != MessageTypeCanvasSync {
+		t.Errorf("Expected type %s, got %s", MessageTypeCanvasSync, msg.Type)
+	}
+	if msg.ChannelID != channelID {
+		t.Errorf("Expected ChannelID %s, got %s", channelID, msg.ChannelID)
+	}
+	if msg.UserID != "system" {
+		t.Errorf("Expected UserID 'system', got %s", msg.UserID)
+	}
+
+	decoded, err := DecodeMessage(msg.Encode())
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if len(decoded.Messages) != 1 {
+		t.Fatalf("Expected 1 canvas item, got %d", len(decoded.Messages))
+	}
+	item := decoded.Messages[0]
+	if item.MessageID != "msg-1" || item.Payload != "hello" || item.Position != (Position{X: 10, Y: 20}) || item.AgeMs != 1200 {
+		t.Errorf("Canvas item mismatch: got %+v", item)
+	}
+	if item.Username == nil || *item.Username != "Alice" {
+		t.Errorf("Expected username Alice, got %v", item.Username)
+	}
+}
+
+func TestNewServerDrainingMessage(t *testing.T) {
+	msg := NewServerDrainingMessage("room-1", 2500*time.Millisecond)
+
+	if msg.Type != MessageTypeServerDraining {
+		t.Errorf("Expected type %s, got %s", MessageTypeServerDraining, msg.Type)
+	}
+	if msg.UserID != "system" {
+		t.Errorf("Expected UserID 'system', got %s", msg.UserID)
+	}
+
+	decoded, err := DecodeMessage(msg.Encode())
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if decoded.RetryAfterMs != 2500 {
+		t.Errorf("Expected RetryAfterMs 2500, got %d", decoded.RetryAfterMs)
+	}
+}
+
+func TestViewport_Valid(t *testing.T) {
+	tests := []struct {
+		name     string
+		viewport Viewport
+		valid    bool
+	}{
+		{"visible area", Viewport{X: -100, Y: 50, Width: 1280, Height: 720, Zoom: 1.5}, true},
+		{"empty area", Viewport{Zoom: 1}, true},
+		{"negative width", Viewport{Width: -1, Height: 720, Zoom: 1}, false},
+		{"no zoom", Viewport{Width: 1280, Height: 720}, false},
+		{"infinite", Viewport{Width: math.Inf(1), Height: 720, Zoom: 1}, false},
+		{"not a number", Viewport{X: math.NaN(), Width: 1280, Height: 720, Zoom: 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.viewport.Valid(); got != tt.valid {
+				t.Errorf("Valid() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
@@ -1,11 +1,31 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// DefaultUserColor is the color assigned to users who haven't picked one
+const DefaultUserColor = "#ef4444"
+
+// GuestIDPrefix marks user IDs that belong to anonymous guests rather than accounts
+const GuestIDPrefix = "guest:"
+
+// GuestUserID returns the guest-space user ID for an anonymous client identifier
+func GuestUserID(id string) string {
+	if IsGuestUserID(id) {
+		return id
+	}
+	return GuestIDPrefix + id
+}
+
+// IsGuestUserID reports whether a user ID belongs to an anonymous guest
+func IsGuestUserID(userID string) bool {
+	return strings.HasPrefix(userID, GuestIDPrefix)
+}
+
 // User represents a user account in the system
 type User struct {
 	ID         uuid.UUID `json:"id"`
@@ -38,6 +58,42 @@ type RoomUserSettings struct {
 	LastActiveAt time.Time `json:"last_active_at"`
 }
 
+// RoomRole is what a member may do in a room
+type RoomRole string
+
+const (
+	RoomRoleOwner  RoomRole = "owner"  // Manages the room, its invites and admins
+	RoomRoleAdmin  RoomRole = "admin"  // Creates and revokes member invites
+	RoomRoleMember RoomRole = "member" // Enters the room
+)
+
+// CanInvite reports whether the role may create and revoke invites
+func (r RoomRole) CanInvite() bool {
+	return r == RoomRoleOwner || r == RoomRoleAdmin
+}
+
+// RoomMember is a user's membership of a room, which lets them into it while it is private
+type RoomMember struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Role      RoomRole  `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomInvite is an invite link to a room
+// The link carries a signed token naming the invite; the row tracks its uses and revocation.
+type RoomInvite struct {
+	ID        uuid.UUID  `json:"id"`
+	RoomID    uuid.UUID  `json:"room_id"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	Role      RoomRole   `json:"role"`               // Granted to whoever redeems it
+	MaxUses   *int       `json:"max_uses,omitempty"` // Unlimited if nil
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // CreateUserParams contains parameters for creating a new user
 type CreateUserParams struct {
 	Email    string
@@ -53,6 +109,15 @@ type CreateRoomParams struct {
 	IsPublic    bool
 }
 
+// CreateRoomInviteParams contains parameters for creating a room invite
+type CreateRoomInviteParams struct {
+	RoomID    uuid.UUID
+	CreatedBy uuid.UUID
+	Role      RoomRole
+	MaxUses   *int
+	ExpiresAt time.Time
+}
+
 // UpdateRoomUserSettingsParams contains parameters for updating room user settings
 type UpdateRoomUserSettingsParams struct {
 	RoomID      uuid.UUID
@@ -60,3 +125,41 @@ type UpdateRoomUserSettingsParams struct {
 	DisplayName *string
 	Color       *string
 }
+
+// ChatMessage represents a committed canvas message in a room's history
+type ChatMessage struct {
+	ID        string    `json:"id"`
+	Seq       int64     `json:"seq"`
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	Username  *string   `json:"username,omitempty"`
+	Color     *string   `json:"color,omitempty"`
+	Payload   string    `json:"payload"`
+	Position  Position  `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BoundingBox is an axis-aligned rectangle on the canvas
+type BoundingBox struct {
+	MinX float64
+	MinY float64
+	MaxX float64
+	MaxY float64
+}
+
+// Contains reports whether a position lies inside the box (edges included)
+func (b BoundingBox) Contains(p Position) bool {
+	return p.X >= b.MinX && p.X <= b.MaxX && p.Y >= b.MinY && p.Y <= b.MaxY
+}
+
+// CanvasBounds is the area of every room's canvas
+var CanvasBounds = BoundingBox{MinX: 0, MinY: 0, MaxX: 5000, MaxY: 5000}
+
+// ListMessagesParams contains parameters for paging through a room's message history
+type ListMessagesParams struct {
+	RoomID uuid.UUID
+	Before *int64 // Only messages with a lower seq (cursor from the previous page)
+	Limit  int
+	Bounds *BoundingBox // Only messages positioned inside this box
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// PresenceStatus describes how recently a user did something in a channel
+type PresenceStatus string
+
+const (
+	PresenceActive PresenceStatus = "active"
+	PresenceIdle   PresenceStatus = "idle"
+	PresenceAway   PresenceStatus = "away"
+)
+
+const (
+	// PresenceIdleAfter is how long without activity before a user shows as idle
+	PresenceIdleAfter = time.Minute
+	// PresenceAwayAfter is how long without activity before a user shows as away
+	PresenceAwayAfter = 5 * time.Minute
+)
+
+// PresenceSession is one connection (e.g. a browser tab) of a user to a channel
+type PresenceSession struct {
+	SessionID    string  `json:"session_id"`
+	UserID       string  `json:"user_id"`
+	Username     *string `json:"username,omitempty"`
+	Color        *string `json:"color,omitempty"`
+	ConnectedAt  int64   `json:"connected_at"`   // Unix milliseconds
+	LastActiveAt int64   `json:"last_active_at"` // Unix milliseconds of the last message the session sent
+}
+
+// PresenceDeparture is a user whose last session in a channel lapsed without a disconnect,
+// e.g. because the node serving them crashed
+type PresenceDeparture struct {
+	ChannelID string
+	UserID    string
+}
+
+// ResumeState is a disconnected session held for a grace window so its client can resume it
+type ResumeState struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	Position  int64  `json:"position"` // The channel's sequence number when the session disconnected
+}
+
+// PresenceStatusAt returns the status of a user last active at lastActiveAt (Unix ms)
+func PresenceStatusAt(lastActiveAt int64, now time.Time) PresenceStatus {
+	inactive := now.Sub(time.UnixMilli(lastActiveAt))
+	switch {
+	case inactive < PresenceIdleAfter:
+		return PresenceActive
+	case inactive < PresenceAwayAfter:
+		return PresenceIdle
+	default:
+		return PresenceAway
+	}
+}
+
+// AggregatePresence folds sessions into one entry per user, ordered by first connection then user ID
+// A user's name, color and status come from their most recently active session.
+func AggregatePresence(sessions []PresenceSession, now time.Time) []UserInfo {
+	latest := make(map[string]PresenceSession)
+	connected := make(map[string]int64)
+	counts := make(map[string]int)
+	var order []string
+
+	for _, s := range sessions {
+		if _, seen := latest[s.UserID]; !seen {
+			order = append(order, s.UserID)
+			latest[s.UserID] = s
+			connected[s.UserID] = s.ConnectedAt
+		} else if s.LastActiveAt > latest[s.UserID].LastActiveAt {
+			latest[s.UserID] = s
+		}
+		if s.ConnectedAt < connected[s.UserID] {
+			connected[s.UserID] = s.ConnectedAt
+		}
+		counts[s.UserID]++
+	}
+
+	users := make([]UserInfo, 0, len(order))
+	for _, userID := range order {
+		s := latest[userID]
+		users = append(users, UserInfo{
+			UserID:       userID,
+			Username:     s.Username,
+			Color:        s.Color,
+			Status:       PresenceStatusAt(s.LastActiveAt, now),
+			LastActiveAt: s.LastActiveAt,
+			Sessions:     counts[userID],
+		})
+	}
+
+	// Stable order so clients don't reshuffle their user lists on every sync
+	sort.Slice(users, func(i, j int) bool {
+		a, b := connected[users[i].UserID], connected[users[j].UserID]
+		if a != b {
+			return a < b
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceStatusAt(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		inactive time.Duration
+		want     PresenceStatus
+	}{
+		{name: "just now", inactive: 0, want: PresenceActive},
+		{name: "under a minute", inactive: 59 * time.Second, want: PresenceActive},
+		{name: "idle", inactive: PresenceIdleAfter, want: PresenceIdle},
+		{name: "away", inactive: PresenceAwayAfter, want: PresenceAway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PresenceStatusAt(now.Add(-tt.inactive).UnixMilli(), now); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAggregatePresence(t *testing.T) {
+	now := time.Now()
+	ms := func(ago time.Duration) int64 { return now.Add(-ago).UnixMilli() }
+	oldName, newName := "Old", "New"
+
+	sessions := []PresenceSession{
+		{SessionID: "b-1", UserID: "user-b", ConnectedAt: ms(time.Minute), LastActiveAt: ms(time.Minute)},
+		{SessionID: "a-1", UserID: "user-a", Username: &oldName, ConnectedAt: ms(10 * time.Minute), LastActiveAt: ms(10 * time.Minute)},
+		{SessionID: "a-2", UserID: "user-a", Username: &newName, ConnectedAt: ms(2 * time.Minute), LastActiveAt: ms(time.Second)},
+	}
+
+	users := AggregatePresence(sessions, now)
+	if len(users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(users))
+	}
+
+	// user-a connected first, so comes first even though their newest tab is recent
+	a := users[0]
+	if a.UserID != "user-a" || a.Sessions != 2 {
+		t.Fatalf("Expected user-a with 2 sessions first, got %+v", a)
+	}
+	if a.Username == nil || *a.Username != "New" {
+		t.Errorf("Expected details from most recently active session, got %v", a.Username)
+	}
+	if a.Status != PresenceActive || a.LastActiveAt != ms(time.Second) {
+		t.Errorf("Expected user-a active, got %s at %d", a.Status, a.LastActiveAt)
+	}
+
+	if users[1].UserID != "user-b" || users[1].Status != PresenceIdle {
+		t.Errorf("Expected idle user-b second, got %+v", users[1])
+	}
+}
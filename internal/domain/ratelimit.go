@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// RateLimit is a token bucket's shape: it holds up to Burst tokens and refills at Rate per second
+// A zero Rate means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// TokenBucket is one named bucket to draw from, e.g. a user's chat budget
+type TokenBucket struct {
+	Key   string
+	Limit RateLimit
+}
+
+// WindowLimit allows up to Limit requests within any Window
+// A zero Limit means unlimited.
+type WindowLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// SlidingWindow is one named window to count a request in, e.g. an IP's username checks
+type SlidingWindow struct {
+	Key   string
+	Limit WindowLimit
+}
+
+// WindowUsage is where a request left the most constrained of the windows it was counted in
+// Reset is how long until that window has room for another request.
+type WindowUsage struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
@@ -0,0 +1,233 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxPayloadRunes is the longest chat message, matching the client's input limit
+	MaxPayloadRunes = 60
+	// MaxUsernameRunes is the longest display name
+	MaxUsernameRunes = 32
+)
+
+var (
+	// messageIDPattern matches client-chosen message IDs, e.g. UUIDs
+	messageIDPattern = regexp.MustCompile(`^[A-Za-z0-9_:-]{1,64}$`)
+	// colorPattern matches #rrggbb colors
+	colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// ValidPosition reports whether a position is finite and on the canvas
+func ValidPosition(p Position) bool {
+	for _, f := range []float64{p.X, p.Y} {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return CanvasBounds.Contains(p)
+}
+
+// ValidColor reports whether a color is a #rrggbb hex color
+func ValidColor(color string) bool {
+	return colorPattern.MatchString(color)
+}
+
+// ValidUsername reports whether a display name has an acceptable length and characters
+// Names are letters, digits and marks in any script, spaces and _ - . ', with no
+// space at either end.
+func ValidUsername(username string) bool {
+	if username == "" || username != strings.TrimSpace(username) {
+		return false
+	}
+	if !utf8.ValidString(username) || utf8.RuneCountInString(username) > MaxUsernameRunes {
+		return false
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !strings.ContainsRune(" _-.'", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validPayload reports whether a chat payload is printable text of at most MaxPayloadRunes
+// An empty payload is valid: it deletes the message.
+func validPayload(payload string) bool {
+	return validText(payload, MaxPayloadRunes, false)
+}
+
+// SanitizeInbound validates a frame a client sent and returns a copy with only the fields its type uses
+// Frames claiming to come from the system or carrying fields only the server sets fail with
+// ErrForbiddenField; frames of other types than clients send, or with missing or invalid
+// fields, with ErrInvalidMessage. Everything else a client could sneak in, like a chat
+// message's username, a timestamp or a sequence number, is left out of the copy for the server to fill in.
+func SanitizeInbound(msg *Message) (*Message, error) {
+	if msg.UserID == SystemUserID {
+		return nil, fmt.Errorf("%w: user_id %q", ErrForbiddenField, SystemUserID)
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"users", len(msg.Users) > 0},
+		{"messages", len(msg.Messages) > 0},
+		{"stream_id", msg.StreamID != ""},
+		{"resume_token", msg.ResumeToken != ""},
+		{"code", msg.Code != ""},
+		{"reason", msg.Reason != ""},
+		{"retry_after_ms", msg.RetryAfterMs != 0},
+	} {
+		if f.set {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenField, f.name)
+		}
+	}
+
+	clean := &Message{
+		Type:      msg.Type,
+		ChannelID: msg.ChannelID,
+		UserID:    msg.UserID,
+		RequestID: msg.RequestID,
+	}
+
+	switch msg.Type {
+	case MessageTypeChat:
+		if msg.MessageID == nil || !messageIDPattern.MatchString(*msg.MessageID) {
+			return nil, fmt.Errorf("%w: message_id must be 1 to 64 letters, digits, _, - or :", ErrInvalidMessage)
+		}
+		if msg.Payload == nil || !validPayload(*msg.Payload) {
+			return nil, fmt.Errorf("%w: payload must be printable text of at most %d characters", ErrInvalidMessage, MaxPayloadRunes)
+		}
+		if msg.Position == nil || !ValidPosition(*msg.Position) {
+			return nil, fmt.Errorf("%w: position must be on the canvas", ErrInvalidMessage)
+		}
+		clean.MessageID, clean.Payload, clean.Position, clean.Final = msg.MessageID, msg.Payload, msg.Position, msg.Final
+
+	case MessageTypeCursorMoved:
+		if msg.Position == nil || !ValidPosition(*msg.Position) {
+			return nil, fmt.Errorf("%w: cursor position must be on the canvas", ErrInvalidMessage)
+		}
+		clean.Position = msg.Position
+
+	case MessageTypeViewportUpdate:
+		if msg.Viewport == nil || !msg.Viewport.Valid() {
+			return nil, fmt.Errorf("%w: viewport must be a finite rectangle with a positive zoom", ErrInvalidMessage)
+		}
+		clean.Viewport = msg.Viewport
+
+	case MessageTypeUsernameChanged:
+		if msg.Username == nil || !ValidUsername(*msg.Username) {
+			return nil, fmt.Errorf("%w: username must be 1 to %d letters, digits, spaces, _, -, . or '", ErrInvalidMessage, MaxUsernameRunes)
+		}
+		clean.Username = msg.Username
+
+	case MessageTypeColorChanged:
+		if msg.Color == nil || !ValidColor(*msg.Color) {
+			return nil, fmt.Errorf("%w: color must be a hex color like #3b82f6", ErrInvalidMessage)
+		}
+		color := strings.ToLower(*msg.Color)
+		clean.Color = &color
+
+	case MessageTypeReplay:
+		if msg.Since == "" {
+			return nil, fmt.Errorf("%w: replay requires since", ErrInvalidMessage)
+		}
+		clean.Since = msg.Since
+
+	case MessageTypeBackfill:
+		if msg.SinceSeq < 0 {
+			return nil, fmt.Errorf("%w: since_seq must not be negative", ErrInvalidMessage)
+		}
+		clean.SinceSeq = msg.SinceSeq
+
+	default:
+		return nil, fmt.Errorf("%w: clients may not send %q messages", ErrInvalidMessage, msg.Type)
+	}
+
+	return clean, nil
+}
+
+const (
+	// MinRoomSlugLength and MaxRoomSlugLength bound a room's slug
+	MinRoomSlugLength = 3
+	MaxRoomSlugLength = 48
+	// MaxRoomNameRunes is the longest room name
+	MaxRoomNameRunes = 64
+	// MaxRoomDescriptionRunes is the longest room description
+	MaxRoomDescriptionRunes = 500
+)
+
+// roomSlugPattern matches lowercase words joined by single hyphens
+var roomSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// reservedRoomSlugs would be shadowed by other /api/rooms routes
+var reservedRoomSlugs = map[string]bool{
+	"public": true,
+	"mine":   true,
+}
+
+// ValidRoomSlug reports whether a slug can name a room in URLs
+// Slugs are 3 to 48 lowercase letters and digits in words joined by single hyphens,
+// and not one the API routes already use.
+func ValidRoomSlug(slug string) bool {
+	return len(slug) >= MinRoomSlugLength && len(slug) <= MaxRoomSlugLength &&
+		roomSlugPattern.MatchString(slug) && !reservedRoomSlugs[slug]
+}
+
+// RoomSlugFromName derives a slug from a room name, e.g. "Late Night Chat!" -> "late-night-chat"
+// Characters other than ASCII letters and digits become hyphens. The result may still be
+// too short or reserved, so check it with ValidRoomSlug.
+func RoomSlugFromName(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > MaxRoomSlugLength {
+		slug = strings.TrimRight(slug[:MaxRoomSlugLength], "-")
+	}
+	return slug
+}
+
+// ValidRoomName reports whether a room name is 1 to MaxRoomNameRunes printable characters
+// with no space at either end
+func ValidRoomName(name string) bool {
+	if name == "" || name != strings.TrimSpace(name) {
+		return false
+	}
+	return validText(name, MaxRoomNameRunes, false)
+}
+
+// ValidRoomDescription reports whether a room description is at most MaxRoomDescriptionRunes
+// printable characters; it may span lines
+func ValidRoomDescription(description string) bool {
+	return validText(description, MaxRoomDescriptionRunes, true)
+}
+
+// validText reports whether text is UTF-8 of at most maxRunes without control characters
+func validText(text string, maxRunes int, newlines bool) bool {
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxRunes {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && !(newlines && r == '\n') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestSanitizeInbound(t *testing.T) {
+	chat := func(payload string, position Position) *Message {
+		return NewMessage("msg-1", "room", "user-1", payload, position)
+	}
+
+	tests := []struct {
+		name    string
+		msg     *Message
+		wantErr error
+	}{
+		{"chat", chat("hello", Position{X: 10, Y: 20}), nil},
+		{"deleted chat", chat("", Position{X: 10, Y: 20}), nil},
+		{"longest payload in runes", chat(strings.Repeat("é", MaxPayloadRunes), Position{}), nil},
+		{"payload too long", chat(strings.Repeat("x", MaxPayloadRunes+1), Position{}), ErrInvalidMessage},
+		{"payload with control characters", chat("hi\x00", Position{}), ErrInvalidMessage},
+		{"payload not UTF-8", chat("\xff", Position{}), ErrInvalidMessage},
+		{"chat without payload", &Message{Type: MessageTypeChat, MessageID: strPtr("msg-1"), UserID: "user-1", Position: &Position{}}, ErrInvalidMessage},
+		{"chat without message ID", &Message{Type: MessageTypeChat, UserID: "user-1", Payload: strPtr("hi"), Position: &Position{}}, ErrInvalidMessage},
+		{"odd message ID", &Message{Type: MessageTypeChat, MessageID: strPtr("<script>"), UserID: "user-1", Payload: strPtr("hi"), Position: &Position{}}, ErrInvalidMessage},
+		{"chat off the canvas", chat("hi", Position{X: -1, Y: 0}), ErrInvalidMessage},
+		{"chat at NaN", chat("hi", Position{X: math.NaN(), Y: 0}), ErrInvalidMessage},
+		{"cursor at infinity", NewCursorMovedMessage("room", "user-1", Position{X: math.Inf(1), Y: 0}), ErrInvalidMessage},
+		{"cursor", NewCursorMovedMessage("room", "user-1", Position{X: 5000, Y: 5000}), nil},
+		{"viewport", &Message{Type: MessageTypeViewportUpdate, UserID: "user-1", Viewport: &Viewport{Width: 800, Height: 600, Zoom: 1}}, nil},
+		{"viewport without zoom", &Message{Type: MessageTypeViewportUpdate, UserID: "user-1", Viewport: &Viewport{Width: 800, Height: 600}}, ErrInvalidMessage},
+		{"username", NewUsernameChangedMessage("room", "user-1", strPtr("Zoë O'Neil-Smith")), nil},
+		{"empty username", NewUsernameChangedMessage("room", "user-1", strPtr("")), ErrInvalidMessage},
+		{"padded username", NewUsernameChangedMessage("room", "user-1", strPtr(" bob")), ErrInvalidMessage},
+		{"username with markup", NewUsernameChangedMessage("room", "user-1", strPtr("<b>bob</b>")), ErrInvalidMessage},
+		{"username too long", NewUsernameChangedMessage("room", "user-1", strPtr(strings.Repeat("b", MaxUsernameRunes+1))), ErrInvalidMessage},
+		{"color", NewColorChangedMessage("room", "user-1", strPtr("#3B82F6")), nil},
+		{"color name", NewColorChangedMessage("room", "user-1", strPtr("red")), ErrInvalidMessage},
+		{"color with CSS", NewColorChangedMessage("room", "user-1", strPtr("#fff; background: url(x)")), ErrInvalidMessage},
+		{"replay", &Message{Type: MessageTypeReplay, UserID: "user-1", Since: "0-0"}, nil},
+		{"replay without since", &Message{Type: MessageTypeReplay, UserID: "user-1"}, ErrInvalidMessage},
+		{"backfill", &Message{Type: MessageTypeBackfill, UserID: "user-1", SinceSeq: 3}, nil},
+		{"backfill before the start", &Message{Type: MessageTypeBackfill, UserID: "user-1", SinceSeq: -1}, ErrInvalidMessage},
+		{"server message type", NewUserJoinedMessage("room", "user-1", nil, nil), ErrInvalidMessage},
+		{"room deleted", &Message{Type: MessageTypeRoomDeleted, UserID: "user-1"}, ErrInvalidMessage},
+		{"room restricted", &Message{Type: MessageTypeRoomRestricted, UserID: "user-1"}, ErrInvalidMessage},
+		{"unknown type", &Message{Type: "shout", UserID: "user-1"}, ErrInvalidMessage},
+		{"system user", &Message{Type: MessageTypeCursorMoved, UserID: SystemUserID, Position: &Position{}}, ErrForbiddenField},
+		{"users list", &Message{Type: MessageTypeCursorMoved, UserID: "user-1", Position: &Position{}, Users: []UserInfo{{UserID: "user-2"}}}, ErrForbiddenField},
+		{"resume token", &Message{Type: MessageTypeCursorMoved, UserID: "user-1", Position: &Position{}, ResumeToken: "stolen"}, ErrForbiddenField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SanitizeInbound(tt.msg)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("SanitizeInbound() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSanitizeInbound_DropsUnusedFields(t *testing.T) {
+	msg := NewMessage("msg-1", "room", "user-1", "hi", Position{X: 1, Y: 2})
+	msg.Username, msg.Color, msg.Viewport = strPtr("Mallory"), strPtr("#000000"), &Viewport{Zoom: 1}
+	msg.Seq, msg.RequestID, msg.Final = 99, "req-1", true
+
+	clean, err := SanitizeInbound(msg)
+	if err != nil {
+		t.Fatalf("SanitizeInbound() error = %v", err)
+	}
+	if clean.Username != nil || clean.Color != nil || clean.Viewport != nil || clean.Seq != 0 || clean.Timestamp != 0 {
+		t.Errorf("Expected server-filled and unused fields to be dropped, got %+v", clean)
+	}
+	if *clean.MessageID != "msg-1" || *clean.Payload != "hi" || *clean.Position != (Position{X: 1, Y: 2}) || !clean.Final || clean.RequestID != "req-1" {
+		t.Errorf("Expected the chat fields to be kept, got %+v", clean)
+	}
+
+	// Colors are stored in one case
+	color, _ := SanitizeInbound(NewColorChangedMessage("room", "user-1", strPtr("#3B82F6")))
+	if *color.Color != "#3b82f6" {
+		t.Errorf("Expected a lowercase color, got %s", *color.Color)
+	}
+}
+
+func TestValidRoomSlug(t *testing.T) {
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{"general", true},
+		{"late-night-chat", true},
+		{"room-2", true},
+		{"abc", true},
+		{strings.Repeat("a", MaxRoomSlugLength), true},
+		{"ab", false},
+		{strings.Repeat("a", MaxRoomSlugLength+1), false},
+		{"General", false},
+		{"late--night", false},
+		{"-general", false},
+		{"general-", false},
+		{"late_night", false},
+		{"café", false},
+		{"public", false},
+		{"mine", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRoomSlug(tt.slug); got != tt.want {
+			t.Errorf("ValidRoomSlug(%q) = %v, want %v", tt.slug, got, tt.want)
+		}
+	}
+}
+
+func TestRoomSlugFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"General", "general"},
+		{"Late Night Chat!", "late-night-chat"},
+		{"  --Rust & Go--  ", "rust-go"},
+		{"Café 2", "caf-2"},
+		{"日本語", ""},
+		{strings.Repeat("ab ", 30), strings.TrimRight(strings.Repeat("ab-", 16), "-")},
+	}
+	for _, tt := range tests {
+		got := RoomSlugFromName(tt.name)
+		if got != tt.want {
+			t.Errorf("RoomSlugFromName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" && len(got) >= MinRoomSlugLength && !ValidRoomSlug(got) {
+			t.Errorf("RoomSlugFromName(%q) = %q, which is not a valid slug", tt.name, got)
+		}
+	}
+}
+
+func TestValidRoomNameAndDescription(t *testing.T) {
+	if !ValidRoomName("Late Night Chat") || !ValidRoomName(strings.Repeat("é", MaxRoomNameRunes)) {
+		t.Error("Expected ordinary room names to be valid")
+	}
+	for _, name := range []string{"", " padded", "two\nlines", strings.Repeat("x", MaxRoomNameRunes+1)} {
+		if ValidRoomName(name) {
+			t.Errorf("Expected room name %q to be invalid", name)
+		}
+	}
+
+	if !ValidRoomDescription("") || !ValidRoomDescription("Rules:\n1. Be nice") {
+		t.Error("Expected empty and multi-line descriptions to be valid")
+	}
+	if ValidRoomDescription("bell\a") || ValidRoomDescription(strings.Repeat("x", MaxRoomDescriptionRunes+1)) {
+		t.Error("Expected descriptions with control characters or over the limit to be invalid")
+	}
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"asocial/internal/auth"
+	"asocial/internal/domain"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -12,15 +14,17 @@ import (
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	firebaseService *auth.FirebaseService
+	guestTokens     *auth.GuestTokenService
 	logger          *slog.Logger
 	appURL          string
 	isDev           bool
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(firebaseService *auth.FirebaseService, logger *slog.Logger, appURL string, isDev bool) *AuthHandler {
+func NewAuthHandler(firebaseService *auth.FirebaseService, guestTokens *auth.GuestTokenService, logger *slog.Logger, appURL string, isDev bool) *AuthHandler {
 	return &AuthHandler{
 		firebaseService: firebaseService,
+		guestTokens:     guestTokens,
 		logger:          logger,
 		appURL:          appURL,
 		isDev:           isDev,
@@ -235,3 +239,36 @@ func (h *AuthHandler) HandleDeleteAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 }
 
+// HandleGuestToken issues a signed guest token for anonymous users
+// If the request carries a still-valid guest token, the new token keeps the same guest ID
+func (h *AuthHandler) HandleGuestToken(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	// Request body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	guestID := ""
+	if req.Token != "" {
+		claims, err := h.guestTokens.Verify(req.Token)
+		if err != nil {
+			h.logger.Debug("not renewing guest token", "error", err)
+		} else {
+			guestID = claims.GuestID
+		}
+	}
+
+	token, claims, err := h.guestTokens.Issue(guestID)
+	if err != nil {
+		h.logger.Error("failed to issue guest token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue guest token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"user_id":    domain.GuestUserID(claims.GuestID),
+		"expires_at": time.Unix(claims.ExpiresAt, 0).UTC(),
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,8 +17,9 @@ type HealthChecker interface {
 
 // HealthHandler handles health check endpoints
 type HealthHandler struct {
-	checker HealthChecker
-	logger  *slog.Logger
+	checker  HealthChecker
+	logger   *slog.Logger
+	draining atomic.Bool
 }
 
 // NewHealthHandler creates a new health handler
@@ -37,9 +39,21 @@ func (h *HealthHandler) HandleLiveness(c *gin.Context) {
 	})
 }
 
+// StartDraining makes the readiness probe fail so load balancers stop routing to this node
+func (h *HealthHandler) StartDraining() {
+	h.draining.Store(true)
+}
+
 // HandleReadiness handles readiness probe endpoint
-// Returns 200 OK if the application is ready to accept traffic (Redis is healthy)
+// Returns 200 OK if the application is ready to accept traffic (Redis is healthy and not shutting down)
 func (h *HealthHandler) HandleReadiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "draining",
+		})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
 	defer cancel()
 
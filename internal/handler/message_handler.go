@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 200
+)
+
+// MessageHandler handles message history HTTP requests
+type MessageHandler struct {
+	roomRepo    *repository.RoomRepository
+	messageRepo *repository.MessageRepository
+	members     RoomMemberLookup
+	logger      *slog.Logger
+}
+
+// NewMessageHandler creates a new message handler
+func NewMessageHandler(
+	roomRepo *repository.RoomRepository,
+	messageRepo *repository.MessageRepository,
+	members RoomMemberLookup,
+	logger *slog.Logger,
+) *MessageHandler {
+	return &MessageHandler{
+		roomRepo:    roomRepo,
+		messageRepo: messageRepo,
+		members:     members,
+		logger:      logger,
+	}
+}
+
+// HandleListMessages returns a page of a room's committed messages, newest first
+// Query parameters:
+//   - cursor: next_cursor from the previous page
+//   - limit: page size (default 50, max 200)
+//   - min_x, min_y, max_x, max_y: only messages positioned inside this box (all four or none)
+func (h *MessageHandler) HandleListMessages(c *gin.Context) {
+	roomSlug := c.Param("slug")
+	if roomSlug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room slug is required"})
+		return
+	}
+
+	params, err := parseListMessagesQuery(c)
+	if err != nil {
+		reason := "Invalid query"
+		var queryErr *invalidQueryError
+		if errors.As(err, &queryErr) {
+			reason = "Invalid " + queryErr.param
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	room, err := h.roomRepo.GetBySlug(c.Request.Context(), roomSlug)
+	if err != nil {
+		h.logger.Error("failed to get room", "error", err, "slug", roomSlug)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room"})
+		return
+	}
+
+	if room == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if !authorizeRoomRead(c, h.members, room) {
+		return
+	}
+
+	params.RoomID = room.ID
+	messages, err := h.messageRepo.ListByRoom(c.Request.Context(), params)
+	if err != nil {
+		h.logger.Error("failed to list messages", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list messages"})
+		return
+	}
+
+	if messages == nil {
+		messages = []*domain.ChatMessage{}
+	}
+
+	// A full page means there may be more; the cursor is the oldest seq returned
+	var nextCursor *string
+	if len(messages) == params.Limit {
+		cursor := strconv.FormatInt(messages[len(messages)-1].Seq, 10)
+		nextCursor = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":    messages,
+		"count":       len(messages),
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseListMessagesQuery parses pagination and bounding box query parameters
+func parseListMessagesQuery(c *gin.Context) (domain.ListMessagesParams, error) {
+	params := domain.ListMessagesParams{Limit: defaultMessagePageSize}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		before, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return params, errInvalidQuery("cursor")
+		}
+		params.Before = &before
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return params, errInvalidQuery("limit")
+		}
+		params.Limit = min(n, maxMessagePageSize)
+	}
+
+	keys := []string{"min_x", "min_y", "max_x", "max_y"}
+	values := make([]float64, 0, len(keys))
+	for _, key := range keys {
+		raw := c.Query(key)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return params, errInvalidQuery(key)
+		}
+		values = append(values, v)
+	}
+
+	switch len(values) {
+	case 0:
+	case len(keys):
+		bounds := domain.BoundingBox{MinX: values[0], MinY: values[1], MaxX: values[2], MaxY: values[3]}
+		if bounds.MinX > bounds.MaxX || bounds.MinY > bounds.MaxY {
+			return params, errInvalidQuery("bounding box")
+		}
+		params.Bounds = &bounds
+	default:
+		return params, errInvalidQuery("bounding box (min_x, min_y, max_x and max_y are all required)")
+	}
+
+	return params, nil
+}
+
+// invalidQueryError reports a malformed query parameter
+type invalidQueryError struct {
+	param string // Named in the client-facing error
+}
+
+func (e *invalidQueryError) Error() string {
+	return "invalid " + e.param
+}
+
+// errInvalidQuery builds the error for a malformed query parameter
+func errInvalidQuery(name string) error {
+	return &invalidQueryError{param: name}
+}
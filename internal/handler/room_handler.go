@@ -1,19 +1,43 @@
 package handler
 
 import (
+	"asocial/internal/auth"
+	"asocial/internal/domain"
 	"asocial/internal/repository"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// RoomSessionCloser disconnects a room's live sessions on every node
+type RoomSessionCloser interface {
+	CloseRoom(ctx context.Context, channelID string) error
+	// RestrictRoom disconnects the sessions of everyone but memberIDs
+	RestrictRoom(ctx context.Context, channelID string, memberIDs []string) error
+}
+
+// RoomMemberLookup resolves a user's membership of a room
+type RoomMemberLookup interface {
+	Get(ctx context.Context, roomID, userID uuid.UUID) (*domain.RoomMember, error)
+}
+
 // RoomHandler handles room-related HTTP requests
 type RoomHandler struct {
 	roomRepo     *repository.RoomRepository
 	settingsRepo *repository.RoomUserSettingsRepository
 	userRepo     *repository.UserRepository
+	memberRepo   *repository.RoomMemberRepository
+	inviteRepo   *repository.RoomInviteRepository
+	inviteTokens *auth.InviteTokenService
+	sessions     RoomSessionCloser
 	logger       *slog.Logger
 }
 
@@ -22,12 +46,20 @@ func NewRoomHandler(
 	roomRepo *repository.RoomRepository,
 	settingsRepo *repository.RoomUserSettingsRepository,
 	userRepo *repository.UserRepository,
+	memberRepo *repository.RoomMemberRepository,
+	inviteRepo *repository.RoomInviteRepository,
+	inviteTokens *auth.InviteTokenService,
+	sessions RoomSessionCloser,
 	logger *slog.Logger,
 ) *RoomHandler {
 	return &RoomHandler{
 		roomRepo:     roomRepo,
 		settingsRepo: settingsRepo,
 		userRepo:     userRepo,
+		memberRepo:   memberRepo,
+		inviteRepo:   inviteRepo,
+		inviteTokens: inviteTokens,
+		sessions:     sessions,
 		logger:       logger,
 	}
 }
@@ -89,10 +121,20 @@ func (h *RoomHandler) HandleJoinRoom(c *gin.Context) {
 		return
 	}
 
-	// Check if user has access to this room
-	if !room.IsPublic {
-		// For private rooms, check if user is the owner
-		if room.OwnerID == nil || *room.OwnerID != userID {
+	// An invite makes the user a member; otherwise private rooms are for members only
+	var invite *auth.InviteClaims
+	if token := c.Query("invite"); token != "" {
+		if invite, ok = h.verifyInvite(c, room, token); !ok {
+			return
+		}
+	} else {
+		allowed, err := canAccessRoom(c.Request.Context(), h.memberRepo, room, userID)
+		if err != nil {
+			h.logger.Error("failed to check room access", "error", err, "room_id", room.ID, "user_id", userID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !allowed {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this room"})
 			return
 		}
@@ -105,6 +147,19 @@ func (h *RoomHandler) HandleJoinRoom(c *gin.Context) {
 		req = JoinRoomRequest{}
 	}
 
+	// Names and colors follow the same rules as in the chat itself
+	if req.DisplayName != nil && *req.DisplayName != "" && !domain.ValidUsername(*req.DisplayName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Display name must be 1 to %d letters, digits, spaces or _ - . '", domain.MaxUsernameRunes),
+			"field": "display_name",
+		})
+		return
+	}
+	if req.Color != nil && *req.Color != "" && !domain.ValidColor(*req.Color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be a #rrggbb hex color", "field": "color"})
+		return
+	}
+
 	// Get user's global username as default display name
 	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
 	if err != nil {
@@ -124,9 +179,9 @@ func (h *RoomHandler) HandleJoinRoom(c *gin.Context) {
 		displayName = *req.DisplayName
 	}
 
-	color := "#ef4444" // default color
+	color := domain.DefaultUserColor
 	if req.Color != nil && *req.Color != "" {
-		color = *req.Color
+		color = strings.ToLower(*req.Color)
 	}
 
 	// Check if display name is taken in this room
@@ -146,6 +201,11 @@ func (h *RoomHandler) HandleJoinRoom(c *gin.Context) {
 		return
 	}
 
+	// Redeemed only once nothing else can fail the join, so a refused join keeps its use
+	if invite != nil && !h.redeemInvite(c, room, userID, invite) {
+		return
+	}
+
 	// Create or update room user settings
 	settings, err := h.settingsRepo.Upsert(c.Request.Context(), room.ID, userID, displayName, color)
 	if err != nil {
@@ -195,33 +255,70 @@ func (h *RoomHandler) HandleGetRoom(c *gin.Context) {
 	}
 
 	// For private rooms, check if user has access
-	if !room.IsPublic {
-		userIDStr, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
-		}
+	if !authorizeRoomRead(c, h.memberRepo, room) {
+		return
+	}
 
-		userID, ok := userIDStr.(uuid.UUID)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
-			return
-		}
+	c.JSON(http.StatusOK, roomJSON(room))
+}
 
-		if room.OwnerID == nil || *room.OwnerID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this room"})
-			return
-		}
+// canAccessRoom reports whether an authenticated user may enter a room
+// Public rooms are open to everyone; private rooms only to their owner and members
+func canAccessRoom(ctx context.Context, members RoomMemberLookup, room *domain.Room, userID uuid.UUID) (bool, error) {
+	if room.IsPublic || isRoomOwner(room, userID) {
+		return true, nil
+	}
+	if members == nil {
+		return false, nil
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":          room.ID,
-		"name":        room.Name,
-		"slug":        room.Slug,
-		"description": room.Description,
-		"is_public":   room.IsPublic,
-		"created_at":  room.CreatedAt,
-	})
+	member, err := members.Get(ctx, room.ID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	return member != nil, nil
+}
+
+// authorizeRoomRead checks that the (optionally authenticated) caller may read a room
+// On failure it writes the error response and returns false
+func authorizeRoomRead(c *gin.Context, members RoomMemberLookup, room *domain.Room) bool {
+	if room.IsPublic {
+		return true
+	}
+
+	userIDStr, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return false
+	}
+
+	userID, ok := userIDStr.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return false
+	}
+
+	allowed, err := canAccessRoom(c.Request.Context(), members, room, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this room"})
+		return false
+	}
+
+	return true
+}
+
+// authenticatedUserID returns the user ID set by the auth middleware, if any
+func authenticatedUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	userID, ok := userIDVal.(uuid.UUID)
+	return userID, ok
 }
 
 // HandleListPublicRooms lists all public rooms
@@ -240,14 +337,426 @@ func (h *RoomHandler) HandleListPublicRooms(c *gin.Context) {
 	// Convert to response format
 	roomList := make([]gin.H, 0, len(rooms))
 	for _, room := range rooms {
-		roomList = append(roomList, gin.H{
-			"id":          room.ID,
-			"name":        room.Name,
-			"slug":        room.Slug,
-			"description": room.Description,
-			"is_public":   room.IsPublic,
-			"created_at":  room.CreatedAt,
+		roomList = append(roomList, roomJSON(room))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rooms": roomList,
+		"count": len(roomList),
+	})
+}
+
+// roomJSON is a room as the API returns it
+func roomJSON(room *domain.Room) gin.H {
+	return gin.H{
+		"id":          room.ID,
+		"name":        room.Name,
+		"slug":        room.Slug,
+		"description": room.Description,
+		"is_public":   room.IsPublic,
+		"created_at":  room.CreatedAt,
+	}
+}
+
+// isRoomOwner reports whether a user owns a room; rooms without an owner, like the default room, have none
+func isRoomOwner(room *domain.Room, userID uuid.UUID) bool {
+	return room.OwnerID != nil && *room.OwnerID == userID
+}
+
+// CreateRoomRequest represents the request body for creating a room
+type CreateRoomRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Slug        string  `json:"slug,omitempty"` // Derived from the name if empty
+	Description *string `json:"description,omitempty"`
+	IsPublic    *bool   `json:"is_public,omitempty"` // Public unless false
+}
+
+// HandleCreateRoom creates a room owned by the caller
+// Without a slug one is derived from the name, with a suffix if that one is taken. A slug
+// the caller chose that is taken gets 409 with available alternatives.
+func (h *RoomHandler) HandleCreateRoom(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req CreateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !domain.ValidRoomName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Room name must be 1 to %d characters", domain.MaxRoomNameRunes), "field": "name"})
+		return
+	}
+	if req.Description != nil && !domain.ValidRoomDescription(*req.Description) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Description must be at most %d characters", domain.MaxRoomDescriptionRunes), "field": "description"})
+		return
+	}
+
+	chosen := req.Slug != ""
+	slug := req.Slug
+	if !chosen {
+		slug = domain.RoomSlugFromName(req.Name)
+		if !domain.ValidRoomSlug(slug) {
+			slug = "room"
+		}
+	}
+	if !domain.ValidRoomSlug(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Slug must be %d to %d lowercase letters, digits and single hyphens", domain.MinRoomSlugLength, domain.MaxRoomSlugLength),
+			"field": "slug",
 		})
+		return
+	}
+
+	params := domain.CreateRoomParams{
+		Name:        req.Name,
+		Description: req.Description,
+		OwnerID:     &userID,
+		IsPublic:    req.IsPublic == nil || *req.IsPublic,
+	}
+
+	// Another room may take a free slug before this one does, so derived slugs get a few tries
+	var room *domain.Room
+	for attempt := 0; room == nil; attempt++ {
+		params.Slug = slug
+		if !chosen {
+			free, err := h.availableSlug(c.Request.Context(), slug)
+			if err != nil {
+				h.logger.Error("failed to find available slug", "error", err, "slug", slug)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+				return
+			}
+			params.Slug = free
+		}
+
+		created, err := h.roomRepo.Create(c.Request.Context(), params)
+		if errors.Is(err, domain.ErrRoomSlugTaken) && !chosen && attempt < 2 {
+			continue
+		}
+		if errors.Is(err, domain.ErrRoomSlugTaken) {
+			suggestions, _ := h.slugSuggestions(c.Request.Context(), params.Slug)
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "Room slug is already taken",
+				"field":       "slug",
+				"suggestions": suggestions,
+			})
+			return
+		}
+		if err != nil {
+			h.logger.Error("failed to create room", "error", err, "slug", params.Slug)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+			return
+		}
+		room = created
+	}
+
+	h.logger.Info("room created", "room_id", room.ID, "slug", room.Slug, "owner_id", userID)
+	c.JSON(http.StatusCreated, roomJSON(room))
+}
+
+// availableSlug returns slug if no room has it, otherwise slug with the first free suffix
+func (h *RoomHandler) availableSlug(ctx context.Context, slug string) (string, error) {
+	room, err := h.roomRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return "", fmt.Errorf("failed to check slug: %w", err)
+	}
+	if room == nil {
+		return slug, nil
+	}
+
+	candidates, err := h.slugSuggestions(ctx, slug)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+// slugSuggestions returns up to three free variants of a taken slug
+// Numbered variants come first; a random suffix is always last, so there is at least one.
+func (h *RoomHandler) slugSuggestions(ctx context.Context, slug string) ([]string, error) {
+	var suggestions []string
+	for i := 2; i <= 9 && len(suggestions) < 2; i++ {
+		candidate := withSlugSuffix(slug, fmt.Sprint(i))
+		room, err := h.roomRepo.GetBySlug(ctx, candidate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check slug: %w", err)
+		}
+		if room == nil {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate slug suffix: %w", err)
+	}
+	return append(suggestions, withSlugSuffix(slug, hex.EncodeToString(b))), nil
+}
+
+// withSlugSuffix appends "-suffix" to a slug, shortening it to stay within the maximum length
+func withSlugSuffix(slug, suffix string) string {
+	if keep := domain.MaxRoomSlugLength - len(suffix) - 1; len(slug) > keep {
+		slug = strings.TrimRight(slug[:keep], "-")
+	}
+	return slug + "-" + suffix
+}
+
+// UpdateRoomRequest represents the request body for updating a room; omitted fields stay as they are
+type UpdateRoomRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	IsPublic    *bool   `json:"is_public,omitempty"`
+}
+
+// HandleUpdateRoom changes a room's name, description or visibility; only its owner may
+func (h *RoomHandler) HandleUpdateRoom(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Name == nil && req.Description == nil && req.IsPublic == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if req.Name != nil && !domain.ValidRoomName(*req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Room name must be 1 to %d characters", domain.MaxRoomNameRunes), "field": "name"})
+		return
+	}
+	if req.Description != nil && !domain.ValidRoomDescription(*req.Description) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Description must be at most %d characters", domain.MaxRoomDescriptionRunes), "field": "description"})
+		return
+	}
+
+	room, ok := h.ownedRoom(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.roomRepo.Update(c.Request.Context(), room.ID, req.Name, req.Description, req.IsPublic); err != nil {
+		h.logger.Error("failed to update room", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room"})
+		return
+	}
+
+	updated, err := h.roomRepo.GetByID(c.Request.Context(), room.ID)
+	if err != nil || updated == nil {
+		h.logger.Error("failed to get updated room", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room"})
+		return
+	}
+
+	// Whoever was let in while the room was public and isn't a member has to leave
+	if room.IsPublic && !updated.IsPublic {
+		h.closeNonMembers(c.Request.Context(), updated)
+	}
+
+	h.logger.Info("room updated", "room_id", room.ID, "user_id", userID)
+	c.JSON(http.StatusOK, roomJSON(updated))
+}
+
+// closeNonMembers disconnects everyone but a room's owner and members from it
+// The room has been updated either way, so failures are only logged.
+func (h *RoomHandler) closeNonMembers(ctx context.Context, room *domain.Room) {
+	members, err := h.memberRepo.ListByRoom(ctx, room.ID)
+	if err != nil {
+		h.logger.Error("failed to list room members", "error", err, "room_id", room.ID)
+		return
+	}
+
+	memberIDs := make([]string, 0, len(members)+1)
+	if room.OwnerID != nil {
+		memberIDs = append(memberIDs, room.OwnerID.String())
+	}
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID.String())
+	}
+
+	if err := h.sessions.RestrictRoom(ctx, room.ID.String(), memberIDs); err != nil {
+		h.logger.Error("failed to close non-members' sessions", "error", err, "room_id", room.ID)
+	}
+}
+
+// HandleDeleteRoom deletes a room and disconnects everyone in it; only its owner may
+// Its history and members' settings go with it.
+func (h *RoomHandler) HandleDeleteRoom(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	room, ok := h.ownedRoom(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.roomRepo.Delete(c.Request.Context(), room.ID); err != nil {
+		h.logger.Error("failed to delete room", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete room"})
+		return
+	}
+
+	// The room is gone either way; sessions left behind can't send anywhere new
+	if err := h.sessions.CloseRoom(c.Request.Context(), room.ID.String()); err != nil {
+		h.logger.Error("failed to close deleted room's sessions", "error", err, "room_id", room.ID)
+	}
+
+	h.logger.Info("room deleted", "room_id", room.ID, "slug", room.Slug, "user_id", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// ownedRoom looks up the room in the URL and checks that userID owns it
+// On failure it writes the error response and returns false
+func (h *RoomHandler) ownedRoom(c *gin.Context, userID uuid.UUID) (*domain.Room, bool) {
+	room, ok := h.roomFromPath(c)
+	if !ok {
+		return nil, false
+	}
+	if !isRoomOwner(room, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room's owner can do this"})
+		return nil, false
+	}
+	return room, true
+}
+
+// roomFromPath looks up the room in the URL
+// On failure it writes the error response and returns false
+func (h *RoomHandler) roomFromPath(c *gin.Context) (*domain.Room, bool) {
+	roomSlug := c.Param("slug")
+	room, err := h.roomRepo.GetBySlug(c.Request.Context(), roomSlug)
+	if err != nil {
+		h.logger.Error("failed to get room", "error", err, "slug", roomSlug)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room"})
+		return nil, false
+	}
+	if room == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return nil, false
+	}
+	return room, true
+}
+
+// HandleListMyRooms lists the rooms the caller owns, then those they joined or are a member of
+func (h *RoomHandler) HandleListMyRooms(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	owned, err := h.roomRepo.ListUserRooms(ctx, userID)
+	if err != nil {
+		h.logger.Error("failed to list owned rooms", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list rooms"})
+		return
+	}
+
+	joined, err := h.settingsRepo.ListByUser(ctx, userID)
+	if err != nil {
+		h.logger.Error("failed to list joined rooms", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list rooms"})
+		return
+	}
+
+	memberships, err := h.memberRepo.ListByUser(ctx, userID)
+	if err != nil {
+		h.logger.Error("failed to list room memberships", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list rooms"})
+		return
+	}
+	roles := make(map[uuid.UUID]domain.RoomRole, len(memberships))
+	for _, member := range memberships {
+		roles[member.RoomID] = member.Role
+	}
+
+	roomList := make([]gin.H, 0, len(owned)+len(joined))
+	listed := make(map[uuid.UUID]gin.H, len(owned)+len(joined))
+	for _, room := range owned {
+		item := roomJSON(room)
+		item["role"] = domain.RoomRoleOwner
+		roomList = append(roomList, item)
+		listed[room.ID] = item
+	}
+
+	// Load every joined or member room the caller doesn't own in one query
+	var ids []uuid.UUID
+	for _, settings := range joined {
+		if _, ok := listed[settings.RoomID]; !ok {
+			ids = append(ids, settings.RoomID)
+		}
+	}
+	for _, member := range memberships {
+		if _, ok := listed[member.RoomID]; !ok {
+			ids = append(ids, member.RoomID)
+		}
+	}
+	rooms, err := h.roomRepo.ListByIDs(ctx, ids)
+	if err != nil {
+		h.logger.Error("failed to get listed rooms", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list rooms"})
+		return
+	}
+	byID := make(map[uuid.UUID]*domain.Room, len(rooms))
+	for _, room := range rooms {
+		byID[room.ID] = room
+	}
+
+	for _, settings := range joined {
+		// Owners who joined their own room are listed once, with their settings
+		if item, ok := listed[settings.RoomID]; ok {
+			item["display_name"], item["color"], item["joined_at"] = settings.DisplayName, settings.Color, settings.JoinedAt
+			continue
+		}
+
+		room, ok := byID[settings.RoomID]
+		if !ok {
+			continue
+		}
+
+		// Joining a public room doesn't make a membership; those users are members all the
+		// same, until the room is made private and they can no longer enter it
+		role, ok := roles[room.ID]
+		if !ok {
+			if !room.IsPublic {
+				continue
+			}
+			role = domain.RoomRoleMember
+		}
+
+		item := roomJSON(room)
+		item["role"] = role
+		item["display_name"], item["color"], item["joined_at"] = settings.DisplayName, settings.Color, settings.JoinedAt
+		roomList = append(roomList, item)
+		listed[room.ID] = item
+	}
+
+	// Members who redeemed an invite but never finished joining
+	for _, member := range memberships {
+		if _, ok := listed[member.RoomID]; ok {
+			continue
+		}
+
+		room, ok := byID[member.RoomID]
+		if !ok {
+			continue
+		}
+
+		item := roomJSON(room)
+		item["role"] = member.Role
+		roomList = append(roomList, item)
+		listed[room.ID] = item
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"asocial/internal/auth"
+	"asocial/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+	maxInviteUses    = 1000
+)
+
+// CreateInviteRequest represents the request body for creating a room invite
+type CreateInviteRequest struct {
+	Role      domain.RoomRole `json:"role,omitempty"`       // member (default) or admin; only owners invite admins
+	MaxUses   *int            `json:"max_uses,omitempty"`   // Unlimited if omitted
+	ExpiresIn *int64          `json:"expires_in,omitempty"` // Seconds; 7 days if omitted, at most 30
+}
+
+// HandleCreateInvite creates an invite link to a room; only its owner and admins may
+func (h *RoomHandler) HandleCreateInvite(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = domain.RoomRoleMember
+	}
+	if req.Role != domain.RoomRoleMember && req.Role != domain.RoomRoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be member or admin", "field": "role"})
+		return
+	}
+	if req.MaxUses != nil && (*req.MaxUses < 1 || *req.MaxUses > maxInviteUses) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_uses must be 1 to %d", maxInviteUses), "field": "max_uses"})
+		return
+	}
+	ttl := defaultInviteTTL
+	if req.ExpiresIn != nil {
+		ttl = time.Duration(*req.ExpiresIn) * time.Second
+		if ttl < time.Minute || ttl > maxInviteTTL {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("expires_in must be %d to %d seconds", int64(time.Minute.Seconds()), int64(maxInviteTTL.Seconds())),
+				"field": "expires_in",
+			})
+			return
+		}
+	}
+
+	room, role, ok := h.invitingRoom(c, userID)
+	if !ok {
+		return
+	}
+	if req.Role == domain.RoomRoleAdmin && role != domain.RoomRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room's owner can invite admins"})
+		return
+	}
+
+	invite, err := h.inviteRepo.Create(c.Request.Context(), domain.CreateRoomInviteParams{
+		RoomID:    room.ID,
+		CreatedBy: userID,
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		h.logger.Error("failed to create invite", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	response, err := h.inviteJSON(invite)
+	if err != nil {
+		h.logger.Error("failed to sign invite", "error", err, "invite_id", invite.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	h.logger.Info("room invite created", "room_id", room.ID, "invite_id", invite.ID, "role", invite.Role, "user_id", userID)
+	c.JSON(http.StatusCreated, response)
+}
+
+// HandleListInvites lists a room's invites that can still be redeemed; only its owner and admins may
+func (h *RoomHandler) HandleListInvites(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	room, _, ok := h.invitingRoom(c, userID)
+	if !ok {
+		return
+	}
+
+	invites, err := h.inviteRepo.ListActive(c.Request.Context(), room.ID)
+	if err != nil {
+		h.logger.Error("failed to list invites", "error", err, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+		return
+	}
+
+	inviteList := make([]gin.H, 0, len(invites))
+	for _, invite := range invites {
+		item, err := h.inviteJSON(invite)
+		if err != nil {
+			h.logger.Error("failed to sign invite", "error", err, "invite_id", invite.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+			return
+		}
+		inviteList = append(inviteList, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invites": inviteList,
+		"count":   len(inviteList),
+	})
+}
+
+// HandleRevokeInvite stops an invite link from letting anyone else in; only the room's owner and admins may
+// Members who already joined with it stay members.
+func (h *RoomHandler) HandleRevokeInvite(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	inviteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	room, _, ok := h.invitingRoom(c, userID)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.inviteRepo.Revoke(c.Request.Context(), room.ID, inviteID)
+	if err != nil {
+		h.logger.Error("failed to revoke invite", "error", err, "room_id", room.ID, "invite_id", inviteID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	h.logger.Info("room invite revoked", "room_id", room.ID, "invite_id", inviteID, "user_id", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// verifyInvite checks that an invite token was issued for the room and hasn't expired
+// It doesn't redeem the invite, so it can be checked before the rest of a join is.
+// On failure it writes the error response and returns false
+func (h *RoomHandler) verifyInvite(c *gin.Context, room *domain.Room, token string) (*auth.InviteClaims, bool) {
+	claims, err := h.inviteTokens.Verify(token)
+	if errors.Is(err, auth.ErrExpiredInviteToken) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invite has expired"})
+		return nil, false
+	}
+	if err != nil || claims.RoomID != room.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid invite"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// redeemInvite makes the user a member of the room with a verified invite
+// On failure it writes the error response and returns false
+func (h *RoomHandler) redeemInvite(c *gin.Context, room *domain.Room, userID uuid.UUID, claims *auth.InviteClaims) bool {
+	member, err := h.inviteRepo.Redeem(c.Request.Context(), claims.InviteID, room.ID, userID)
+	if errors.Is(err, domain.ErrInviteUnavailable) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invite has been revoked, has expired or has been used up"})
+		return false
+	}
+	if err != nil {
+		h.logger.Error("failed to redeem invite", "error", err, "invite_id", claims.InviteID, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem invite"})
+		return false
+	}
+
+	h.logger.Info("room invite redeemed", "room_id", room.ID, "invite_id", claims.InviteID, "user_id", userID, "role", member.Role)
+	return true
+}
+
+// invitingRoom looks up the room in the URL and the caller's role in it, which must let them manage invites
+// On failure it writes the error response and returns false
+func (h *RoomHandler) invitingRoom(c *gin.Context, userID uuid.UUID) (*domain.Room, domain.RoomRole, bool) {
+	room, ok := h.roomFromPath(c)
+	if !ok {
+		return nil, "", false
+	}
+
+	role, err := h.roomRole(c.Request.Context(), room, userID)
+	if err != nil {
+		h.logger.Error("failed to get room member", "error", err, "room_id", room.ID, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return nil, "", false
+	}
+	if !role.CanInvite() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the room's owner and admins can manage invites"})
+		return nil, "", false
+	}
+	return room, role, true
+}
+
+// roomRole returns the user's role in a room, or "" if they aren't a member
+func (h *RoomHandler) roomRole(ctx context.Context, room *domain.Room, userID uuid.UUID) (domain.RoomRole, error) {
+	if isRoomOwner(room, userID) {
+		return domain.RoomRoleOwner, nil
+	}
+
+	member, err := h.memberRepo.Get(ctx, room.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	if member == nil {
+		return "", nil
+	}
+	return member.Role, nil
+}
+
+// inviteJSON is an invite as the API returns it, with the token for its link
+func (h *RoomHandler) inviteJSON(invite *domain.RoomInvite) (gin.H, error) {
+	token, err := h.inviteTokens.Sign(invite.ID, invite.RoomID, invite.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"id":         invite.ID,
+		"token":      token,
+		"role":       invite.Role,
+		"max_uses":   invite.MaxUses,
+		"uses":       invite.Uses,
+		"expires_at": invite.ExpiresAt,
+		"created_at": invite.CreatedAt,
+	}, nil
+}
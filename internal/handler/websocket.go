@@ -1,31 +1,103 @@
 package handler
 
 import (
+	"asocial/internal/auth"
 	"asocial/internal/domain"
 	"asocial/internal/service"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/olahol/melody"
 )
 
+// DefaultRoomSlug is the room a WebSocket joins when no room is requested
+const DefaultRoomSlug = "general"
+
+// activityTouchInterval limits how often a session's messages are written to presence as activity
+const activityTouchInterval = 15 * time.Second
+
+// errIdentityRejected signals that the upgrade was refused and a response was written
+var errIdentityRejected = errors.New("websocket identity rejected")
+
+// RoomLookup resolves rooms by slug for WebSocket admission
+type RoomLookup interface {
+	GetBySlug(ctx context.Context, slug string) (*domain.Room, error)
+}
+
+// UserLookup resolves authenticated users by ID
+type UserLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+}
+
+// RoomSettingsLookup resolves a user's per-room display name and color
+type RoomSettingsLookup interface {
+	Get(ctx context.Context, roomID, userID uuid.UUID) (*domain.RoomUserSettings, error)
+}
+
 // WebSocketHandler handles WebSocket connections and messages
 type WebSocketHandler struct {
-	melody  *melody.Melody
-	service *service.MessageService
-	logger  *slog.Logger
+	melody      *melody.Melody
+	service     *service.MessageService
+	presence    service.PresenceStore
+	resumer     *service.SessionResumer
+	limiter     *service.FrameLimiter
+	rooms       RoomLookup
+	users       UserLookup
+	settings    RoomSettingsLookup
+	members     RoomMemberLookup
+	guestTokens *auth.GuestTokenService
+	logger      *slog.Logger
+
+	maxFrameSize int64 // Larger frames are rejected with too_large
+
+	draining    atomic.Bool
+	connections sync.WaitGroup // Sessions whose disconnect handler has not finished
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(m *melody.Melody, svc *service.MessageService, logger *slog.Logger) *WebSocketHandler {
+// resumer may be nil, in which case every disconnect leaves presence straight away
+// limiter may be nil, in which case sessions may send frames as fast as they like
+// m's MaxMessageSize is doubled: frames up to twice the configured size are still read,
+// so their sender gets a too_large error instead of losing its connection.
+func NewWebSocketHandler(
+	m *melody.Melody,
+	svc *service.MessageService,
+	presence service.PresenceStore,
+	resumer *service.SessionResumer,
+	limiter *service.FrameLimiter,
+	rooms RoomLookup,
+	users UserLookup,
+	settings RoomSettingsLookup,
+	members RoomMemberLookup,
+	guestTokens *auth.GuestTokenService,
+	logger *slog.Logger,
+) *WebSocketHandler {
 	handler := &WebSocketHandler{
-		melody:  m,
-		service: svc,
-		logger:  logger,
+		melody:      m,
+		service:     svc,
+		presence:    presence,
+		resumer:     resumer,
+		limiter:     limiter,
+		rooms:       rooms,
+		users:       users,
+		settings:    settings,
+		members:     members,
+		guestTokens: guestTokens,
+		logger:      logger,
+
+		maxFrameSize: m.Config.MaxMessageSize,
 	}
+	m.Config.MaxMessageSize *= 2
 
 	// Register Melody event handlers
 	m.HandleConnect(handler.handleConnect)
@@ -35,27 +107,217 @@ func NewWebSocketHandler(m *melody.Melody, svc *service.MessageService, logger *
 	return handler
 }
 
-// HandleUpgrade upgrades HTTP connection to WebSocket
+// HandleUpgrade resolves the requested room and upgrades HTTP connection to WebSocket
+// The room is selected with the "room" query parameter (a room slug)
 func (h *WebSocketHandler) HandleUpgrade(c *gin.Context) {
-	if err := h.melody.HandleRequest(c.Writer, c.Request); err != nil {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+		return
+	}
+
+	roomSlug := c.Query("room")
+	if roomSlug == "" {
+		roomSlug = DefaultRoomSlug
+	}
+
+	room, err := h.rooms.GetBySlug(c.Request.Context(), roomSlug)
+	if err != nil {
+		h.logger.Error("Failed to get room for WebSocket", "error", err, "slug", roomSlug)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room"})
+		return
+	}
+
+	if room == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	// Apply the same access rule as the REST join endpoint
+	userID, authenticated := authenticatedUserID(c)
+	if !room.IsPublic {
+		if !authenticated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		allowed, err := canAccessRoom(c.Request.Context(), h.members, room, userID)
+		if err != nil {
+			h.logger.Error("Failed to check room access for WebSocket", "error", err, "room_id", room.ID, "user_id", userID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this room"})
+			return
+		}
+	}
+
+	// Resolve who is connecting before the upgrade so failures get a proper HTTP status
+	var keys map[string]any
+	if authenticated {
+		keys, err = h.authenticatedSessionKeys(c, room, userID)
+		if err != nil {
+			return
+		}
+	} else {
+		keys, err = h.guestSessionKeys(c)
+		if err != nil {
+			return
+		}
+	}
+
+	// The session's channel is the room ID, so every room gets its own canvas
+	keys["channel_id"] = room.ID.String()
+	keys["room_slug"] = room.Slug
+	// Each connection is its own presence session, so a user can have several tabs open
+	keys["session_id"] = uuid.NewString()
+	// Rate limits also apply per client address, behind trusted proxies the forwarded one
+	keys["client_ip"] = c.ClientIP()
+
+	// A client reconnecting within the grace window picks its parked session back up
+	if token := c.Query("resume"); token != "" && h.resumer != nil {
+		h.claimSession(c.Request.Context(), token, keys)
+	}
+
+	if err := h.melody.HandleRequestWithKeys(c.Writer, c.Request, keys); err != nil {
 		h.logger.Error("Failed to upgrade WebSocket", "error", err, "remote_addr", c.Request.RemoteAddr)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to establish WebSocket connection"})
 		return
 	}
 }
 
+// authenticatedSessionKeys builds session keys for a signed-in user
+// Identity, display name and color come from the users and room_user_settings rows,
+// never from the query string. A "uid" query parameter is tolerated only if it matches.
+// On failure the HTTP response has already been written.
+func (h *WebSocketHandler) authenticatedSessionKeys(c *gin.Context, room *domain.Room, userID uuid.UUID) (map[string]any, error) {
+	if uid := c.Query("uid"); uid != "" && uid != userID.String() {
+		h.logger.Warn("WebSocket user ID mismatch", "user_id", userID, "query_uid", uid, "remote_addr", c.Request.RemoteAddr)
+		c.JSON(http.StatusForbidden, gin.H{"error": "User ID does not match authenticated user"})
+		return nil, errIdentityRejected
+	}
+
+	user, err := h.users.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get user for WebSocket", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, err
+	}
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, errIdentityRejected
+	}
+
+	settings, err := h.settings.Get(c.Request.Context(), room.ID, userID)
+	if err != nil {
+		h.logger.Error("Failed to get room user settings", "error", err, "user_id", userID, "room_id", room.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room settings"})
+		return nil, err
+	}
+
+	// Users who never joined through the REST API get their global username and the default color
+	username := user.Username
+	color := domain.DefaultUserColor
+	if settings != nil {
+		username = settings.DisplayName
+		color = settings.Color
+	}
+
+	return map[string]any{
+		"user_id":       user.ID.String(),
+		"username":      username,
+		"color":         color,
+		"authenticated": true,
+	}, nil
+}
+
+// guestSessionKeys builds session keys for an anonymous user
+// The guest ID comes from a server-signed token ("guest_token" query parameter) and
+// lives in its own identity space ("guest:<id>"), so guests can neither forge each
+// other's IDs nor claim the ID of a registered user.
+// On failure the HTTP response has already been written.
+func (h *WebSocketHandler) guestSessionKeys(c *gin.Context) (map[string]any, error) {
+	token := c.Query("guest_token")
+	if token == "" {
+		h.logger.Warn("Connection without guest token", "remote_addr", c.Request.RemoteAddr)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Guest token is required"})
+		return nil, errIdentityRejected
+	}
+
+	claims, err := h.guestTokens.Verify(token)
+	if err != nil {
+		h.logger.Warn("Invalid guest token", "error", err, "remote_addr", c.Request.RemoteAddr)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired guest token"})
+		return nil, errIdentityRejected
+	}
+
+	userID := domain.GuestUserID(claims.GuestID)
+	if uid := c.Query("uid"); uid != "" && domain.GuestUserID(uid) != userID {
+		h.logger.Warn("WebSocket guest ID mismatch", "user_id", userID, "query_uid", uid, "remote_addr", c.Request.RemoteAddr)
+		c.JSON(http.StatusForbidden, gin.H{"error": "User ID does not match guest token"})
+		return nil, errIdentityRejected
+	}
+
+	// A name or color that wouldn't pass as a username_changed or color_changed is left unset
+	username := c.Query("username")
+	if !domain.ValidUsername(username) {
+		username = ""
+	}
+	color := strings.ToLower(c.Query("color"))
+	if !domain.ValidColor(color) {
+		color = ""
+	}
+
+	return map[string]any{
+		"user_id":       userID,
+		"username":      username,
+		"color":         color,
+		"authenticated": false,
+	}, nil
+}
+
+// claimSession takes over a parked session for a reconnecting client
+// The connection reuses the session's ID and remembers where its message buffer left off.
+// A token for another user or room is still claimed, so its parked session leaves now.
+func (h *WebSocketHandler) claimSession(ctx context.Context, token string, keys map[string]any) {
+	state, err := h.resumer.Claim(ctx, token)
+	if err != nil {
+		h.logger.Error("Failed to resume session", "error", err)
+		return
+	}
+	if state == nil {
+		h.logger.Debug("Resume token expired or unknown", "user_id", keys["user_id"])
+		return
+	}
+
+	if state.UserID != keys["user_id"] || state.ChannelID != keys["channel_id"] {
+		h.logger.Warn("Resume token for another user or room", "user_id", keys["user_id"], "channel_id", keys["channel_id"])
+		h.leave(ctx, state.ChannelID, state.UserID, state.SessionID)
+		return
+	}
+
+	keys["session_id"] = state.SessionID
+	keys["resumed"] = *state
+}
+
 // handleConnect is called when a new WebSocket connection is established
 func (h *WebSocketHandler) handleConnect(sess *melody.Session) {
-	userID := sess.Request.URL.Query().Get("uid")
-	if userID == "" {
+	// Melody always follows up with handleDisconnect, which marks the session done
+	h.connections.Add(1)
+
+	// Identity is resolved during the upgrade
+	userIDVal, _ := sess.Get("user_id")
+	userID, ok := userIDVal.(string)
+	if !ok || userID == "" {
 		h.logger.Warn("Connection without user ID", "remote_addr", sess.Request.RemoteAddr)
 		sess.Close()
 		return
 	}
 
-	// Get optional username and color from query parameters
-	username := sess.Request.URL.Query().Get("username")
-	color := sess.Request.URL.Query().Get("color")
+	usernameVal, _ := sess.Get("username")
+	username, _ := usernameVal.(string)
+	colorVal, _ := sess.Get("color")
+	color, _ := colorVal.(string)
 
 	var usernamePtr *string
 	if username != "" {
@@ -67,59 +329,191 @@ func (h *WebSocketHandler) handleConnect(sess *melody.Session) {
 		colorPtr = &color
 	}
 
-	// Store user ID, username, color, and channel ID in session
-	// For now, all users join the "default" channel
-	channelID := "default"
-	sess.Set("user_id", userID)
-	sess.Set("username", username)
-	sess.Set("color", color)
-	sess.Set("channel_id", channelID)
+	// Channel ID is resolved from the room during the upgrade
+	channelIDVal, _ := sess.Get("channel_id")
+	channelID, ok := channelIDVal.(string)
+	if !ok || channelID == "" {
+		h.logger.Warn("Connection without channel ID", "user_id", userID, "remote_addr", sess.Request.RemoteAddr)
+		sess.Close()
+		return
+	}
+
+	sessionIDVal, _ := sess.Get("session_id")
+	sessionID, _ := sessionIDVal.(string)
+	if sessionID == "" {
+		h.logger.Warn("Connection without session ID", "user_id", userID, "remote_addr", sess.Request.RemoteAddr)
+		sess.Close()
+		return
+	}
+
+	h.service.Outbound().Open(sess, channelID, userID)
+
+	// Set when this connection resumed a parked session
+	resumedVal, _ := sess.Get("resumed")
+	resumed, isResumed := resumedVal.(domain.ResumeState)
 
 	ctx := context.Background()
 
-	// Add user to Redis presence set with username and color
-	if err := h.service.GetPubSubClient().AddUserToChannel(ctx, channelID, userID, usernamePtr, colorPtr); err != nil {
-		h.logger.Error("Failed to add user to channel", "error", err, "user_id", userID)
+	// Make sure this node receives the room's messages before announcing the join
+	if err := h.service.GetPubSubClient().JoinChannel(ctx, channelID); err != nil {
+		h.logger.Error("Failed to join channel", "error", err, "user_id", userID, "channel_id", channelID)
+		sess.Close()
+		return
+	}
+	sess.Set("subscribed", true)
+
+	// Add this session to the channel's presence with username and color
+	now := time.Now().UnixMilli()
+	sessions, joinErr := h.presence.Join(ctx, channelID, domain.PresenceSession{
+		SessionID:    sessionID,
+		UserID:       userID,
+		Username:     usernamePtr,
+		Color:        colorPtr,
+		ConnectedAt:  now,
+		LastActiveAt: now,
+	})
+	if joinErr != nil {
+		h.logger.Error("Failed to join presence", "error", joinErr, "user_id", userID)
+	}
+	// Cleared by whichever of Drain and handleDisconnect leaves presence first
+	joined := &atomic.Bool{}
+	joined.Store(true)
+	sess.Set("joined_presence", joined)
+
+	// Issue the token the client presents to resume this session after a dropped connection
+	var resumeToken string
+	if h.resumer != nil {
+		token, err := service.NewResumeToken()
+		if err != nil {
+			h.logger.Error("Failed to issue resume token", "error", err, "user_id", userID)
+		} else {
+			resumeToken = token
+			sess.Set("resume_token", token)
+		}
 	}
 
 	// Get current list of users in the channel and send to the connecting user
-	users, err := h.service.GetPubSubClient().GetChannelUsers(ctx, channelID)
+	users, err := h.presence.ListUsers(ctx, channelID)
 	if err != nil {
 		h.logger.Error("Failed to get channel users", "error", err, "user_id", userID)
 	} else {
+		h.addCursors(ctx, channelID, users)
+
 		// Send user list directly to this session (not via pub/sub)
 		syncMsg := domain.NewUserSyncMessage(channelID, users)
-		sess.Write(syncMsg.Encode())
+		syncMsg.ResumeToken = resumeToken
+		syncMsg.Seq = h.currentSeq(ctx, channelID)
+		h.service.Outbound().Send(sess, syncMsg)
 		h.logger.Debug("Sent user sync", "user_id", userID, "user_count", len(users))
 	}
 
-	// Publish user joined event with username and color
-	joinMsg := domain.NewUserJoinedMessage(channelID, userID, usernamePtr, colorPtr)
-	if err := h.service.PublishMessage(ctx, joinMsg); err != nil {
-		h.logger.Error("Failed to publish join event", "error", err, "user_id", userID)
+	// A resumed session catches up on what it missed; anyone else gets the visible canvas
+	if !isResumed || !h.sendMissed(ctx, sess, userID, resumed) {
+		h.sendCanvasSnapshot(ctx, sess, channelID, userID)
+	}
+
+	// Publish user joined event with username and color, unless another tab of theirs
+	// already did or this session never really left
+	if !isResumed && (joinErr != nil || sessions <= 1) {
+		joinMsg := domain.NewUserJoinedMessage(channelID, userID, usernamePtr, colorPtr)
+		if err := h.service.PublishMessage(ctx, joinMsg); err != nil {
+			h.logger.Error("Failed to publish join event", "error", err, "user_id", userID)
+		}
 	}
 
 	// Start heartbeat to keep presence alive
-	go h.startHeartbeat(sess, channelID, userID)
+	go h.startHeartbeat(sess, channelID, sessionID)
 
-	h.logger.Info("WebSocket connected", "user_id", userID, "channel_id", channelID, "remote_addr", sess.Request.RemoteAddr)
+	h.logger.Info("WebSocket connected", "user_id", userID, "channel_id", channelID, "session_id", sessionID, "resumed", isResumed, "remote_addr", sess.Request.RemoteAddr)
 }
 
-// handleMessage is called when a message is received from a WebSocket client
-func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
-	// Decode the message
-	msg, err := domain.DecodeMessage(data)
+// addCursors fills in where each user last pointed, so the joiner sees everyone's cursor
+// Without cursors the user list is still worth sending, so failures are only logged.
+func (h *WebSocketHandler) addCursors(ctx context.Context, channelID string, users []domain.UserInfo) {
+	cursors, err := h.service.Cursors(ctx, channelID)
 	if err != nil {
-		h.logger.Error("Failed to decode message", "error", err, "data", string(data))
+		h.logger.Warn("Failed to get cursors", "error", err, "channel_id", channelID)
 		return
 	}
 
+	for i := range users {
+		if position, ok := cursors[users[i].UserID]; ok {
+			users[i].Cursor = &position
+		}
+	}
+}
+
+// currentSeq returns the room's sequence number, from which the joiner counts messages
+// Joined rooms are already subscribed, so every later message reaches the session live.
+// Without it the client merely can't spot gaps until its first message, so failures are only logged.
+func (h *WebSocketHandler) currentSeq(ctx context.Context, channelID string) int64 {
+	seq, err := h.service.CurrentSeq(ctx, channelID)
+	if err != nil {
+		h.logger.Warn("Failed to get sequence", "error", err, "channel_id", channelID)
+	}
+	return seq
+}
+
+// sendCanvasSnapshot sends the messages still visible on the canvas so the joiner doesn't start blank
+func (h *WebSocketHandler) sendCanvasSnapshot(ctx context.Context, sess *melody.Session, channelID, userID string) {
+	items, err := h.service.CanvasSnapshot(ctx, channelID)
+	if err != nil {
+		h.logger.Error("Failed to get canvas snapshot", "error", err, "user_id", userID)
+		return
+	}
+
+	canvasMsg := domain.NewCanvasSyncMessage(channelID, items)
+	h.service.Outbound().Send(sess, canvasMsg)
+	h.logger.Debug("Sent canvas sync", "user_id", userID, "message_count", len(items))
+}
+
+// sendMissed resends the messages a resumed session missed while disconnected
+// Returns false if the buffer no longer has all of them.
+func (h *WebSocketHandler) sendMissed(ctx context.Context, sess *melody.Session, userID string, resumed domain.ResumeState) bool {
+	msgs, complete, err := h.resumer.Missed(ctx, resumed)
+	if err != nil {
+		h.logger.Error("Failed to get missed messages", "error", err, "user_id", userID)
+		return false
+	}
+	if !complete {
+		h.logger.Debug("Missed messages no longer buffered", "user_id", userID, "channel_id", resumed.ChannelID)
+		return false
+	}
+
+	sent := h.sendBuffered(sess, userID, msgs)
+	h.logger.Debug("Sent missed messages", "user_id", userID, "count", sent)
+	return true
+}
+
+// sendBuffered resends buffered messages to a session, leaving out those it wouldn't
+// have received live: its own chat messages and chat outside its viewport
+// Returns how many were sent.
+func (h *WebSocketHandler) sendBuffered(sess *melody.Session, userID string, msgs []*domain.Message) int {
+	outbound := h.service.Outbound()
+
+	sent := 0
+	for _, msg := range msgs {
+		if msg.Type == domain.MessageTypeChat && msg.UserID == userID {
+			continue
+		}
+		if !outbound.Sees(sess, msg) {
+			continue
+		}
+		outbound.Send(sess, msg)
+		sent++
+	}
+	return sent
+}
+
+// handleMessage is called when a message is received from a WebSocket client
+func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
 	// Get user ID and channel ID from session
 	userID, exists := sess.Get("user_id")
 	if !exists {
 		h.logger.Warn("Message from session without user ID")
 		return
 	}
+	userIDStr, _ := userID.(string)
 
 	channelID, exists := sess.Get("channel_id")
 	if !exists {
@@ -127,9 +521,84 @@ func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
 		return
 	}
 
+	// Frames too large or malformed to have a type are charged to the budget of types
+	// without limits of their own, so junk can't be sent faster than chat
+	if int64(len(data)) > h.maxFrameSize {
+		h.logger.Warn("Message too large", "size", len(data), "max_size", h.maxFrameSize)
+		if h.allowFrame(sess, "", userIDStr, "") {
+			h.rejectFrame(sess, "", domain.ErrorCodeTooLarge, fmt.Sprintf("message exceeds %d bytes", h.maxFrameSize))
+		}
+		return
+	}
+
+	// Decode the message
+	msg, err := domain.DecodeMessage(data)
+	if err != nil {
+		h.logger.Error("Failed to decode message", "error", err, "data", string(data))
+		if h.allowFrame(sess, "", userIDStr, "") {
+			h.rejectFrame(sess, "", domain.ErrorCodeInvalidMessage, "message is not valid JSON")
+		}
+		return
+	}
+
+	// The request ID is only meant for the sender's ack or error, never for the room
+	requestID := msg.RequestID
+	msg.RequestID = ""
+
+	if !h.allowFrame(sess, msg.Type, userIDStr, requestID) {
+		return
+	}
+
 	// Validate that the message's user ID matches the session
 	if msg.UserID != userID {
 		h.logger.Warn("Message user ID mismatch", "session_user_id", userID, "message_user_id", msg.UserID)
+		h.rejectFrame(sess, requestID, domain.ErrorCodeForbidden, "user_id does not match the session")
+		return
+	}
+
+	// Messages are always scoped to the session's room, whatever the client claims
+	channelIDStr, ok := channelID.(string)
+	if !ok {
+		h.logger.Error("Failed to get channelID from session")
+		return
+	}
+	msg.ChannelID = channelIDStr
+
+	// Only the fields the message's type uses are kept, once they check out
+	msg, err = domain.SanitizeInbound(msg)
+	if err != nil {
+		h.logger.Warn("Invalid message", "error", err, "user_id", userID)
+		code := domain.ErrorCodeInvalidMessage
+		if errors.Is(err, domain.ErrForbiddenField) {
+			code = domain.ErrorCodeForbidden
+		}
+		h.sendError(sess, requestID, code, err.Error())
+		return
+	}
+
+	h.recordActivity(sess, channelIDStr)
+
+	// Replay requests are answered to this session only, never published
+	if msg.Type == domain.MessageTypeReplay {
+		h.handleReplay(sess, channelIDStr, requestID, msg.Since)
+		return
+	}
+
+	// Backfill requests are answered to this session only, never published
+	if msg.Type == domain.MessageTypeBackfill {
+		h.handleBackfill(sess, channelIDStr, msg.UserID, requestID, msg.SinceSeq)
+		return
+	}
+
+	// Viewport updates only change what this node sends the session, never published
+	if msg.Type == domain.MessageTypeViewportUpdate {
+		h.service.Outbound().SetViewport(sess, *msg.Viewport)
+		return
+	}
+
+	// Cursor moves go to the room through a per-user throttle and are never persisted
+	if msg.Type == domain.MessageTypeCursorMoved {
+		h.service.MoveCursor(domain.NewCursorMovedMessage(channelIDStr, msg.UserID, *msg.Position))
 		return
 	}
 
@@ -152,21 +621,16 @@ func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
 			colorPtr = &color
 		}
 
-		// Safely get channelID and userID with type assertions
-		channelIDStr, ok := channelID.(string)
-		if !ok {
-			h.logger.Error("Failed to get channelID from session")
-			return
-		}
+		// Safely get userID with type assertion
 		userIDStr, ok := userID.(string)
 		if !ok {
 			h.logger.Error("Failed to get userID from session")
 			return
 		}
 
-		// Update username in Redis (preserve color)
-		if err := h.service.GetPubSubClient().AddUserToChannel(ctx, channelIDStr, userIDStr, msg.Username, colorPtr); err != nil {
-			h.logger.Error("Failed to update username in Redis", "error", err, "user_id", userID)
+		// Update username on all of the user's sessions (preserve color)
+		if err := h.presence.UpdateUser(ctx, channelIDStr, userIDStr, msg.Username, colorPtr); err != nil {
+			h.logger.Error("Failed to update username in presence", "error", err, "user_id", userID)
 		}
 
 		h.logger.Info("Username changed", "user_id", userID, "username", msg.Username)
@@ -191,26 +655,33 @@ func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
 			usernamePtr = &username
 		}
 
-		// Safely get channelID and userID with type assertions
-		channelIDStr, ok := channelID.(string)
-		if !ok {
-			h.logger.Error("Failed to get channelID from session")
-			return
-		}
+		// Safely get userID with type assertion
 		userIDStr, ok := userID.(string)
 		if !ok {
 			h.logger.Error("Failed to get userID from session")
 			return
 		}
 
-		// Update color in Redis (preserve username)
-		if err := h.service.GetPubSubClient().AddUserToChannel(ctx, channelIDStr, userIDStr, usernamePtr, msg.Color); err != nil {
-			h.logger.Error("Failed to update color in Redis", "error", err, "user_id", userID)
+		// Update color on all of the user's sessions (preserve username)
+		if err := h.presence.UpdateUser(ctx, channelIDStr, userIDStr, usernamePtr, msg.Color); err != nil {
+			h.logger.Error("Failed to update color in presence", "error", err, "user_id", userID)
 		}
 
 		h.logger.Info("Color changed", "user_id", userID, "color", msg.Color)
 	}
 
+	// Chat messages carry the author's current name and color for history and late joiners
+	if msg.Type == domain.MessageTypeChat {
+		usernameVal, _ := sess.Get("username")
+		if username, ok := usernameVal.(string); ok && username != "" {
+			msg.Username = &username
+		}
+		colorVal, _ := sess.Get("color")
+		if color, ok := colorVal.(string); ok && color != "" {
+			msg.Color = &color
+		}
+	}
+
 	payloadLen := 0
 	if msg.Payload != nil {
 		payloadLen = len(*msg.Payload)
@@ -228,12 +699,144 @@ func (h *WebSocketHandler) handleMessage(sess *melody.Session, data []byte) {
 	ctx := context.Background()
 	if err := h.service.PublishMessage(ctx, msg); err != nil {
 		h.logger.Error("Failed to publish message", "error", err, "message_id", msg.MessageID)
+		h.sendError(sess, requestID, domain.ErrorCodePublishFailed, "message could not be delivered to the room")
+		return
+	}
+	h.service.Outbound().Send(sess, domain.NewAckMessage(msg, requestID))
+}
+
+// allowFrame checks a frame against its sender's rate limits, answering it if they are spent
+// A session that keeps sending over its limits is disconnected with RateLimitCloseCode.
+func (h *WebSocketHandler) allowFrame(sess *melody.Session, msgType domain.MessageType, userID, requestID string) bool {
+	if h.limiter == nil {
+		return true
+	}
+
+	sessionIDVal, _ := sess.Get("session_id")
+	sessionID, _ := sessionIDVal.(string)
+	clientIPVal, _ := sess.Get("client_ip")
+	clientIP, _ := clientIPVal.(string)
+
+	allowed, retryAfter := h.limiter.Allow(context.Background(), msgType, sessionID, userID, clientIP)
+	if allowed {
+		return true
+	}
+
+	h.logger.Warn("Message rate limited", "type", msgType, "user_id", userID, "session_id", sessionID, "retry_after", retryAfter)
+	channelIDVal, _ := sess.Get("channel_id")
+	channelID, _ := channelIDVal.(string)
+	errMsg := domain.NewErrorMessage(channelID, requestID, domain.ErrorCodeRateLimited, fmt.Sprintf("too many %s messages", msgType))
+	errMsg.RetryAfterMs = retryAfter.Milliseconds()
+	h.service.Outbound().Send(sess, errMsg)
+
+	h.strike(sess)
+	return false
+}
+
+// rejectFrame tells a session why a frame that breaks the protocol was rejected
+// Unlike frames with merely invalid content, these count as strikes: clients we
+// ship never send them.
+func (h *WebSocketHandler) rejectFrame(sess *melody.Session, requestID string, code domain.ErrorCode, reason string) {
+	h.sendError(sess, requestID, code, reason)
+	h.strike(sess)
+}
+
+// strike records a rejected frame, disconnecting a session that has had too many
+func (h *WebSocketHandler) strike(sess *melody.Session) {
+	if h.limiter == nil {
 		return
 	}
+
+	sessionIDVal, _ := sess.Get("session_id")
+	sessionID, _ := sessionIDVal.(string)
+	if !h.limiter.Strike(sessionID) {
+		return
+	}
+
+	userIDVal, _ := sess.Get("user_id")
+	h.logger.Warn("Disconnecting rate limited session", "user_id", userIDVal, "session_id", sessionID)
+	closeMsg := melody.FormatCloseMessage(service.RateLimitCloseCode, "rate limited")
+	if err := sess.CloseWithMsg(closeMsg); err != nil {
+		h.logger.Debug("Failed to close rate limited session", "error", err)
+	}
+}
+
+// sendError tells a session why one of its frames was rejected
+func (h *WebSocketHandler) sendError(sess *melody.Session, requestID string, code domain.ErrorCode, reason string) {
+	channelIDVal, _ := sess.Get("channel_id")
+	channelID, _ := channelIDVal.(string)
+	h.service.Outbound().Send(sess, domain.NewErrorMessage(channelID, requestID, code, reason))
+}
+
+// recordActivity marks the session as active in presence, at most once per activityTouchInterval
+func (h *WebSocketHandler) recordActivity(sess *melody.Session, channelID string) {
+	lastVal, _ := sess.Get("activity_touched_at")
+	if last, ok := lastVal.(time.Time); ok && time.Since(last) < activityTouchInterval {
+		return
+	}
+	sess.Set("activity_touched_at", time.Now())
+
+	sessionIDVal, _ := sess.Get("session_id")
+	sessionID, _ := sessionIDVal.(string)
+	if err := h.presence.Touch(context.Background(), channelID, sessionID, true); err != nil {
+		h.logger.Error("Failed to record activity", "error", err, "session_id", sessionID)
+	}
+}
+
+// handleReplay resends the room's messages published after a stream ID to one session
+func (h *WebSocketHandler) handleReplay(sess *melody.Session, channelID, requestID, since string) {
+	messages, err := h.service.Replay(context.Background(), channelID, since)
+	if errors.Is(err, domain.ErrReplayUnsupported) {
+		h.sendError(sess, requestID, domain.ErrorCodeInvalidMessage, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to replay messages", "error", err, "channel_id", channelID, "since", since)
+		h.sendError(sess, requestID, domain.ErrorCodePublishFailed, "messages could not be replayed")
+		return
+	}
+
+	for _, msg := range messages {
+		h.service.Outbound().Send(sess, msg)
+	}
+
+	h.logger.Debug("Replayed messages", "channel_id", channelID, "since", since, "count", len(messages))
+}
+
+// handleBackfill resends the room's messages after a sequence number to one session
+// The reply ends with a backfill frame carrying the sequence number it runs up to, so the
+// client knows the gaps before it are messages it wouldn't have received anyway. If the
+// buffer no longer reaches back far enough, a canvas snapshot comes first.
+func (h *WebSocketHandler) handleBackfill(sess *melody.Session, channelID, userID, requestID string, since int64) {
+	ctx := context.Background()
+	msgs, complete, seq, err := h.service.Backfill(ctx, channelID, since)
+	if err != nil {
+		h.logger.Error("Failed to backfill messages", "error", err, "channel_id", channelID, "since_seq", since)
+		h.sendError(sess, requestID, domain.ErrorCodePublishFailed, "messages could not be backfilled")
+		return
+	}
+
+	if !complete {
+		h.logger.Debug("Backfill no longer buffered", "user_id", userID, "channel_id", channelID, "since_seq", since)
+		h.sendCanvasSnapshot(ctx, sess, channelID, userID)
+	}
+	sent := h.sendBuffered(sess, userID, msgs)
+	h.service.Outbound().Send(sess, domain.NewBackfillMessage(channelID, seq))
+
+	h.logger.Debug("Backfilled messages", "channel_id", channelID, "since_seq", since, "seq", seq, "count", sent)
 }
 
 // handleDisconnect is called when a WebSocket connection is closed
 func (h *WebSocketHandler) handleDisconnect(sess *melody.Session) {
+	defer h.connections.Done()
+	h.service.Outbound().Close(sess)
+
+	if h.limiter != nil {
+		sessionIDVal, _ := sess.Get("session_id")
+		sessionID, _ := sessionIDVal.(string)
+		h.limiter.Forget(sessionID)
+	}
+
 	userIDVal, _ := sess.Get("user_id")
 	channelIDVal, _ := sess.Get("channel_id")
 
@@ -252,15 +855,15 @@ func (h *WebSocketHandler) handleDisconnect(sess *melody.Session) {
 	if userID != "" && channelID != "" {
 		ctx := context.Background()
 
-		// Remove user from Redis presence set
-		if err := h.service.GetPubSubClient().RemoveUserFromChannel(ctx, channelID, userID); err != nil {
-			h.logger.Error("Failed to remove user from channel", "error", err, "user_id", userID)
-		}
+		// Park this session for its client to resume, or remove it from presence,
+		// unless Drain already did
+		h.leavePresence(ctx, sess, userID, channelID)
 
-		// Publish user left event
-		leaveMsg := domain.NewUserLeftMessage(channelID, userID)
-		if err := h.service.PublishMessage(ctx, leaveMsg); err != nil {
-			h.logger.Error("Failed to publish leave event", "error", err, "user_id", userID)
+		// Release this session's hold on the room subscription
+		if subscribed, _ := sess.Get("subscribed"); subscribed == true {
+			if err := h.service.GetPubSubClient().LeaveChannel(ctx, channelID); err != nil {
+				h.logger.Error("Failed to leave channel", "error", err, "user_id", userID, "channel_id", channelID)
+			}
 		}
 	}
 
@@ -271,25 +874,125 @@ func (h *WebSocketHandler) handleDisconnect(sess *melody.Session) {
 	)
 }
 
-// startHeartbeat periodically refreshes user presence in Redis
-func (h *WebSocketHandler) startHeartbeat(sess *melody.Session, channelID, userID string) {
+// leavePresence takes a session out of presence, once
+// Outside a drain a session with a resume token is parked instead, and only leaves if
+// its client doesn't come back within the grace window.
+func (h *WebSocketHandler) leavePresence(ctx context.Context, sess *melody.Session, userID, channelID string) {
+	joinedVal, _ := sess.Get("joined_presence")
+	joined, ok := joinedVal.(*atomic.Bool)
+	if !ok || !joined.CompareAndSwap(true, false) {
+		return
+	}
+
+	sessionIDVal, _ := sess.Get("session_id")
+	sessionID, _ := sessionIDVal.(string)
+
+	tokenVal, _ := sess.Get("resume_token")
+	token, _ := tokenVal.(string)
+	if token != "" && h.resumer != nil && !h.draining.Load() {
+		state := domain.ResumeState{SessionID: sessionID, UserID: userID, ChannelID: channelID}
+		err := h.resumer.Park(ctx, token, state, func(state domain.ResumeState) {
+			h.leave(context.Background(), state.ChannelID, state.UserID, state.SessionID)
+		})
+		if err == nil {
+			return
+		}
+		h.logger.Error("Failed to park session, leaving now", "error", err, "user_id", userID)
+	}
+
+	h.leave(ctx, channelID, userID, sessionID)
+}
+
+// leave removes a session from presence
+// The user has left once their last tab closes, and peers are told with user_left.
+func (h *WebSocketHandler) leave(ctx context.Context, channelID, userID, sessionID string) {
+	remaining, err := h.presence.Leave(ctx, channelID, userID, sessionID)
+	if err != nil {
+		h.logger.Error("Failed to leave presence", "error", err, "user_id", userID)
+	}
+
+	if err != nil || remaining == 0 {
+		leaveMsg := domain.NewUserLeftMessage(channelID, userID)
+		if err := h.service.PublishMessage(ctx, leaveMsg); err != nil {
+			h.logger.Error("Failed to publish leave event", "error", err, "user_id", userID)
+		}
+	}
+}
+
+// Drain shuts the WebSocket side down in order, before the stores it depends on close
+// New upgrades are refused, every session is sent a server_draining frame asking it to
+// reconnect after reconnectAfter, its presence is cleared and user_left published, and
+// then the sessions are closed. Returns once their disconnect handlers have finished,
+// or with ctx's error if that takes too long.
+func (h *WebSocketHandler) Drain(ctx context.Context, reconnectAfter time.Duration) error {
+	h.draining.Store(true)
+
+	sessions, err := h.melody.Sessions()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// Sessions parked here would otherwise linger until the presence sweeper finds them
+	if h.resumer != nil {
+		h.resumer.ExpireAll()
+	}
+
+	h.logger.Info("Draining WebSocket sessions", "sessions", len(sessions))
+	for _, sess := range sessions {
+		userIDVal, _ := sess.Get("user_id")
+		userID, _ := userIDVal.(string)
+		channelIDVal, _ := sess.Get("channel_id")
+		channelID, _ := channelIDVal.(string)
+		if userID == "" || channelID == "" {
+			continue
+		}
+
+		// Nothing else is sent to a draining session; the frame is written directly so it
+		// reaches the client just ahead of the close frame
+		h.service.Outbound().Close(sess)
+		sess.Write(domain.NewServerDrainingMessage(channelID, reconnectAfter).Encode())
+		h.leavePresence(ctx, sess, userID, channelID)
+	}
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server draining")
+	if err := h.melody.CloseWithMsg(closeMsg); err != nil {
+		return fmt.Errorf("failed to close sessions: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		h.logger.Info("WebSocket sessions drained", "sessions", len(sessions))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain sessions: %w", ctx.Err())
+	}
+}
+
+// startHeartbeat periodically refreshes the session's presence
+func (h *WebSocketHandler) startHeartbeat(sess *melody.Session, channelID, sessionID string) {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		// Check if session is still active
 		if sess.IsClosed() {
-			h.logger.Debug("Session closed, stopping heartbeat", "user_id", userID)
+			h.logger.Debug("Session closed, stopping heartbeat", "session_id", sessionID)
 			return
 		}
 
 		// Refresh presence TTL
 		ctx := context.Background()
-		if err := h.service.GetPubSubClient().RefreshUserPresence(ctx, channelID, userID); err != nil {
-			h.logger.Error("Failed to refresh user presence", "error", err, "user_id", userID)
+		if err := h.presence.Touch(ctx, channelID, sessionID, false); err != nil {
+			h.logger.Error("Failed to refresh presence", "error", err, "session_id", sessionID)
 			return
 		}
 
-		h.logger.Debug("Refreshed user presence", "user_id", userID, "channel_id", channelID)
+		h.logger.Debug("Refreshed presence", "session_id", sessionID, "channel_id", channelID)
 	}
 }
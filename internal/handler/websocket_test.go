@@ -0,0 +1,802 @@
+package handler
+
+import (
+	"asocial/internal/auth"
+	"asocial/internal/canvas"
+	"asocial/internal/domain"
+	"asocial/internal/presence"
+	"asocial/internal/pubsub"
+	"asocial/internal/ratelimit"
+	"asocial/internal/resume"
+	"asocial/internal/sequence"
+	"asocial/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+)
+
+// staticRooms is a RoomLookup backed by a fixed set of rooms
+type staticRooms []*domain.Room
+
+func (r staticRooms) GetBySlug(ctx context.Context, slug string) (*domain.Room, error) {
+	for _, room := range r {
+		if room.Slug == slug {
+			return room, nil
+		}
+	}
+	return nil, nil
+}
+
+// wsTestServer runs the WebSocket handler on the in-memory pub/sub
+type wsTestServer struct {
+	url         string
+	handler     *WebSocketHandler
+	presence    *presence.MemoryStore
+	guestTokens *auth.GuestTokenService
+}
+
+func newWSTestServer(t *testing.T, rooms ...*domain.Room) *wsTestServer {
+	t.Helper()
+	return newResumableWSTestServer(t, 0, rooms...)
+}
+
+// newResumableWSTestServer runs the handler with sessions resumable for grace; 0 disables resuming
+func newResumableWSTestServer(t *testing.T, grace time.Duration, rooms ...*domain.Room) *wsTestServer {
+	t.Helper()
+	return startWSTestServer(t, grace, nil, nil, rooms...)
+}
+
+// newLimitedWSTestServer runs the handler with frames rate limited by limiter
+func newLimitedWSTestServer(t *testing.T, limiter *service.FrameLimiter, rooms ...*domain.Room) *wsTestServer {
+	t.Helper()
+	return startWSTestServer(t, 0, limiter, nil, rooms...)
+}
+
+// newBufferedWSTestServer runs the handler with recent messages kept in buffer
+func newBufferedWSTestServer(t *testing.T, buffer service.MessageBuffer, rooms ...*domain.Room) *wsTestServer {
+	t.Helper()
+	return startWSTestServer(t, 0, nil, buffer, rooms...)
+}
+
+func startWSTestServer(t *testing.T, grace time.Duration, limiter *service.FrameLimiter, buffer service.MessageBuffer, rooms ...*domain.Room) *wsTestServer {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	sequencer := sequence.NewMemorySequencer()
+	if buffer == nil {
+		buffer = resume.NewMemoryBuffer(16)
+	}
+	var resumer *service.SessionResumer
+	if grace > 0 {
+		resumer = service.NewSessionResumer(resume.NewMemoryStore(nil), buffer, sequencer, grace, logger)
+	}
+
+	m := melody.New()
+	svc := service.NewMessageService(pubsub.NewMemoryPubSub(logger), sequencer, nil, canvas.NewMemoryCache(5*time.Second, nil), buffer, canvas.NewMemoryCursors(), service.NewOutbound(m, 256, 5*time.Second, 400, logger), logger)
+	go svc.StartSubscriber(ctx)
+
+	guestTokens, err := auth.NewGuestTokenService([]byte(strings.Repeat("k", 32)), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create guest token service: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := presence.NewMemoryStore(nil)
+	handler := NewWebSocketHandler(m, svc, store, resumer, limiter, staticRooms(rooms), nil, nil, nil, guestTokens, logger)
+	router.GET("/ws", handler.HandleUpgrade)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &wsTestServer{
+		url:         "ws" + strings.TrimPrefix(server.URL, "http") + "/ws",
+		handler:     handler,
+		presence:    store,
+		guestTokens: guestTokens,
+	}
+}
+
+// guestURL returns a connection URL for a guest with a valid token
+func (s *wsTestServer) guestURL(t *testing.T, guestID, username string) string {
+	t.Helper()
+
+	token, _, err := s.guestTokens.Issue(guestID)
+	if err != nil {
+		t.Fatalf("Failed to issue guest token: %v", err)
+	}
+	return fmt.Sprintf("%s?guest_token=%s&username=%s", s.url, token, url.QueryEscape(username))
+}
+
+// dial connects and fails the test on error
+func dial(t *testing.T, rawURL string) *websocket.Conn {
+	t.Helper()
+
+	ws, _, err := websocket.DefaultDialer.Dial(rawURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readFrame reads the next message and checks its type
+func readFrame(t *testing.T, ws *websocket.Conn, want domain.MessageType) *domain.Message {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", want, err)
+	}
+
+	var msg domain.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if msg.Type != want {
+		t.Fatalf("Expected %s, got %s", want, msg.Type)
+	}
+	return &msg
+}
+
+func TestWebSocketHandler_GuestsChat(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	sync := readFrame(t, alice, domain.MessageTypeUserSync)
+	if len(sync.Users) != 1 || sync.Users[0].UserID != "guest:alice" {
+		t.Errorf("Expected only alice in sync, got %+v", sync.Users)
+	}
+	if sync.ChannelID != room.ID.String() {
+		t.Errorf("Expected channel %s, got %s", room.ID, sync.ChannelID)
+	}
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, alice, domain.MessageTypeUserJoined)
+
+	// Alice writes before Bob arrives
+	chat := domain.NewMessage("msg-1", "ignored", "guest:alice", "hello", domain.Position{X: 1, Y: 2})
+	if err := alice.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+		t.Fatalf("Failed to send chat: %v", err)
+	}
+	if ack := readFrame(t, alice, domain.MessageTypeAck); ack.MessageID == nil || *ack.MessageID != "msg-1" {
+		t.Errorf("Expected msg-1 to be acked, got %+v", ack)
+	}
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	if sync := readFrame(t, bob, domain.MessageTypeUserSync); len(sync.Users) != 2 {
+		t.Errorf("Expected 2 users in sync, got %d", len(sync.Users))
+	}
+	snapshot := readFrame(t, bob, domain.MessageTypeCanvasSync)
+	if len(snapshot.Messages) != 1 || snapshot.Messages[0].Payload != "hello" {
+		t.Fatalf("Expected alice's message on the canvas, got %+v", snapshot.Messages)
+	}
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	if joined := readFrame(t, alice, domain.MessageTypeUserJoined); joined.UserID != "guest:bob" {
+		t.Errorf("Expected bob joined, got %s", joined.UserID)
+	}
+
+	// Bob's chat reaches Alice scoped to the room and stamped with his name
+	chat = domain.NewMessage("msg-2", "ignored", "guest:bob", "hi", domain.Position{})
+	if err := bob.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+		t.Fatalf("Failed to send chat: %v", err)
+	}
+	got := readFrame(t, alice, domain.MessageTypeChat)
+	if got.ChannelID != room.ID.String() {
+		t.Errorf("Expected channel %s, got %s", room.ID, got.ChannelID)
+	}
+	if got.Username == nil || *got.Username != "Bob" {
+		t.Errorf("Expected username Bob, got %v", got.Username)
+	}
+
+	// Bob leaving is announced
+	bob.Close()
+	if left := readFrame(t, alice, domain.MessageTypeUserLeft); left.UserID != "guest:bob" {
+		t.Errorf("Expected bob left, got %s", left.UserID)
+	}
+}
+
+func TestWebSocketHandler_MultipleTabs(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	tab1 := dial(t, srv.guestURL(t, "alice", "Alice"))
+	readFrame(t, tab1, domain.MessageTypeUserSync)
+	readFrame(t, tab1, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// A second tab shows up as one user with two sessions and isn't announced again
+	tab2 := dial(t, srv.guestURL(t, "alice", "Alice"))
+	sync := readFrame(t, tab2, domain.MessageTypeUserSync)
+	if len(sync.Users) != 2 {
+		t.Fatalf("Expected 2 users in sync, got %+v", sync.Users)
+	}
+	for _, user := range sync.Users {
+		if user.UserID == "guest:alice" && (user.Sessions != 2 || user.Status != domain.PresenceActive) {
+			t.Errorf("Expected alice active with 2 sessions, got %+v", user)
+		}
+	}
+	readFrame(t, tab2, domain.MessageTypeCanvasSync)
+
+	// Closing one tab keeps alice present; closing the last announces her leaving
+	tab1.Close()
+	time.Sleep(50 * time.Millisecond)
+	tab2.Close()
+
+	_, data, err := bob.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	msg, err := domain.DecodeMessage(data)
+	if err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if msg.Type != domain.MessageTypeUserLeft || msg.UserID != "guest:alice" {
+		t.Fatalf("Expected only alice's leave after the last tab, got %s from %s", msg.Type, msg.UserID)
+	}
+
+	bob.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := bob.ReadMessage(); err == nil {
+		t.Errorf("Expected no more frames, got %s", data)
+	}
+}
+
+func TestWebSocketHandler_Viewport(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// Bob only shows the top left of the canvas
+	update := &domain.Message{
+		Type:     domain.MessageTypeViewportUpdate,
+		UserID:   "guest:bob",
+		Viewport: &domain.Viewport{Width: 800, Height: 600, Zoom: 1},
+	}
+	if err := bob.WriteMessage(websocket.TextMessage, update.Encode()); err != nil {
+		t.Fatalf("Failed to send viewport: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	readFrame(t, alice, domain.MessageTypeUserSync)
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+
+	// Presence still reaches Bob wherever he looks
+	if joined := readFrame(t, bob, domain.MessageTypeUserJoined); joined.UserID != "guest:alice" {
+		t.Errorf("Expected alice joined, got %s", joined.UserID)
+	}
+
+	far := domain.NewMessage("msg-far", "ignored", "guest:alice", "far away", domain.Position{X: 3000, Y: 3000})
+	near := domain.NewMessage("msg-near", "ignored", "guest:alice", "nearby", domain.Position{X: 900, Y: 100})
+	for _, chat := range []*domain.Message{far, near} {
+		if err := alice.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+			t.Fatalf("Failed to send chat: %v", err)
+		}
+	}
+
+	// The far message is skipped; the near one is within the margin
+	if got := readFrame(t, bob, domain.MessageTypeChat); *got.MessageID != "msg-near" {
+		t.Errorf("Expected only msg-near, got %s", *got.MessageID)
+	}
+}
+
+func TestWebSocketHandler_ViewportGapsNeedNoBackfill(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	// Bob looks at the top left of the canvas and Alice at the bottom right
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	readFrame(t, alice, domain.MessageTypeUserSync)
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, alice, domain.MessageTypeUserJoined)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	clients := []struct {
+		name     string
+		ws       *websocket.Conn
+		viewport domain.Viewport
+		at       domain.Position
+	}{
+		{"bob", bob, domain.Viewport{Width: 800, Height: 600, Zoom: 1}, domain.Position{X: 100, Y: 100}},
+		{"alice", alice, domain.Viewport{X: 3000, Y: 3000, Width: 800, Height: 600, Zoom: 1}, domain.Position{X: 3100, Y: 3100}},
+	}
+	for _, c := range clients {
+		update := &domain.Message{Type: domain.MessageTypeViewportUpdate, UserID: "guest:" + c.name, Viewport: &c.viewport}
+		if err := c.ws.WriteMessage(websocket.TextMessage, update.Encode()); err != nil {
+			t.Fatalf("Failed to send viewport: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Each types in their own corner, so each sees only some of the room's sequence numbers
+	for i := 0; i < 3; i++ {
+		for _, c := range clients {
+			chat := domain.NewMessage(fmt.Sprintf("%s-%d", c.name, i), "ignored", "guest:"+c.name, "hi", c.at)
+			if err := c.ws.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+				t.Fatalf("Failed to send chat: %v", err)
+			}
+		}
+	}
+
+	// Neither hears about the other's messages, as gaps or otherwise; they only get their acks
+	for _, c := range clients {
+		var lastSeq int64
+		for i := 0; i < 3; i++ {
+			ack := readFrame(t, c.ws, domain.MessageTypeAck)
+			if ack.Seq <= lastSeq {
+				t.Errorf("Expected %s's acks in order, got seq %d after %d", c.name, ack.Seq, lastSeq)
+			}
+			lastSeq = ack.Seq
+		}
+
+		c.ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, data, err := c.ws.ReadMessage(); err == nil {
+			t.Errorf("Expected nothing more for %s, got %s", c.name, data)
+		}
+	}
+}
+
+// brokenBuffer is a MessageBuffer that keeps messages but fails to read them back
+type brokenBuffer struct {
+	service.MessageBuffer
+}
+
+func (b brokenBuffer) Since(ctx context.Context, channelID string, seq int64) ([]*domain.Message, bool, error) {
+	return nil, false, errors.New("buffer unavailable")
+}
+
+func TestWebSocketHandler_BackfillFailed(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newBufferedWSTestServer(t, brokenBuffer{resume.NewMemoryBuffer(16)}, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// The client is told its request failed instead of waiting for a reply
+	request := &domain.Message{Type: domain.MessageTypeBackfill, UserID: "guest:bob", RequestID: "req-1"}
+	if err := bob.WriteMessage(websocket.TextMessage, request.Encode()); err != nil {
+		t.Fatalf("Failed to send backfill request: %v", err)
+	}
+	failed := readFrame(t, bob, domain.MessageTypeError)
+	if failed.Code != domain.ErrorCodePublishFailed || failed.RequestID != "req-1" {
+		t.Errorf("Expected req-1 to fail with publish_failed, got %+v", failed)
+	}
+}
+
+func TestWebSocketHandler_Backfill(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	if sync := readFrame(t, bob, domain.MessageTypeUserSync); sync.Seq != 0 {
+		t.Errorf("Expected an empty room at seq 0, got %d", sync.Seq)
+	}
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	if joined := readFrame(t, bob, domain.MessageTypeUserJoined); joined.Seq != 1 {
+		t.Errorf("Expected bob's join at seq 1, got %d", joined.Seq)
+	}
+
+	// Bob only shows the top left of the canvas
+	update := &domain.Message{
+		Type:     domain.MessageTypeViewportUpdate,
+		UserID:   "guest:bob",
+		Viewport: &domain.Viewport{Width: 800, Height: 600, Zoom: 1},
+	}
+	if err := bob.WriteMessage(websocket.TextMessage, update.Encode()); err != nil {
+		t.Fatalf("Failed to send viewport: %v", err)
+	}
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	if sync := readFrame(t, alice, domain.MessageTypeUserSync); sync.Seq != 1 {
+		t.Errorf("Expected alice to join at seq 1, got %d", sync.Seq)
+	}
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// The server's clock and sequence win over the client's
+	before := time.Now().UnixMilli()
+	far := domain.NewMessage("msg-far", "ignored", "guest:alice", "far away", domain.Position{X: 3000, Y: 3000})
+	near := domain.NewMessage("msg-near", "ignored", "guest:alice", "nearby", domain.Position{X: 100, Y: 100})
+	near.Seq, near.Timestamp = 42, 1
+	own := domain.NewMessage("msg-own", "ignored", "guest:bob", "mine", domain.Position{X: 200, Y: 200})
+	for _, chat := range []*domain.Message{far, near} {
+		if err := alice.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+			t.Fatalf("Failed to send chat: %v", err)
+		}
+	}
+	got := readFrame(t, bob, domain.MessageTypeChat)
+	if *got.MessageID != "msg-near" || got.Seq != 4 || got.Timestamp < before {
+		t.Errorf("Expected msg-near at seq 4 with a server timestamp, got %s at %d (%d)", *got.MessageID, got.Seq, got.Timestamp)
+	}
+	if err := bob.WriteMessage(websocket.TextMessage, own.Encode()); err != nil {
+		t.Fatalf("Failed to send chat: %v", err)
+	}
+	if ack := readFrame(t, bob, domain.MessageTypeAck); ack.Seq != 5 {
+		t.Errorf("Expected msg-own to be acked at seq 5, got %d", ack.Seq)
+	}
+
+	// A backfill resends what Bob would have received live: not msg-far, which is out of
+	// view, nor msg-own, which is his own
+	request := &domain.Message{Type: domain.MessageTypeBackfill, UserID: "guest:bob", SinceSeq: 1}
+	if err := bob.WriteMessage(websocket.TextMessage, request.Encode()); err != nil {
+		t.Fatalf("Failed to send backfill request: %v", err)
+	}
+	if joined := readFrame(t, bob, domain.MessageTypeUserJoined); joined.UserID != "guest:alice" || joined.Seq != 2 {
+		t.Errorf("Expected alice's join at seq 2, got %s at %d", joined.UserID, joined.Seq)
+	}
+	if got := readFrame(t, bob, domain.MessageTypeChat); *got.MessageID != "msg-near" {
+		t.Errorf("Expected msg-near, got %s", *got.MessageID)
+	}
+	if done := readFrame(t, bob, domain.MessageTypeBackfill); done.Seq != 5 {
+		t.Errorf("Expected the backfill to run up to seq 5, got %d", done.Seq)
+	}
+}
+
+func TestWebSocketHandler_ErrorsAndAcks(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	send := func(data []byte) {
+		t.Helper()
+		if err := bob.WriteMessage(websocket.TextMessage, data); err != nil {
+			t.Fatalf("Failed to send frame: %v", err)
+		}
+	}
+
+	// Published messages are acked with the client's request ID
+	chat := domain.NewMessage("msg-1", "ignored", "guest:bob", "hi", domain.Position{})
+	chat.RequestID = "req-1"
+	send(chat.Encode())
+	if ack := readFrame(t, bob, domain.MessageTypeAck); ack.RequestID != "req-1" || ack.Seq != 2 {
+		t.Errorf("Expected req-1 acked at seq 2, got %+v", ack)
+	}
+
+	spoofed := domain.NewMessage("msg-2", "ignored", "guest:alice", "hi", domain.Position{})
+	spoofed.RequestID = "req-2"
+	cursor := domain.NewCursorMovedMessage("ignored", "guest:bob", domain.Position{X: -1, Y: 0})
+	cursor.RequestID = "req-3"
+	sync := &domain.Message{Type: domain.MessageTypeUserSync, UserID: "guest:bob", RequestID: "req-4"}
+	injected := domain.NewCursorMovedMessage("ignored", "guest:bob", domain.Position{})
+	injected.Users, injected.RequestID = []domain.UserInfo{{UserID: "guest:ghost"}}, "req-5"
+	colorName := "red"
+	color := domain.NewColorChangedMessage("ignored", "guest:bob", &colorName)
+	color.RequestID = "req-6"
+
+	tests := []struct {
+		name          string
+		frame         []byte
+		wantCode      domain.ErrorCode
+		wantRequestID string
+	}{
+		{"malformed JSON", []byte("{not json"), domain.ErrorCodeInvalidMessage, ""},
+		{"another user's ID", spoofed.Encode(), domain.ErrorCodeForbidden, "req-2"},
+		{"cursor off the canvas", cursor.Encode(), domain.ErrorCodeInvalidMessage, "req-3"},
+		{"server message type", sync.Encode(), domain.ErrorCodeInvalidMessage, "req-4"},
+		{"users field", injected.Encode(), domain.ErrorCodeForbidden, "req-5"},
+		{"color that isn't hex", color.Encode(), domain.ErrorCodeInvalidMessage, "req-6"},
+		// The test server keeps melody's default limit of 512 bytes
+		{"too large", []byte(`{"payload":"` + strings.Repeat("x", 600) + `"}`), domain.ErrorCodeTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send(tt.frame)
+			got := readFrame(t, bob, domain.MessageTypeError)
+			if got.Code != tt.wantCode || got.RequestID != tt.wantRequestID || got.Reason == "" {
+				t.Errorf("Expected %s for %q, got %+v", tt.wantCode, tt.wantRequestID, got)
+			}
+		})
+	}
+
+	// Nothing was published for the rejected frames, and the connection survived them
+	send(domain.NewMessage("msg-3", "ignored", "guest:bob", "still here", domain.Position{}).Encode())
+	if ack := readFrame(t, bob, domain.MessageTypeAck); ack.Seq != 3 {
+		t.Errorf("Expected the next message at seq 3, got %d", ack.Seq)
+	}
+}
+
+func TestWebSocketHandler_RateLimited(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limits := map[domain.MessageType]service.FrameLimits{
+		domain.MessageTypeChat: {Session: domain.RateLimit{Rate: 0.1, Burst: 2}},
+	}
+	limiter := service.NewFrameLimiter(ratelimit.NewMemoryLimiter(nil), limits, 2, time.Minute, logger)
+	srv := newLimitedWSTestServer(t, limiter, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	send := func(requestID string) {
+		t.Helper()
+		msg := domain.NewMessage(uuid.NewString(), "ignored", "guest:bob", "hi", domain.Position{})
+		msg.RequestID = requestID
+		if err := bob.WriteMessage(websocket.TextMessage, msg.Encode()); err != nil {
+			t.Fatalf("Failed to send frame: %v", err)
+		}
+	}
+
+	// The burst goes through, the next message is refused with a hint when to retry
+	send("req-1")
+	readFrame(t, bob, domain.MessageTypeAck)
+	send("req-2")
+	readFrame(t, bob, domain.MessageTypeAck)
+	send("req-3")
+	limited := readFrame(t, bob, domain.MessageTypeError)
+	if limited.Code != domain.ErrorCodeRateLimited || limited.RequestID != "req-3" || limited.RetryAfterMs < 9000 || limited.RetryAfterMs > 10000 {
+		t.Errorf("Expected req-3 rate limited for about 10s, got %+v", limited)
+	}
+
+	// A session that keeps going is disconnected
+	send("req-4")
+	bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := bob.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, service.RateLimitCloseCode) {
+			t.Errorf("Expected close code %d, got %v", service.RateLimitCloseCode, err)
+		}
+		break
+	}
+
+	// Frames that fail validation still spend budget and count as strikes
+	carol := dial(t, srv.guestURL(t, "carol", "Carol"))
+	readFrame(t, carol, domain.MessageTypeUserSync)
+	readFrame(t, carol, domain.MessageTypeCanvasSync)
+	readFrame(t, carol, domain.MessageTypeUserJoined)
+
+	sendAs := func(userID, requestID string) {
+		t.Helper()
+		msg := domain.NewMessage(uuid.NewString(), "ignored", userID, "hi", domain.Position{})
+		msg.RequestID = requestID
+		if err := carol.WriteMessage(websocket.TextMessage, msg.Encode()); err != nil {
+			t.Fatalf("Failed to send frame: %v", err)
+		}
+	}
+	sendAs("guest:carol", "req-5")
+	readFrame(t, carol, domain.MessageTypeAck)
+	sendAs("guest:carol", "req-6")
+	readFrame(t, carol, domain.MessageTypeAck)
+
+	// Over the limit, a forged frame is refused before anyone looks at it
+	sendAs("guest:bob", "req-7")
+	if limited := readFrame(t, carol, domain.MessageTypeError); limited.Code != domain.ErrorCodeRateLimited || limited.RequestID != "req-7" {
+		t.Errorf("Expected req-7 rate limited, got %+v", limited)
+	}
+
+	// Garbage is charged to the other budget, and its strike is the second
+	if err := carol.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	carol.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := carol.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, service.RateLimitCloseCode) {
+			t.Errorf("Expected close code %d after invalid frames, got %v", service.RateLimitCloseCode, err)
+		}
+		break
+	}
+}
+
+func TestWebSocketHandler_Cursors(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	readFrame(t, alice, domain.MessageTypeUserSync)
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// A position off the canvas is dropped
+	for _, position := range []domain.Position{{X: -5, Y: 10}, {X: 100, Y: 200}} {
+		move := domain.NewCursorMovedMessage("ignored", "guest:alice", position)
+		if err := alice.WriteMessage(websocket.TextMessage, move.Encode()); err != nil {
+			t.Fatalf("Failed to send cursor: %v", err)
+		}
+	}
+
+	moved := readFrame(t, bob, domain.MessageTypeCursorMoved)
+	if moved.UserID != "guest:alice" || moved.ChannelID != room.ID.String() {
+		t.Errorf("Expected alice's cursor in the room, got %s in %s", moved.UserID, moved.ChannelID)
+	}
+	if moved.Position == nil || *moved.Position != (domain.Position{X: 100, Y: 200}) {
+		t.Errorf("Expected cursor at 100,200, got %v", moved.Position)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// A joiner sees where everyone last pointed
+	carol := dial(t, srv.guestURL(t, "carol", "Carol"))
+	sync := readFrame(t, carol, domain.MessageTypeUserSync)
+	for _, user := range sync.Users {
+		if user.UserID == "guest:alice" && (user.Cursor == nil || *user.Cursor != (domain.Position{X: 100, Y: 200})) {
+			t.Errorf("Expected alice's cursor in sync, got %v", user.Cursor)
+		}
+		if user.UserID == "guest:bob" && user.Cursor != nil {
+			t.Errorf("Expected no cursor for bob, got %v", user.Cursor)
+		}
+	}
+}
+
+func TestWebSocketHandler_Resume(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newResumableWSTestServer(t, 200*time.Millisecond, room)
+
+	bob := dial(t, srv.guestURL(t, "bob", "Bob"))
+	readFrame(t, bob, domain.MessageTypeUserSync)
+	readFrame(t, bob, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	sync := readFrame(t, alice, domain.MessageTypeUserSync)
+	if sync.ResumeToken == "" {
+		t.Fatal("Expected a resume token in user sync")
+	}
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, bob, domain.MessageTypeUserJoined)
+
+	// Bob writes while alice's connection is down
+	alice.Close()
+	time.Sleep(50 * time.Millisecond)
+	chat := domain.NewMessage("msg-1", "ignored", "guest:bob", "missed", domain.Position{})
+	if err := bob.WriteMessage(websocket.TextMessage, chat.Encode()); err != nil {
+		t.Fatalf("Failed to send chat: %v", err)
+	}
+	readFrame(t, bob, domain.MessageTypeAck)
+
+	// Reconnecting with the token keeps her session and replays what she missed
+	alice = dial(t, srv.guestURL(t, "alice", "Alice")+"&resume="+sync.ResumeToken)
+	resync := readFrame(t, alice, domain.MessageTypeUserSync)
+	if resync.ResumeToken == "" || resync.ResumeToken == sync.ResumeToken {
+		t.Errorf("Expected a fresh resume token, got %q", resync.ResumeToken)
+	}
+	for _, user := range resync.Users {
+		if user.UserID == "guest:alice" && user.Sessions != 1 {
+			t.Errorf("Expected alice to keep one session, got %+v", user)
+		}
+	}
+	if missed := readFrame(t, alice, domain.MessageTypeChat); missed.Payload == nil || *missed.Payload != "missed" {
+		t.Errorf("Expected the missed chat message, got %+v", missed)
+	}
+
+	// Bob saw neither a leave nor a join
+	bob.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, data, err := bob.ReadMessage(); err == nil {
+		t.Errorf("Expected no presence churn, got %s", data)
+	}
+
+	// A used token can't be resumed again: carol joins as usual
+	alice.Close()
+	carol := dial(t, srv.guestURL(t, "carol", "Carol")+"&resume="+sync.ResumeToken)
+	readFrame(t, carol, domain.MessageTypeUserSync)
+	readFrame(t, carol, domain.MessageTypeCanvasSync)
+	readFrame(t, carol, domain.MessageTypeUserJoined)
+
+	// Without a reconnect, alice leaves once the grace window closes
+	if left := readFrame(t, carol, domain.MessageTypeUserLeft); left.UserID != "guest:alice" {
+		t.Errorf("Expected alice left, got %s", left.UserID)
+	}
+}
+
+func TestWebSocketHandler_Drain(t *testing.T) {
+	room := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	srv := newWSTestServer(t, room)
+
+	alice := dial(t, srv.guestURL(t, "alice", "Alice"))
+	readFrame(t, alice, domain.MessageTypeUserSync)
+	readFrame(t, alice, domain.MessageTypeCanvasSync)
+	readFrame(t, alice, domain.MessageTypeUserJoined)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.handler.Drain(ctx, 3*time.Second); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	// The client is told when to reconnect, then closed as a service restart
+	draining := readFrame(t, alice, domain.MessageTypeServerDraining)
+	if draining.RetryAfterMs != 3000 {
+		t.Errorf("Expected retry after 3000ms, got %d", draining.RetryAfterMs)
+	}
+	_, _, err := alice.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+		t.Errorf("Expected close code %d, got %v", websocket.CloseServiceRestart, err)
+	}
+
+	// Presence is cleared before Drain returns
+	users, err := srv.presence.ListUsers(context.Background(), room.ID.String())
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("Expected no users after drain, got %+v", users)
+	}
+
+	// New connections are refused
+	_, resp, err := websocket.DefaultDialer.Dial(srv.guestURL(t, "bob", "Bob"), nil)
+	if err == nil {
+		t.Fatal("Expected upgrade to fail while draining")
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
+
+func TestWebSocketHandler_UpgradeRejections(t *testing.T) {
+	public := &domain.Room{ID: uuid.New(), Slug: "general", IsPublic: true}
+	private := &domain.Room{ID: uuid.New(), Slug: "secret", IsPublic: false}
+	srv := newWSTestServer(t, public, private)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{name: "unknown room", url: srv.guestURL(t, "alice", "Alice") + "&room=missing", status: http.StatusNotFound},
+		{name: "private room as guest", url: srv.guestURL(t, "alice", "Alice") + "&room=secret", status: http.StatusUnauthorized},
+		{name: "no guest token", url: srv.url + "?username=Alice", status: http.StatusUnauthorized},
+		{name: "forged guest token", url: srv.url + "?guest_token=forged.token", status: http.StatusUnauthorized},
+		{name: "uid mismatch", url: srv.guestURL(t, "alice", "Alice") + "&uid=bob", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp, err := websocket.DefaultDialer.Dial(tt.url, nil)
+			if err == nil {
+				t.Fatal("Expected upgrade to fail")
+			}
+			if resp == nil || resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %v", tt.status, resp)
+			}
+		})
+	}
+}
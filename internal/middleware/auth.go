@@ -76,6 +76,12 @@ func OptionalAuthMiddleware(firebaseService *auth.FirebaseService, logger *slog.
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && isWebSocketUpgrade(c) {
+			// Browsers can't set headers on WebSocket handshakes, so accept the token as a query parameter
+			if token := c.Query("token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			// No token, continue without auth
 			c.Next()
@@ -127,3 +133,8 @@ func OptionalAuthMiddleware(firebaseService *auth.FirebaseService, logger *slog.
 		c.Next()
 	}
 }
+
+// isWebSocketUpgrade reports whether the request is a WebSocket handshake
+func isWebSocketUpgrade(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WindowLimiter counts requests in sliding windows, shared by every node when backed by Redis
+type WindowLimiter interface {
+	// Hit counts a request in every window if each has room for it
+	// Otherwise it is counted in none, and the usage says how long until there is room.
+	Hit(ctx context.Context, windows []domain.SlidingWindow) (domain.WindowUsage, error)
+}
+
+// RateLimitPolicy is how many requests a group of routes allows per client IP and per signed-in user
+// Name keeps each policy's windows apart. User limits only apply behind AuthMiddleware or
+// OptionalAuthMiddleware, which identify the user.
+type RateLimitPolicy struct {
+	Name string
+	IP   domain.WindowLimit
+	User domain.WindowLimit
+}
+
+// RateLimitMiddleware creates a middleware that rejects requests over the policy's limits
+// Responses carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers for the tightest window; rejected ones get 429 with Retry-After. A nil limiter
+// disables the limits, and a failing one lets requests through.
+func RateLimitMiddleware(limiter WindowLimiter, policy RateLimitPolicy, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		var windows []domain.SlidingWindow
+		if policy.IP.Limit > 0 {
+			windows = append(windows, domain.SlidingWindow{Key: policy.Name + ":ip:" + c.ClientIP(), Limit: policy.IP})
+		}
+		if userID, exists := c.Get("user_id"); exists && policy.User.Limit > 0 {
+			windows = append(windows, domain.SlidingWindow{Key: fmt.Sprintf("%s:user:%v", policy.Name, userID), Limit: policy.User})
+		}
+		if len(windows) == 0 {
+			c.Next()
+			return
+		}
+
+		usage, err := limiter.Hit(c.Request.Context(), windows)
+		if err != nil {
+			logger.Warn("failed to check rate limit", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(usage.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(usage.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(seconds(usage.Reset)))
+		header.Set("RateLimit-Policy", windowPolicies(windows))
+
+		if !usage.Allowed {
+			logger.Debug("request rate limited", "policy", policy.Name, "ip", c.ClientIP(), "retry_after", usage.Reset)
+			header.Set("Retry-After", strconv.Itoa(seconds(usage.Reset)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// seconds rounds a duration up to whole seconds, as rate limit headers count them
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// windowPolicies describes the windows in RateLimit-Policy form, e.g. "10;w=60, 100;w=60"
+func windowPolicies(windows []domain.SlidingWindow) string {
+	policies := make([]string, len(windows))
+	for i, window := range windows {
+		policies[i] = fmt.Sprintf("%d;w=%d", window.Limit.Limit, seconds(window.Limit.Window))
+	}
+	return strings.Join(policies, ", ")
+}
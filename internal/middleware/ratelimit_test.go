@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/ratelimit"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingLimiter is a WindowLimiter whose store is down
+type failingLimiter struct{}
+
+func (failingLimiter) Hit(ctx context.Context, windows []domain.SlidingWindow) (domain.WindowUsage, error) {
+	return domain.WindowUsage{}, errors.New("store unavailable")
+}
+
+func newRateLimitedRouter(limiter WindowLimiter, policy RateLimitPolicy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		// Stands in for the auth middleware
+		if userID := c.Query("user"); userID != "" {
+			c.Set("user_id", userID)
+		}
+		c.Next()
+	}, RateLimitMiddleware(limiter, policy, logger), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func get(router *gin.Engine, ip, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?user="+userID, nil)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	now := time.Now()
+	limiter := ratelimit.NewMemoryWindowLimiter(func() time.Time { return now })
+	router := newRateLimitedRouter(limiter, RateLimitPolicy{
+		Name: "test",
+		IP:   domain.WindowLimit{Limit: 3, Window: time.Minute},
+		User: domain.WindowLimit{Limit: 2, Window: time.Minute},
+	})
+
+	// Anonymous requests are counted per IP
+	for i := 0; i < 3; i++ {
+		rec := get(router, "10.0.0.1", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rec.Code)
+		}
+		if got, want := rec.Header().Get("RateLimit-Remaining"), []string{"2", "1", "0"}[i]; got != want {
+			t.Errorf("Request %d: expected %s remaining, got %s", i+1, want, got)
+		}
+	}
+	if rec := get(router, "10.0.0.1", ""); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 retrying after 60s, got %d retrying after %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Signed-in users are also held to their own limit, whatever their address
+	now = now.Add(10 * time.Second)
+	if rec := get(router, "10.0.0.2", "alice"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	rec := get(router, "10.0.0.3", "alice")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("RateLimit-Policy") != "3;w=60, 2;w=60" {
+		t.Errorf("Expected the user's window in the headers, got %v", rec.Header())
+	}
+	if rec := get(router, "10.0.0.4", "alice"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the user to be limited, got %d", rec.Code)
+	}
+
+	// Windows slide: the first requests leave a minute after they were made
+	now = now.Add(50 * time.Second)
+	if rec := get(router, "10.0.0.1", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the IP's window to have room again, got %d", rec.Code)
+	}
+	if rec := get(router, "10.0.0.4", "alice"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected the user to retry after 10s, got %d retrying after %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitMiddleware_PassesThrough(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", IP: domain.WindowLimit{Limit: 1, Window: time.Minute}}
+
+	for name, limiter := range map[string]WindowLimiter{
+		"disabled":            nil,
+		"limiter unavailable": failingLimiter{},
+	} {
+		router := newRateLimitedRouter(limiter, policy)
+		for i := 0; i < 3; i++ {
+			if rec := get(router, "10.0.0.1", ""); rec.Code != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", name, rec.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript renews the lock if this node holds it, otherwise takes it if it is free
+var acquireScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// RedisLeaderLock is a lock held by one node at a time, stored in a Redis key with a TTL
+// If the holder stops renewing it (e.g. it crashed), another node takes over once it expires.
+type RedisLeaderLock struct {
+	client *redis.Client
+	key    string
+	owner  string
+	ttl    time.Duration
+}
+
+// NewRedisLeaderLock creates a leader lock; owner identifies this node
+func NewRedisLeaderLock(client *redis.Client, key, owner string, ttl time.Duration) *RedisLeaderLock {
+	return &RedisLeaderLock{
+		client: client,
+		key:    key,
+		owner:  owner,
+		ttl:    ttl,
+	}
+}
+
+// TryAcquire takes or renews the lock, reporting whether this node holds it
+func (l *RedisLeaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	held, err := acquireScript.Run(ctx, l.client, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", l.key, err)
+	}
+	return held == 1, nil
+}
+
+// NATSLeaderLock is a lock held by one node at a time, stored in a JetStream KV bucket
+// The bucket TTL expires the lock if the holder stops renewing it.
+type NATSLeaderLock struct {
+	kv    jetstream.KeyValue
+	key   string
+	owner string
+}
+
+// NewNATSLeaderLock creates a leader lock in its own bucket; owner identifies this node
+func NewNATSLeaderLock(conn *nats.Conn, bucket, owner string, ttl time.Duration) (*NATSLeaderLock, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:  bucket,
+		TTL:     ttl,
+		Storage: jetstream.MemoryStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock bucket: %w", err)
+	}
+
+	return &NATSLeaderLock{
+		kv:    kv,
+		key:   "leader",
+		owner: owner,
+	}, nil
+}
+
+// TryAcquire takes or renews the lock, reporting whether this node holds it
+// Both go through the entry's revision, so two nodes can't win at once.
+func (l *NATSLeaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	entry, err := l.kv.Get(ctx, l.key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		if _, err := l.kv.Create(ctx, l.key, []byte(l.owner)); err != nil {
+			if errors.Is(err, jetstream.ErrKeyExists) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	if string(entry.Value()) != l.owner {
+		return false, nil
+	}
+
+	// Rewriting the entry restarts its TTL
+	if _, err := l.kv.Update(ctx, l.key, []byte(l.owner), entry.Revision()); err != nil {
+		return false, fmt.Errorf("failed to renew lock: %w", err)
+	}
+	return true, nil
+}
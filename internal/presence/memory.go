@@ -0,0 +1,169 @@
+package presence
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps presence in process memory for single-node mode and tests
+type MemoryStore struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	channels map[string]map[string]*memorySession
+}
+
+// memorySession is a session and the time it lapses without a heartbeat
+type memorySession struct {
+	session   domain.PresenceSession
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an in-memory presence store
+// now drives expiry and status; nil uses the wall clock.
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryStore{
+		now:      now,
+		channels: make(map[string]map[string]*memorySession),
+	}
+}
+
+// Join adds a session and returns how many sessions its user now has in the channel
+func (s *MemoryStore) Join(ctx context.Context, channelID string, session domain.PresenceSession) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, ok := s.channels[channelID]
+	if !ok {
+		sessions = make(map[string]*memorySession)
+		s.channels[channelID] = sessions
+	}
+	sessions[session.SessionID] = &memorySession{session: session, expiresAt: s.now().Add(SessionTTL)}
+
+	return s.countLocked(channelID, session.UserID), nil
+}
+
+// Leave removes a session and returns how many sessions its user still has in the channel
+func (s *MemoryStore) Leave(ctx context.Context, channelID, userID, sessionID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.channels[channelID], sessionID)
+	remaining := s.countLocked(channelID, userID)
+	if len(s.channels[channelID]) == 0 {
+		delete(s.channels, channelID)
+	}
+	return remaining, nil
+}
+
+// Touch keeps a session alive; active also records user activity
+func (s *MemoryStore) Touch(ctx context.Context, channelID, sessionID string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.channels[channelID][sessionID]
+	if !ok || !now.Before(entry.expiresAt) {
+		// Already lapsed; left for the sweeper to announce
+		return nil
+	}
+
+	entry.expiresAt = now.Add(SessionTTL)
+	if active {
+		entry.session.LastActiveAt = now.UnixMilli()
+	}
+	return nil
+}
+
+// UpdateUser changes the name and color on all of a user's sessions in the channel
+func (s *MemoryStore) UpdateUser(ctx context.Context, channelID, userID string, username, color *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.liveLocked(channelID, s.now()) {
+		if entry.session.UserID == userID {
+			entry.session.Username = username
+			entry.session.Color = color
+		}
+	}
+	return nil
+}
+
+// ListUsers returns the channel's users, one entry per user, with their status
+func (s *MemoryStore) ListUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	live := s.liveLocked(channelID, now)
+	sessions := make([]domain.PresenceSession, 0, len(live))
+	for _, entry := range live {
+		sessions = append(sessions, entry.session)
+	}
+
+	return domain.AggregatePresence(sessions, now), nil
+}
+
+// Sweep removes lapsed sessions and returns the users left with none in their channel
+func (s *MemoryStore) Sweep(ctx context.Context) ([]domain.PresenceDeparture, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var departures []domain.PresenceDeparture
+	for channelID, sessions := range s.channels {
+		lapsed := make(map[string]bool)
+		for id, entry := range sessions {
+			if !now.Before(entry.expiresAt) {
+				lapsed[entry.session.UserID] = true
+				delete(sessions, id)
+			}
+		}
+		for userID := range lapsed {
+			if s.countLocked(channelID, userID) == 0 {
+				departures = append(departures, domain.PresenceDeparture{ChannelID: channelID, UserID: userID})
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.channels, channelID)
+		}
+	}
+
+	sort.Slice(departures, func(i, j int) bool {
+		if departures[i].ChannelID != departures[j].ChannelID {
+			return departures[i].ChannelID < departures[j].ChannelID
+		}
+		return departures[i].UserID < departures[j].UserID
+	})
+	return departures, nil
+}
+
+// liveLocked returns the sessions of a channel that haven't lapsed; s.mu must be held
+// Lapsed sessions stay in place until Sweep announces them.
+func (s *MemoryStore) liveLocked(channelID string, now time.Time) []*memorySession {
+	var live []*memorySession
+	for _, entry := range s.channels[channelID] {
+		if now.Before(entry.expiresAt) {
+			live = append(live, entry)
+		}
+	}
+	return live
+}
+
+// countLocked returns how many live sessions a user has in a channel; s.mu must be held
+func (s *MemoryStore) countLocked(channelID, userID string) int {
+	count := 0
+	for _, entry := range s.liveLocked(channelID, s.now()) {
+		if entry.session.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,130 @@
+package presence
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_SessionsPerUser(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(func() time.Time { return now })
+	ctx := context.Background()
+
+	alice, red := "Alice", "#ef4444"
+	joined := now.UnixMilli()
+	if n, _ := s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-1", UserID: "user-a", Username: &alice, Color: &red, ConnectedAt: joined, LastActiveAt: joined}); n != 1 {
+		t.Errorf("Expected 1 session after first join, got %d", n)
+	}
+	if n, _ := s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-2", UserID: "user-a", ConnectedAt: joined, LastActiveAt: joined}); n != 2 {
+		t.Errorf("Expected 2 sessions after second join, got %d", n)
+	}
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-3", UserID: "user-b", ConnectedAt: joined + 1, LastActiveAt: joined})
+
+	users, _ := s.ListUsers(ctx, "room")
+	if len(users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(users))
+	}
+	if users[0].UserID != "user-a" || users[0].Sessions != 2 || users[0].Status != domain.PresenceActive {
+		t.Errorf("User a mismatch: got %+v", users[0])
+	}
+
+	// Closing one tab keeps the user present
+	if n, _ := s.Leave(ctx, "room", "user-a", "tab-1"); n != 1 {
+		t.Errorf("Expected 1 remaining session, got %d", n)
+	}
+	if n, _ := s.Leave(ctx, "room", "user-a", "tab-2"); n != 0 {
+		t.Errorf("Expected no remaining sessions, got %d", n)
+	}
+
+	users, _ = s.ListUsers(ctx, "room")
+	if len(users) != 1 || users[0].UserID != "user-b" {
+		t.Errorf("Expected only user-b, got %+v", users)
+	}
+}
+
+func TestMemoryStore_StatusAndExpiry(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(func() time.Time { return now })
+	ctx := context.Background()
+
+	joined := now.UnixMilli()
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-a", UserID: "user-a", ConnectedAt: joined, LastActiveAt: joined})
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-b", UserID: "user-b", ConnectedAt: joined, LastActiveAt: joined})
+
+	// Both heartbeat, but only user-a does anything
+	now = now.Add(2 * time.Minute)
+	s.Touch(ctx, "room", "tab-a", true)
+	s.Touch(ctx, "room", "tab-b", false)
+
+	users, _ := s.ListUsers(ctx, "room")
+	if len(users) != 2 || users[0].Status != domain.PresenceActive || users[1].Status != domain.PresenceIdle {
+		t.Fatalf("Expected user-a active and user-b idle, got %+v", users)
+	}
+
+	// Only user-a's heartbeat arrives before the TTL runs out
+	now = now.Add(SessionTTL - time.Second)
+	s.Touch(ctx, "room", "tab-a", false)
+	now = now.Add(2 * time.Second)
+
+	users, _ = s.ListUsers(ctx, "room")
+	if len(users) != 1 || users[0].UserID != "user-a" || users[0].Status != domain.PresenceAway {
+		t.Fatalf("Expected only user-a, away, got %+v", users)
+	}
+}
+
+func TestMemoryStore_UpdateUser(t *testing.T) {
+	s := NewMemoryStore(nil)
+	ctx := context.Background()
+
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-1", UserID: "user-a"})
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-2", UserID: "user-a"})
+
+	name, color := "Alice", "#ef4444"
+	s.UpdateUser(ctx, "room", "user-a", &name, &color)
+
+	users, _ := s.ListUsers(ctx, "room")
+	if len(users) != 1 || users[0].Username == nil || *users[0].Username != "Alice" || *users[0].Color != "#ef4444" {
+		t.Errorf("Expected renamed user, got %+v", users)
+	}
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(func() time.Time { return now })
+	ctx := context.Background()
+
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "a-1", UserID: "user-a"})
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "a-2", UserID: "user-a"})
+	s.Join(ctx, "room", domain.PresenceSession{SessionID: "b-1", UserID: "user-b"})
+	s.Join(ctx, "other", domain.PresenceSession{SessionID: "c-1", UserID: "user-c"})
+
+	if departures, _ := s.Sweep(ctx); len(departures) != 0 {
+		t.Fatalf("Expected nothing to sweep yet, got %+v", departures)
+	}
+
+	// One of user-a's tabs and user-b keep heartbeating; the rest lapse
+	now = now.Add(SessionTTL - time.Second)
+	s.Touch(ctx, "room", "a-2", false)
+	s.Touch(ctx, "room", "b-1", false)
+	now = now.Add(2 * time.Second)
+
+	departures, err := s.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(departures) != 1 || departures[0] != (domain.PresenceDeparture{ChannelID: "other", UserID: "user-c"}) {
+		t.Fatalf("Expected only user-c to depart, got %+v", departures)
+	}
+
+	// Everyone lapses; each user is announced once and only once
+	now = now.Add(SessionTTL)
+	departures, _ = s.Sweep(ctx)
+	if len(departures) != 2 || departures[0].UserID != "user-a" || departures[1].UserID != "user-b" {
+		t.Fatalf("Expected user-a and user-b to depart, got %+v", departures)
+	}
+	if departures, _ := s.Sweep(ctx); len(departures) != 0 {
+		t.Errorf("Expected nothing left to sweep, got %+v", departures)
+	}
+}
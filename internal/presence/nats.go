@@ -0,0 +1,264 @@
+package presence
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBucket is the JetStream KV bucket holding presence sessions
+const natsBucket = "chat_presence"
+
+// NATSStore keeps presence in a JetStream KV bucket
+// Each entry records when it lapses, so lapsed sessions are hidden from reads but stay
+// in the bucket until Sweep removes and announces them. The bucket TTL is a backstop
+// for entries no sweeper ever gets to.
+type NATSStore struct {
+	kv     jetstream.KeyValue
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// natsEntry is the value stored for each session
+type natsEntry struct {
+	domain.PresenceSession
+	ChannelID string `json:"channel_id"`
+	ExpiresAt int64  `json:"expires_at"` // Unix milliseconds
+}
+
+// NewNATSStore creates a NATS presence store, creating its bucket if needed
+func NewNATSStore(conn *nats.Conn, logger *slog.Logger) (*NATSStore, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:  natsBucket,
+		TTL:     2 * SessionTTL,
+		Storage: jetstream.MemoryStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create presence bucket: %w", err)
+	}
+
+	return &NATSStore{
+		kv:     kv,
+		now:    time.Now,
+		logger: logger,
+	}, nil
+}
+
+// Join adds a session and returns how many sessions its user now has in the channel
+func (s *NATSStore) Join(ctx context.Context, channelID string, session domain.PresenceSession) (int, error) {
+	if err := s.put(ctx, channelID, &session); err != nil {
+		return 0, err
+	}
+
+	s.logger.Debug("Joined presence", "channel", channelID, "user", session.UserID, "session", session.SessionID)
+	return s.countUserSessions(ctx, channelID, session.UserID)
+}
+
+// Leave removes a session and returns how many sessions its user still has in the channel
+func (s *NATSStore) Leave(ctx context.Context, channelID, userID, sessionID string) (int, error) {
+	if err := s.kv.Purge(ctx, natsKey(channelID, sessionID)); err != nil {
+		s.logger.Error("Failed to leave presence", "error", err, "channel", channelID, "session", sessionID)
+		return 0, err
+	}
+
+	s.logger.Debug("Left presence", "channel", channelID, "user", userID, "session", sessionID)
+	return s.countUserSessions(ctx, channelID, userID)
+}
+
+// Touch keeps a session alive by rewriting its entry; active also records user activity
+func (s *NATSStore) Touch(ctx context.Context, channelID, sessionID string, active bool) error {
+	entry, err := s.kv.Get(ctx, natsKey(channelID, sessionID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		// Already expired; nothing left to refresh
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to refresh presence", "error", err, "session", sessionID)
+		return err
+	}
+
+	var stored natsEntry
+	if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+		return fmt.Errorf("failed to decode presence session: %w", err)
+	}
+	now := s.now()
+	if !now.Before(time.UnixMilli(stored.ExpiresAt)) {
+		// Already lapsed; left for the sweeper to announce
+		return nil
+	}
+	if active {
+		stored.LastActiveAt = now.UnixMilli()
+	}
+	return s.put(ctx, channelID, &stored.PresenceSession)
+}
+
+// UpdateUser changes the name and color on all of a user's sessions in the channel
+func (s *NATSStore) UpdateUser(ctx context.Context, channelID, userID string, username, color *string) error {
+	sessions, err := s.sessions(ctx, channelID)
+	if err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		if sessions[i].UserID != userID {
+			continue
+		}
+		sessions[i].Username = username
+		sessions[i].Color = color
+		if err := s.put(ctx, channelID, &sessions[i]); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debug("Updated presence", "channel", channelID, "user", userID, "username", username, "color", color)
+	return nil
+}
+
+// ListUsers returns the channel's users, one entry per user, with their status
+func (s *NATSStore) ListUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error) {
+	sessions, err := s.sessions(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return domain.AggregatePresence(sessions, s.now()), nil
+}
+
+// sessions returns every live session in a channel
+func (s *NATSStore) sessions(ctx context.Context, channelID string) ([]domain.PresenceSession, error) {
+	lister, err := s.kv.ListKeysFiltered(ctx, encodeKeyToken(channelID)+".*")
+	if err != nil {
+		s.logger.Error("Failed to get presence sessions", "error", err, "channel", channelID)
+		return nil, err
+	}
+	defer lister.Stop()
+
+	now := s.now().UnixMilli()
+	var sessions []domain.PresenceSession
+	for key := range lister.Keys() {
+		entry, ok := s.get(ctx, key)
+		if !ok || entry.ExpiresAt <= now {
+			continue
+		}
+		sessions = append(sessions, entry.PresenceSession)
+	}
+
+	return sessions, nil
+}
+
+// Sweep removes lapsed sessions and returns the users left with none in their channel
+func (s *NATSStore) Sweep(ctx context.Context) ([]domain.PresenceDeparture, error) {
+	lister, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence sessions: %w", err)
+	}
+	defer lister.Stop()
+
+	now := s.now().UnixMilli()
+	live := make(map[domain.PresenceDeparture]bool)
+	var lapsed []domain.PresenceDeparture
+	for key := range lister.Keys() {
+		entry, ok := s.get(ctx, key)
+		if !ok {
+			continue
+		}
+
+		user := domain.PresenceDeparture{ChannelID: entry.ChannelID, UserID: entry.UserID}
+		if entry.ExpiresAt > now {
+			live[user] = true
+			continue
+		}
+
+		if err := s.kv.Purge(ctx, key); err != nil {
+			s.logger.Error("Failed to remove lapsed session", "error", err, "key", key)
+			continue
+		}
+		lapsed = append(lapsed, user)
+	}
+
+	var departures []domain.PresenceDeparture
+	for _, user := range lapsed {
+		if !live[user] {
+			// Marking it live dedupes users with several lapsed sessions
+			live[user] = true
+			departures = append(departures, user)
+		}
+	}
+	return departures, nil
+}
+
+// get loads and decodes one entry, reporting false if it is gone or unreadable
+func (s *NATSStore) get(ctx context.Context, key string) (*natsEntry, bool) {
+	kve, err := s.kv.Get(ctx, key)
+	if err != nil {
+		// Removed since it was listed
+		return nil, false
+	}
+
+	var entry natsEntry
+	if err := json.Unmarshal(kve.Value(), &entry); err != nil {
+		s.logger.Warn("Failed to decode presence session", "error", err, "key", key)
+		return nil, false
+	}
+	return &entry, true
+}
+
+// countUserSessions returns how many live sessions a user has in a channel
+func (s *NATSStore) countUserSessions(ctx context.Context, channelID, userID string) (int, error) {
+	sessions, err := s.sessions(ctx, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, session := range sessions {
+		if session.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// put writes a session's entry, restarting its TTL
+func (s *NATSStore) put(ctx context.Context, channelID string, session *domain.PresenceSession) error {
+	data, err := json.Marshal(natsEntry{
+		PresenceSession: *session,
+		ChannelID:       channelID,
+		ExpiresAt:       s.now().Add(SessionTTL).UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal presence session: %w", err)
+	}
+
+	if _, err := s.kv.Put(ctx, natsKey(channelID, session.SessionID), data); err != nil {
+		s.logger.Error("Failed to write presence session", "error", err, "session", session.SessionID)
+		return err
+	}
+	return nil
+}
+
+// natsKey returns the KV key for a session
+// KV keys only allow a restricted alphabet, so both parts are base64url-encoded.
+func natsKey(channelID, sessionID string) string {
+	return encodeKeyToken(channelID) + "." + encodeKeyToken(sessionID)
+}
+
+// encodeKeyToken encodes a value as a single KV key token
+func encodeKeyToken(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
@@ -0,0 +1,7 @@
+// Package presence tracks which sessions are connected to each channel.
+package presence
+
+import "time"
+
+// SessionTTL is how long a session stays present without a heartbeat
+const SessionTTL = 5 * time.Minute
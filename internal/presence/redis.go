@@ -0,0 +1,311 @@
+package presence
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// channelsKey is the set of channels that have presence sessions, walked by Sweep
+const channelsKey = "chat:presence:channels"
+
+// joinScript adds a session and returns how many sessions its user has in the channel
+// KEYS: sessions, expiry, active, users, channels. ARGV: session ID, user ID, JSON, expires at, now, channel ID
+var joinScript = redis.NewScript(`
+if redis.call('HSET', KEYS[1], ARGV[1], ARGV[3]) == 1 then
+	redis.call('HINCRBY', KEYS[4], ARGV[2], 1)
+end
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[5], ARGV[1])
+redis.call('SADD', KEYS[5], ARGV[6])
+return tonumber(redis.call('HGET', KEYS[4], ARGV[2]))
+`)
+
+// leaveScript removes a session and returns how many sessions its user still has in the channel
+// KEYS: sessions, expiry, active, users. ARGV: session ID, user ID
+var leaveScript = redis.NewScript(`
+local count = tonumber(redis.call('HGET', KEYS[4], ARGV[2]) or '0')
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 1 then
+	count = redis.call('HINCRBY', KEYS[4], ARGV[2], -1)
+	if count <= 0 then
+		redis.call('HDEL', KEYS[4], ARGV[2])
+		count = 0
+	end
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return count
+`)
+
+// touchScript extends a live session and optionally records activity
+// Lapsed sessions are left alone for Sweep to announce.
+// KEYS: expiry, active. ARGV: session ID, expires at, now, active ("1" or "0")
+var touchScript = redis.NewScript(`
+local expires = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not expires or tonumber(expires) <= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+if ARGV[4] == '1' then
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+// updateUserScript rewrites the name and color on a user's live sessions
+// An empty name or color clears it.
+// KEYS: sessions, expiry. ARGV: user ID, username, color, now
+var updateUserScript = redis.NewScript(`
+for _, sid in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '(' .. ARGV[4], '+inf')) do
+	local data = redis.call('HGET', KEYS[1], sid)
+	if data then
+		local session = cjson.decode(data)
+		if session.user_id == ARGV[1] then
+			session.username = ARGV[2] ~= '' and ARGV[2] or nil
+			session.color = ARGV[3] ~= '' and ARGV[3] or nil
+			redis.call('HSET', KEYS[1], sid, cjson.encode(session))
+		end
+	end
+end
+return 0
+`)
+
+// listScript returns a channel's sessions, its live session IDs, and its activity times
+// Bulk commands only; the three are joined in Go.
+// KEYS: sessions, expiry, active. ARGV: now
+var listScript = redis.NewScript(`
+return {
+	redis.call('HGETALL', KEYS[1]),
+	redis.call('ZRANGEBYSCORE', KEYS[2], '(' .. ARGV[1], '+inf'),
+	redis.call('ZRANGE', KEYS[3], 0, -1, 'WITHSCORES'),
+}
+`)
+
+// sweepScript removes a channel's lapsed sessions and returns the users left with none
+// The channel is dropped from the channel set once it has no sessions at all.
+// KEYS: sessions, expiry, active, users, channels. ARGV: now, channel ID
+var sweepScript = redis.NewScript(`
+local departed = {}
+for _, sid in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])) do
+	local data = redis.call('HGET', KEYS[1], sid)
+	if data then
+		local uid = cjson.decode(data).user_id
+		redis.call('HDEL', KEYS[1], sid)
+		if redis.call('HINCRBY', KEYS[4], uid, -1) <= 0 then
+			redis.call('HDEL', KEYS[4], uid)
+			departed[#departed + 1] = uid
+		end
+	end
+	redis.call('ZREM', KEYS[2], sid)
+	redis.call('ZREM', KEYS[3], sid)
+end
+
+if redis.call('HLEN', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[5], ARGV[2])
+end
+return departed
+`)
+
+// RedisStore keeps presence in Redis so every node sees the same channel members
+// Every operation is a single Lua script, so reads and writes take one round trip
+// however many sessions a channel has.
+//
+// Layout per channel:
+//   - chat:presence:<channel>:sessions hash of session_id -> JSON PresenceSession
+//   - chat:presence:<channel>:expiry   sorted set of session_id scored by when it lapses (ms)
+//   - chat:presence:<channel>:active   sorted set of session_id scored by last activity (ms)
+//   - chat:presence:<channel>:users    hash of user_id -> number of sessions
+//
+// A lapsed session is hidden from reads but kept, and still counted for its user, until
+// Sweep removes it. Its user's departure is announced by whichever of Leave and Sweep
+// takes their count to zero, so it is announced once whether or not the node survived.
+type RedisStore struct {
+	client *redis.Client
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// NewRedisStore creates a Redis presence store
+func NewRedisStore(client *redis.Client, logger *slog.Logger) *RedisStore {
+	return &RedisStore{
+		client: client,
+		now:    time.Now,
+		logger: logger,
+	}
+}
+
+// presenceKeys returns the keys holding a channel's sessions, expiry times, activity times and user counts
+func presenceKeys(channelID string) []string {
+	prefix := fmt.Sprintf("chat:presence:%s", channelID)
+	return []string{prefix + ":sessions", prefix + ":expiry", prefix + ":active", prefix + ":users"}
+}
+
+// Join adds a session and returns how many sessions its user now has in the channel
+func (s *RedisStore) Join(ctx context.Context, channelID string, session domain.PresenceSession) (int, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal presence session: %w", err)
+	}
+
+	now := s.now()
+	count, err := joinScript.Run(ctx, s.client,
+		append(presenceKeys(channelID), channelsKey),
+		session.SessionID, session.UserID, data, now.Add(SessionTTL).UnixMilli(), now.UnixMilli(), channelID,
+	).Int()
+	if err != nil {
+		s.logger.Error("Failed to join presence", "error", err, "channel", channelID, "session", session.SessionID)
+		return 0, err
+	}
+
+	s.logger.Debug("Joined presence", "channel", channelID, "user", session.UserID, "session", session.SessionID)
+	return count, nil
+}
+
+// Leave removes a session and returns how many sessions its user still has in the channel
+func (s *RedisStore) Leave(ctx context.Context, channelID, userID, sessionID string) (int, error) {
+	count, err := leaveScript.Run(ctx, s.client, presenceKeys(channelID), sessionID, userID).Int()
+	if err != nil {
+		s.logger.Error("Failed to leave presence", "error", err, "channel", channelID, "session", sessionID)
+		return 0, err
+	}
+
+	s.logger.Debug("Left presence", "channel", channelID, "user", userID, "session", sessionID)
+	return count, nil
+}
+
+// Touch keeps a session alive; active also records user activity
+func (s *RedisStore) Touch(ctx context.Context, channelID, sessionID string, active bool) error {
+	flag := "0"
+	if active {
+		flag = "1"
+	}
+
+	now := s.now()
+	keys := presenceKeys(channelID)
+	err := touchScript.Run(ctx, s.client,
+		keys[1:3],
+		sessionID, now.Add(SessionTTL).UnixMilli(), now.UnixMilli(), flag,
+	).Err()
+	if err != nil {
+		s.logger.Error("Failed to refresh presence", "error", err, "session", sessionID)
+		return err
+	}
+	return nil
+}
+
+// UpdateUser changes the name and color on all of a user's sessions in the channel
+func (s *RedisStore) UpdateUser(ctx context.Context, channelID, userID string, username, color *string) error {
+	var name, c string
+	if username != nil {
+		name = *username
+	}
+	if color != nil {
+		c = *color
+	}
+
+	err := updateUserScript.Run(ctx, s.client,
+		presenceKeys(channelID)[:2],
+		userID, name, c, s.now().UnixMilli(),
+	).Err()
+	if err != nil {
+		s.logger.Error("Failed to update presence", "error", err, "channel", channelID, "user", userID)
+		return err
+	}
+
+	s.logger.Debug("Updated presence", "channel", channelID, "user", userID, "username", username, "color", color)
+	return nil
+}
+
+// ListUsers returns the channel's users, one entry per user, with their status
+func (s *RedisStore) ListUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error) {
+	now := s.now()
+	result, err := listScript.Run(ctx, s.client,
+		presenceKeys(channelID)[:3],
+		now.UnixMilli(),
+	).Slice()
+	if err != nil {
+		s.logger.Error("Failed to get presence sessions", "error", err, "channel", channelID)
+		return nil, err
+	}
+	if len(result) != 3 {
+		return nil, fmt.Errorf("unexpected presence list reply of length %d", len(result))
+	}
+
+	data := replyStrings(result[0])
+	live := replyStrings(result[1])
+	activity := replyStrings(result[2])
+
+	byID := make(map[string]string, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		byID[data[i]] = data[i+1]
+	}
+	activeAt := make(map[string]int64, len(activity)/2)
+	for i := 0; i+1 < len(activity); i += 2 {
+		if score, err := strconv.ParseFloat(activity[i+1], 64); err == nil {
+			activeAt[activity[i]] = int64(score)
+		}
+	}
+
+	sessions := make([]domain.PresenceSession, 0, len(live))
+	for _, id := range live {
+		value, ok := byID[id]
+		if !ok {
+			continue
+		}
+
+		var session domain.PresenceSession
+		if err := json.Unmarshal([]byte(value), &session); err != nil {
+			s.logger.Warn("Failed to decode presence session", "error", err, "session", id)
+			continue
+		}
+		session.LastActiveAt = activeAt[id]
+		sessions = append(sessions, session)
+	}
+
+	return domain.AggregatePresence(sessions, now), nil
+}
+
+// Sweep removes lapsed sessions and returns the users left with none in their channel
+func (s *RedisStore) Sweep(ctx context.Context) ([]domain.PresenceDeparture, error) {
+	channelIDs, err := s.client.SMembers(ctx, channelsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence channels: %w", err)
+	}
+
+	now := s.now().UnixMilli()
+	var departures []domain.PresenceDeparture
+	for _, channelID := range channelIDs {
+		userIDs, err := sweepScript.Run(ctx, s.client,
+			append(presenceKeys(channelID), channelsKey),
+			now, channelID,
+		).StringSlice()
+		if err != nil {
+			// Keep sweeping the other channels; this one is retried next time
+			s.logger.Error("Failed to sweep presence channel", "error", err, "channel", channelID)
+			continue
+		}
+
+		for _, userID := range userIDs {
+			departures = append(departures, domain.PresenceDeparture{ChannelID: channelID, UserID: userID})
+		}
+	}
+
+	return departures, nil
+}
+
+// replyStrings converts an array reply from a script into strings
+func replyStrings(reply any) []string {
+	items, _ := reply.([]any)
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		str, _ := item.(string)
+		strs = append(strs, str)
+	}
+	return strs
+}
@@ -0,0 +1,112 @@
+package pubsub
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// memoryPendingMessages is the buffer between Publish and the subscriber loop
+const memoryPendingMessages = 1024
+
+// MemoryPubSub is an in-process pub/sub for running a single node without Redis
+// Messages are only delivered for rooms with a local session, like the networked
+// backends. Messages are encoded and decoded on the way through so handlers never share
+// pointers with the publisher.
+type MemoryPubSub struct {
+	logger *slog.Logger
+
+	msgs chan *domain.Message
+	mu   sync.Mutex
+	refs map[string]int
+}
+
+// NewMemoryPubSub creates an in-memory pub/sub
+func NewMemoryPubSub(logger *slog.Logger) *MemoryPubSub {
+	return &MemoryPubSub{
+		logger: logger,
+		msgs:   make(chan *domain.Message, memoryPendingMessages),
+		refs:   make(map[string]int),
+	}
+}
+
+// Publish hands a message to the subscriber if a local session is in its room
+func (p *MemoryPubSub) Publish(ctx context.Context, msg *domain.Message) error {
+	p.mu.Lock()
+	joined := p.refs[msg.ChannelID] > 0
+	p.mu.Unlock()
+
+	if !joined {
+		p.logger.Debug("Dropped message for room without local sessions", "message_id", msg.MessageID, "channel", msg.ChannelID)
+		return nil
+	}
+
+	copied, err := domain.DecodeMessage(msg.Encode())
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrPublishFailed, err)
+	}
+
+	select {
+	case p.msgs <- copied:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", domain.ErrPublishFailed, ctx.Err())
+	}
+
+	p.logger.Debug("Published message", "message_id", msg.MessageID, "channel", msg.ChannelID)
+	return nil
+}
+
+// Subscribe processes published messages with the provided handler until ctx is cancelled
+func (p *MemoryPubSub) Subscribe(ctx context.Context, handler func(*domain.Message) error) error {
+	p.logger.Info("Listening for in-memory messages")
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Subscription cancelled")
+			return ctx.Err()
+		case msg := <-p.msgs:
+			if err := handler(msg); err != nil {
+				p.logger.Error("Handler failed to process message", "error", err, "message_id", msg.MessageID)
+				// Continue processing other messages even if handler fails
+				continue
+			}
+
+			p.logger.Debug("Processed message", "message_id", msg.MessageID)
+		}
+	}
+}
+
+// JoinChannel starts delivering a room's messages for one more local session
+func (p *MemoryPubSub) JoinChannel(ctx context.Context, channelID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refs[channelID]++
+	return nil
+}
+
+// LeaveChannel stops delivering a room's messages once its last local session leaves
+func (p *MemoryPubSub) LeaveChannel(ctx context.Context, channelID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.refs[channelID] <= 1 {
+		delete(p.refs, channelID)
+		return nil
+	}
+	p.refs[channelID]--
+	return nil
+}
+
+// HealthCheck always succeeds; there is nothing to lose contact with
+func (p *MemoryPubSub) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op kept for parity with the networked backends
+func (p *MemoryPubSub) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package pubsub
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestMemoryPubSub() *MemoryPubSub {
+	return NewMemoryPubSub(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestMemoryPubSub_DeliversJoinedRooms(t *testing.T) {
+	p := newTestMemoryPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan *domain.Message, 10)
+	go p.Subscribe(ctx, func(msg *domain.Message) error {
+		received <- msg
+		return nil
+	})
+
+	// Two local sessions in room-a
+	p.JoinChannel(ctx, "room-a")
+	p.JoinChannel(ctx, "room-a")
+
+	p.Publish(ctx, domain.NewMessage("b-1", "room-b", "user-1", "hi", domain.Position{}))
+	sent := domain.NewMessage("a-1", "room-a", "user-1", "hi", domain.Position{X: 1, Y: 2})
+	p.Publish(ctx, sent)
+
+	msg := <-received
+	if *msg.MessageID != "a-1" {
+		t.Fatalf("Expected a-1, got %s", *msg.MessageID)
+	}
+	if msg == sent || msg.Position == sent.Position {
+		t.Error("Expected subscriber to get a copy of the message")
+	}
+
+	// Still delivered after one of the two sessions leaves
+	p.LeaveChannel(ctx, "room-a")
+	p.Publish(ctx, domain.NewMessage("a-2", "room-a", "user-1", "hi", domain.Position{}))
+	if msg := <-received; *msg.MessageID != "a-2" {
+		t.Fatalf("Expected a-2, got %s", *msg.MessageID)
+	}
+
+	// Dropped once the last one leaves
+	p.LeaveChannel(ctx, "room-a")
+	p.Publish(ctx, domain.NewMessage("a-3", "room-a", "user-1", "hi", domain.Position{}))
+	select {
+	case msg := <-received:
+		t.Errorf("Expected no message, got %s", *msg.MessageID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
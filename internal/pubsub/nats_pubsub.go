@@ -0,0 +1,182 @@
+package pubsub
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// natsPendingMessages is the buffer between NATS subscriptions and the subscriber loop
+	natsPendingMessages = 1024
+	// natsFlushTimeout bounds a round trip to the server when the caller set no deadline
+	natsFlushTimeout = 5 * time.Second
+)
+
+// NATSPubSub handles pub/sub over NATS core subjects
+// Each room has its own subject (prefix + channel ID); the node only subscribes to rooms
+// with at least one local session.
+type NATSPubSub struct {
+	conn   *nats.Conn
+	prefix string
+	logger *slog.Logger
+
+	msgs   chan *nats.Msg
+	mu     sync.Mutex
+	topics map[string]*natsSubscription
+}
+
+// natsSubscription tracks the local sessions using one room's subject
+type natsSubscription struct {
+	refs int
+	sub  *nats.Subscription
+}
+
+// NewNATSPubSub creates a new NATS pub/sub client
+func NewNATSPubSub(url, subjectPrefix string, logger *slog.Logger) (*NATSPubSub, error) {
+	conn, err := nats.Connect(url, nats.Name("asocial"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	logger.Info("Connected to NATS", "url", conn.ConnectedUrlRedacted())
+
+	return &NATSPubSub{
+		conn:   conn,
+		prefix: subjectPrefix,
+		logger: logger,
+		msgs:   make(chan *nats.Msg, natsPendingMessages),
+		topics: make(map[string]*natsSubscription),
+	}, nil
+}
+
+// subject returns the NATS subject for a room
+func (n *NATSPubSub) subject(channelID string) string {
+	return n.prefix + channelID
+}
+
+// Publish publishes a message to its room's subject
+func (n *NATSPubSub) Publish(ctx context.Context, msg *domain.Message) error {
+	subject := n.subject(msg.ChannelID)
+	if err := n.conn.Publish(subject, msg.Encode()); err != nil {
+		n.logger.Error("Failed to publish message", "error", err, "subject", subject)
+		return fmt.Errorf("%w: %v", domain.ErrPublishFailed, err)
+	}
+
+	n.logger.Debug("Published message", "message_id", msg.MessageID, "subject", subject)
+	return nil
+}
+
+// Subscribe processes messages from every room this node has joined with the provided handler
+func (n *NATSPubSub) Subscribe(ctx context.Context, handler func(*domain.Message) error) error {
+	n.logger.Info("Listening for room messages", "prefix", n.prefix)
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.logger.Info("Subscription cancelled", "prefix", n.prefix)
+			return ctx.Err()
+		case msg := <-n.msgs:
+			message, err := domain.DecodeMessage(msg.Data)
+			if err != nil {
+				n.logger.Error("Failed to decode message", "error", err, "subject", msg.Subject)
+				continue
+			}
+
+			if err := handler(message); err != nil {
+				n.logger.Error("Handler failed to process message", "error", err, "message_id", message.MessageID)
+				// Continue processing other messages even if handler fails
+				continue
+			}
+
+			n.logger.Debug("Processed message", "message_id", message.MessageID)
+		}
+	}
+}
+
+// JoinChannel subscribes the node to a room's subject for one more local session
+// The first session's subscription is flushed to the server before returning,
+// so messages published afterwards are delivered.
+func (n *NATSPubSub) JoinChannel(ctx context.Context, channelID string) error {
+	subject := n.subject(channelID)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if t, ok := n.topics[subject]; ok {
+		t.refs++
+		return nil
+	}
+
+	sub, err := n.conn.ChanSubscribe(subject, n.msgs)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to subject %s: %w", subject, err)
+	}
+	if err := n.flush(ctx); err != nil {
+		sub.Unsubscribe()
+		return fmt.Errorf("failed to confirm subscription to subject %s: %w", subject, err)
+	}
+
+	n.topics[subject] = &natsSubscription{refs: 1, sub: sub}
+	n.logger.Info("Subscribed to room subject", "subject", subject)
+	return nil
+}
+
+// LeaveChannel releases one local session's hold on a room's subject
+// The node unsubscribes when the last session leaves.
+func (n *NATSPubSub) LeaveChannel(ctx context.Context, channelID string) error {
+	subject := n.subject(channelID)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t, ok := n.topics[subject]
+	if !ok {
+		return nil
+	}
+
+	t.refs--
+	if t.refs > 0 {
+		return nil
+	}
+
+	delete(n.topics, subject)
+	if err := t.sub.Unsubscribe(); err != nil {
+		return fmt.Errorf("failed to unsubscribe from subject %s: %w", subject, err)
+	}
+
+	n.logger.Info("Unsubscribed from room subject", "subject", subject)
+	return nil
+}
+
+// HealthCheck checks if the NATS connection is healthy with a round trip to the server
+func (n *NATSPubSub) HealthCheck(ctx context.Context) error {
+	return n.flush(ctx)
+}
+
+// flush waits until the server has processed everything sent so far
+// nats.go refuses contexts without a deadline, so one is added if missing.
+func (n *NATSPubSub) flush(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, natsFlushTimeout)
+		defer cancel()
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+// Conn returns the underlying NATS connection for features sharing it
+func (n *NATSPubSub) Conn() *nats.Conn {
+	return n.conn
+}
+
+// Close closes the NATS connection
+func (n *NATSPubSub) Close() error {
+	n.conn.Close()
+	return nil
+}
@@ -3,23 +3,38 @@ package pubsub
 import (
 	"asocial/internal/domain"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// subscribeTimeout bounds how long JoinChannel waits for Redis to confirm a subscription
+const subscribeTimeout = 5 * time.Second
+
 // RedisPubSub handles Redis pub/sub operations
+// Each room has its own Redis channel (prefix + channel ID). The node only subscribes
+// to rooms that have at least one local session, tracked with a reference count.
 type RedisPubSub struct {
-	client  *redis.Client
-	channel string
-	logger  *slog.Logger
+	client *redis.Client
+	prefix string
+	logger *slog.Logger
+
+	sub    *redis.PubSub
+	mu     sync.Mutex
+	topics map[string]*topicSubscription
+}
+
+// topicSubscription tracks the local sessions using one room's Redis channel
+type topicSubscription struct {
+	refs  int
+	ready chan struct{} // closed once Redis confirms the subscription
 }
 
 // NewRedisPubSub creates a new Redis pub/sub client
-func NewRedisPubSub(addr, password, channel string, db int, logger *slog.Logger) (*RedisPubSub, error) {
+func NewRedisPubSub(addr, password, channelPrefix string, db int, logger *slog.Logger) (*RedisPubSub, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
@@ -35,210 +50,177 @@ func NewRedisPubSub(addr, password, channel string, db int, logger *slog.Logger)
 	logger.Info("Connected to Redis", "addr", addr, "db", db)
 
 	return &RedisPubSub{
-		client:  client,
-		channel: channel,
-		logger:  logger,
+		client: client,
+		prefix: channelPrefix,
+		logger: logger,
+		// Starts with no channels; rooms are added by JoinChannel
+		sub:    client.Subscribe(ctx),
+		topics: make(map[string]*topicSubscription),
 	}, nil
 }
 
-// Publish publishes a message to the Redis channel
+// topic returns the Redis channel for a room
+func (r *RedisPubSub) topic(channelID string) string {
+	return r.prefix + channelID
+}
+
+// Publish publishes a message to its room's Redis channel
 func (r *RedisPubSub) Publish(ctx context.Context, msg *domain.Message) error {
 	data := msg.Encode()
-	if err := r.client.Publish(ctx, r.channel, data).Err(); err != nil {
-		r.logger.Error("Failed to publish message", "error", err, "channel", r.channel)
+	topic := r.topic(msg.ChannelID)
+	if err := r.client.Publish(ctx, topic, data).Err(); err != nil {
+		r.logger.Error("Failed to publish message", "error", err, "channel", topic)
 		return fmt.Errorf("%w: %v", domain.ErrPublishFailed, err)
 	}
 
-	r.logger.Debug("Published message", "message_id", msg.MessageID, "channel", r.channel)
+	r.logger.Debug("Published message", "message_id", msg.MessageID, "channel", topic)
 	return nil
 }
 
-// Subscribe subscribes to the Redis channel and processes messages with the provided handler
+// Subscribe processes messages from every room this node has joined with the provided handler
+// Rooms joined or left while Subscribe is running take effect immediately
 func (r *RedisPubSub) Subscribe(ctx context.Context, handler func(*domain.Message) error) error {
-	pubsub := r.client.Subscribe(ctx, r.channel)
-	defer pubsub.Close()
+	r.logger.Info("Listening for room messages", "prefix", r.prefix)
 
-	// Wait for confirmation that subscription is created
-	if _, err := pubsub.Receive(ctx); err != nil {
-		return fmt.Errorf("failed to subscribe to channel %s: %w", r.channel, err)
-	}
-
-	r.logger.Info("Subscribed to Redis channel", "channel", r.channel)
-
-	// Get channel for receiving messages
-	ch := pubsub.Channel()
+	// Subscription confirmations are needed to release JoinChannel callers
+	ch := r.sub.ChannelWithSubscriptions()
 
 	for {
 		select {
 		case <-ctx.Done():
-			r.logger.Info("Subscription cancelled", "channel", r.channel)
+			r.logger.Info("Subscription cancelled", "prefix", r.prefix)
 			return ctx.Err()
-		case msg, ok := <-ch:
+		case received, ok := <-ch:
 			if !ok {
 				r.logger.Warn("Redis channel closed")
 				return nil
 			}
 
-			message, err := domain.DecodeMessage([]byte(msg.Payload))
-			if err != nil {
-				r.logger.Error("Failed to decode message", "error", err, "payload", msg.Payload)
-				continue
-			}
+			switch msg := received.(type) {
+			case *redis.Subscription:
+				if msg.Kind == "subscribe" {
+					r.markReady(msg.Channel)
+				}
+			case *redis.Message:
+				message, err := domain.DecodeMessage([]byte(msg.Payload))
+				if err != nil {
+					r.logger.Error("Failed to decode message", "error", err, "payload", msg.Payload)
+					continue
+				}
 
-			if err := handler(message); err != nil {
-				r.logger.Error("Handler failed to process message", "error", err, "message_id", message.MessageID)
-				// Continue processing other messages even if handler fails
-				continue
-			}
+				if err := handler(message); err != nil {
+					r.logger.Error("Handler failed to process message", "error", err, "message_id", message.MessageID)
+					// Continue processing other messages even if handler fails
+					continue
+				}
 
-			r.logger.Debug("Processed message", "message_id", message.MessageID)
+				r.logger.Debug("Processed message", "message_id", message.MessageID)
+			}
 		}
 	}
 }
 
-// HealthCheck checks if Redis connection is healthy
-func (r *RedisPubSub) HealthCheck(ctx context.Context) error {
-	return r.client.Ping(ctx).Err()
-}
-
-// Close closes the Redis client connection
-func (r *RedisPubSub) Close() error {
-	return r.client.Close()
-}
+// JoinChannel subscribes the node to a room's Redis channel for one more local session
+// Only the first session triggers a Redis SUBSCRIBE; it returns once Redis has confirmed it,
+// so messages published afterwards are guaranteed to be delivered.
+// Subscribe must be running for the confirmation to arrive.
+func (r *RedisPubSub) JoinChannel(ctx context.Context, channelID string) error {
+	topic := r.topic(channelID)
+
+	r.mu.Lock()
+	t, ok := r.topics[topic]
+	if !ok {
+		t = &topicSubscription{ready: make(chan struct{})}
+		r.topics[topic] = t
+		if err := r.sub.Subscribe(ctx, topic); err != nil {
+			delete(r.topics, topic)
+			r.mu.Unlock()
+			return fmt.Errorf("failed to subscribe to channel %s: %w", topic, err)
+		}
+		r.logger.Info("Subscribed to room channel", "channel", topic)
+	}
+	t.refs++
+	r.mu.Unlock()
+
+	timer := time.NewTimer(subscribeTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = fmt.Errorf("timed out waiting for subscription to channel %s", topic)
+	}
 
-// UserData represents user data stored in Redis
-type UserData struct {
-	Username string `json:"username,omitempty"`
-	Color    string `json:"color,omitempty"`
+	// Callers only leave channels they joined, so a failed join gives its hold back here
+	if leaveErr := r.LeaveChannel(context.Background(), channelID); leaveErr != nil {
+		r.logger.Warn("Failed to release channel after failed join", "error", leaveErr, "channel", topic)
+	}
+	return err
 }
 
-// AddUserToChannel adds a user to a channel's active users set with TTL and optional username and color
-func (r *RedisPubSub) AddUserToChannel(ctx context.Context, channelID, userID string, username, color *string) error {
-	key := fmt.Sprintf("chat:channel:%s:users", channelID)
-	memberKey := fmt.Sprintf("chat:user:%s:%s", channelID, userID)
+// LeaveChannel releases one local session's hold on a room's Redis channel
+// The node unsubscribes when the last session leaves.
+func (r *RedisPubSub) LeaveChannel(ctx context.Context, channelID string) error {
+	topic := r.topic(channelID)
 
-	// Add user to the channel's user set
-	if err := r.client.SAdd(ctx, key, userID).Err(); err != nil {
-		r.logger.Error("Failed to add user to channel", "error", err, "channel", channelID, "user", userID)
-		return err
-	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// Store username and color as JSON
-	userData := UserData{}
-	if username != nil && *username != "" {
-		userData.Username = *username
-	}
-	if color != nil && *color != "" {
-		userData.Color = *color
+	t, ok := r.topics[topic]
+	if !ok {
+		return nil
 	}
 
-	var value string
-	// If both are empty, use simple marker for backwards compatibility
-	if userData.Username == "" && userData.Color == "" {
-		value = "1"
-	} else {
-		jsonData, err := json.Marshal(userData)
-		if err != nil {
-			r.logger.Error("Failed to marshal user data", "error", err, "user", userID)
-			value = "1" // Fallback
-		} else {
-			value = string(jsonData)
-		}
+	t.refs--
+	if t.refs > 0 {
+		return nil
 	}
 
-	// Set TTL on the member key (5 minutes, refreshed by heartbeat)
-	if err := r.client.SetEx(ctx, memberKey, value, 5*time.Minute).Err(); err != nil {
-		r.logger.Error("Failed to set TTL for user", "error", err, "user", userID)
-		return err
+	delete(r.topics, topic)
+	if err := r.sub.Unsubscribe(ctx, topic); err != nil {
+		return fmt.Errorf("failed to unsubscribe from channel %s: %w", topic, err)
 	}
 
-	r.logger.Debug("Added user to channel", "channel", channelID, "user", userID, "username", username, "color", color)
+	r.logger.Info("Unsubscribed from room channel", "channel", topic)
 	return nil
 }
 
-// RemoveUserFromChannel removes a user from a channel's active users set
-func (r *RedisPubSub) RemoveUserFromChannel(ctx context.Context, channelID, userID string) error {
-	key := fmt.Sprintf("chat:channel:%s:users", channelID)
-	memberKey := fmt.Sprintf("chat:user:%s:%s", channelID, userID)
+// markReady releases JoinChannel callers waiting on a confirmed subscription
+// Redis repeats confirmations after a reconnect, so already-ready topics are skipped.
+func (r *RedisPubSub) markReady(topic string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// Remove user from the set
-	if err := r.client.SRem(ctx, key, userID).Err(); err != nil {
-		r.logger.Error("Failed to remove user from channel", "error", err, "channel", channelID, "user", userID)
-		return err
+	t, ok := r.topics[topic]
+	if !ok {
+		return
 	}
 
-	// Delete the member TTL key
-	if err := r.client.Del(ctx, memberKey).Err(); err != nil {
-		r.logger.Error("Failed to delete user TTL key", "error", err, "user", userID)
-		return err
+	select {
+	case <-t.ready:
+	default:
+		close(t.ready)
 	}
-
-	r.logger.Debug("Removed user from channel", "channel", channelID, "user", userID)
-	return nil
 }
 
-// RefreshUserPresence refreshes the TTL for a user's presence
-func (r *RedisPubSub) RefreshUserPresence(ctx context.Context, channelID, userID string) error {
-	memberKey := fmt.Sprintf("chat:user:%s:%s", channelID, userID)
-
-	// Refresh TTL (5 minutes)
-	if err := r.client.Expire(ctx, memberKey, 5*time.Minute).Err(); err != nil {
-		r.logger.Error("Failed to refresh user presence", "error", err, "user", userID)
-		return err
-	}
-
-	r.logger.Debug("Refreshed user presence", "channel", channelID, "user", userID)
-	return nil
+// HealthCheck checks if Redis connection is healthy
+func (r *RedisPubSub) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
 }
 
-// GetChannelUsers returns all active users in a channel with their usernames and colors
-func (r *RedisPubSub) GetChannelUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error) {
-	key := fmt.Sprintf("chat:channel:%s:users", channelID)
-
-	userIDs, err := r.client.SMembers(ctx, key).Result()
-	if err != nil {
-		r.logger.Error("Failed to get channel users", "error", err, "channel", channelID)
-		return nil, err
-	}
-
-	// Clean up users whose TTL has expired and collect user info
-	var users []domain.UserInfo
-	for _, userID := range userIDs {
-		memberKey := fmt.Sprintf("chat:user:%s:%s", channelID, userID)
-		value, err := r.client.Get(ctx, memberKey).Result()
-		if err != nil {
-			// User's TTL expired, remove from set
-			r.client.SRem(ctx, key, userID)
-			continue
-		}
-
-		// Parse username and color from value
-		var username *string
-		var color *string
-
-		if value != "1" && value != "" {
-			// Try to parse as JSON
-			var userData UserData
-			if err := json.Unmarshal([]byte(value), &userData); err == nil {
-				// Successfully parsed JSON
-				if userData.Username != "" {
-					username = &userData.Username
-				}
-				if userData.Color != "" {
-					color = &userData.Color
-				}
-			} else {
-				// Old format: just username string
-				username = &value
-			}
-		}
+// Client returns the underlying Redis client for features sharing the connection
+func (r *RedisPubSub) Client() *redis.Client {
+	return r.client
+}
 
-		users = append(users, domain.UserInfo{
-			UserID:   userID,
-			Username: username,
-			Color:    color,
-		})
+// Close closes the subscription and the Redis client connection
+func (r *RedisPubSub) Close() error {
+	if err := r.sub.Close(); err != nil {
+		r.logger.Warn("Failed to close Redis subscription", "error", err)
 	}
-
-	return users, nil
+	return r.client.Close()
 }
@@ -0,0 +1,317 @@
+package pubsub
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamBlock is how long one XREAD waits for new entries; rooms joined meanwhile are picked up after it
+	streamBlock = 500 * time.Millisecond
+	// streamReadCount bounds the entries read per stream in one XREAD
+	streamReadCount = 100
+	// streamRetryDelay is the pause before reading again after a Redis error
+	streamRetryDelay = time.Second
+)
+
+// RedisStreams delivers messages through one Redis stream per room
+// Unlike pub/sub, entries stay in the stream (trimmed to roughly maxLen), so a subscriber
+// that drops off resumes from the last entry it processed instead of losing messages.
+// Positions are only kept in memory: a restarted node has no sessions to deliver old
+// entries to, so it starts from the end of each stream. Delivery is at-least-once.
+type RedisStreams struct {
+	client *redis.Client
+	prefix string
+	maxLen int64
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	streams map[string]*streamSubscription
+	wake    chan struct{}
+}
+
+// streamSubscription tracks the local sessions reading one room's stream
+type streamSubscription struct {
+	refs   int
+	lastID string // last entry handed to the subscriber
+}
+
+// NewRedisStreams creates a new Redis Streams client
+func NewRedisStreams(addr, password, streamPrefix string, db int, maxLen int64, logger *slog.Logger) (*RedisStreams, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	// Test connection
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	logger.Info("Connected to Redis", "addr", addr, "db", db)
+
+	return &RedisStreams{
+		client:  client,
+		prefix:  streamPrefix,
+		maxLen:  maxLen,
+		logger:  logger,
+		streams: make(map[string]*streamSubscription),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// stream returns the Redis stream key for a room
+func (r *RedisStreams) stream(channelID string) string {
+	return r.prefix + channelID
+}
+
+// Publish appends a message to its room's stream
+func (r *RedisStreams) Publish(ctx context.Context, msg *domain.Message) error {
+	key := r.stream(msg.ChannelID)
+	err := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: r.maxLen,
+		Approx: true,
+		Values: map[string]any{"data": msg.Encode()},
+	}).Err()
+	if err != nil {
+		r.logger.Error("Failed to publish message", "error", err, "stream", key)
+		return fmt.Errorf("%w: %v", domain.ErrPublishFailed, err)
+	}
+
+	r.logger.Debug("Published message", "message_id", msg.MessageID, "stream", key)
+	return nil
+}
+
+// Subscribe reads every room this node has joined and processes entries with the provided handler
+// Each delivered message carries its stream entry ID, which clients can pass to Replay.
+func (r *RedisStreams) Subscribe(ctx context.Context, handler func(*domain.Message) error) error {
+	r.logger.Info("Reading room streams", "prefix", r.prefix)
+
+	for {
+		keys, ids := r.positions()
+		if len(keys) == 0 {
+			// Nothing to read until a local session joins a room
+			select {
+			case <-ctx.Done():
+				r.logger.Info("Subscription cancelled", "prefix", r.prefix)
+				return ctx.Err()
+			case <-r.wake:
+				continue
+			}
+		}
+
+		result, err := r.client.XRead(ctx, &redis.XReadArgs{
+			Streams: append(keys, ids...),
+			Count:   streamReadCount,
+			Block:   streamBlock,
+		}).Result()
+		if ctx.Err() != nil {
+			r.logger.Info("Subscription cancelled", "prefix", r.prefix)
+			return ctx.Err()
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			// The next read resumes where this one failed
+			r.logger.Error("Failed to read streams", "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(streamRetryDelay):
+			}
+			continue
+		}
+
+		advanced := make(map[string]string, len(result))
+		for _, stream := range result {
+			for _, entry := range stream.Messages {
+				r.deliver(entry, handler)
+				advanced[stream.Stream] = entry.ID
+			}
+		}
+
+		r.advance(advanced)
+	}
+}
+
+// deliver decodes one stream entry and hands it to the handler
+func (r *RedisStreams) deliver(entry redis.XMessage, handler func(*domain.Message) error) {
+	message, err := decodeEntry(entry)
+	if err != nil {
+		r.logger.Error("Failed to decode message", "error", err, "id", entry.ID)
+		return
+	}
+
+	if err := handler(message); err != nil {
+		r.logger.Error("Handler failed to process message", "error", err, "message_id", message.MessageID)
+		// Continue processing other messages even if handler fails
+		return
+	}
+
+	r.logger.Debug("Processed message", "message_id", message.MessageID, "id", entry.ID)
+}
+
+// positions returns the joined streams and the ID to read each one after
+func (r *RedisStreams) positions() (keys, ids []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, s := range r.streams {
+		keys = append(keys, key)
+		ids = append(ids, s.lastID)
+	}
+	return keys, ids
+}
+
+// advance records processed entries
+// Streams left while the batch was processed are skipped, so a rejoin starts afresh.
+func (r *RedisStreams) advance(advanced map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, id := range advanced {
+		if s, ok := r.streams[key]; ok {
+			s.lastID = id
+		}
+	}
+}
+
+// JoinChannel starts reading a room's stream for one more local session
+// The first session starts from the current end of the stream, so messages published
+// afterwards are delivered.
+func (r *RedisStreams) JoinChannel(ctx context.Context, channelID string) error {
+	key := r.stream(channelID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.streams[key]; ok {
+		s.refs++
+		return nil
+	}
+
+	lastID, err := r.startID(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	r.streams[key] = &streamSubscription{refs: 1, lastID: lastID}
+	r.logger.Info("Reading room stream", "stream", key, "from", lastID)
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// startID returns where a newly joined stream should be read from
+func (r *RedisStreams) startID(ctx context.Context, key string) (string, error) {
+	latest, err := r.client.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to read end of stream %s: %w", key, err)
+	}
+	if len(latest) == 0 {
+		return "0-0", nil
+	}
+	return latest[0].ID, nil
+}
+
+// LeaveChannel releases one local session's hold on a room's stream
+// When the last session leaves, the node stops reading it and forgets its position,
+// so a later join doesn't replay what happened while nobody here was listening.
+func (r *RedisStreams) LeaveChannel(ctx context.Context, channelID string) error {
+	key := r.stream(channelID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.streams[key]
+	if !ok {
+		return nil
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(r.streams, key)
+	r.logger.Info("Stopped reading room stream", "stream", key)
+	return nil
+}
+
+// Replay returns up to limit messages of a room published after the given entry ID, oldest first
+func (r *RedisStreams) Replay(ctx context.Context, channelID, since string, limit int) ([]*domain.Message, error) {
+	key := r.stream(channelID)
+
+	// XRANGE is inclusive, so fetch one extra in case the first entry is since itself
+	entries, err := r.client.XRangeN(ctx, key, since, "+", int64(limit)+1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream %s: %w", key, err)
+	}
+
+	messages := make([]*domain.Message, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ID == since {
+			continue
+		}
+		if len(messages) == limit {
+			break
+		}
+
+		message, err := decodeEntry(entry)
+		if err != nil {
+			r.logger.Error("Failed to decode message", "error", err, "id", entry.ID)
+			continue
+		}
+		// Past cursor positions are of no use to a client catching up
+		if message.Type == domain.MessageTypeCursorMoved {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// HealthCheck checks if Redis connection is healthy
+func (r *RedisStreams) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Client returns the underlying Redis client for features sharing the connection
+func (r *RedisStreams) Client() *redis.Client {
+	return r.client
+}
+
+// Close closes the Redis client connection
+func (r *RedisStreams) Close() error {
+	return r.client.Close()
+}
+
+// decodeEntry decodes the message stored in a stream entry and stamps it with the entry ID
+func decodeEntry(entry redis.XMessage) (*domain.Message, error) {
+	data, ok := entry.Values["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("stream entry %s has no data", entry.ID)
+	}
+
+	message, err := domain.DecodeMessage([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	message.StreamID = entry.ID
+	return message, nil
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps token buckets in process memory
+// Each node counts on its own, so it suits single-node mode.
+type MemoryLimiter struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+// memoryBucket is a bucket's tokens when it was last drawn from
+type memoryBucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Time // When the bucket is full again and can be forgotten
+}
+
+// NewMemoryLimiter creates an in-memory limiter
+// now drives refills; nil uses the wall clock.
+func NewMemoryLimiter(now func() time.Time) *MemoryLimiter {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryLimiter{
+		now:     now,
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+// Take removes a token from each bucket if every one has a token
+// Otherwise nothing is taken, and retryAfter is how long until they all have one.
+func (l *MemoryLimiter) Take(ctx context.Context, buckets []domain.TokenBucket) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+
+	tokens := make([]float64, len(buckets))
+	var retryAfter time.Duration
+	for i, bucket := range buckets {
+		tokens[i] = float64(bucket.Limit.Burst)
+		if b, ok := l.buckets[bucket.Key]; ok {
+			tokens[i] = refill(b.tokens, now.Sub(b.at), bucket.Limit)
+		}
+		retryAfter = max(retryAfter, waitFor(tokens[i], bucket.Limit))
+	}
+	if retryAfter > 0 {
+		return false, retryAfter, nil
+	}
+
+	for i, bucket := range buckets {
+		left := tokens[i] - 1
+		l.buckets[bucket.Key] = &memoryBucket{
+			tokens: left,
+			at:     now,
+			full:   now.Add(time.Duration((float64(bucket.Limit.Burst) - left) / bucket.Limit.Rate * float64(time.Second))),
+		}
+	}
+	return true, 0, nil
+}
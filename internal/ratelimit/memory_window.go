@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryWindowLimiter keeps sliding windows in process memory
+// Each node counts on its own, so it suits single-node mode.
+type MemoryWindowLimiter struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+}
+
+// memoryWindow is when a window's counted requests were made, oldest first
+type memoryWindow struct {
+	hits    []time.Time
+	expires time.Time // When the newest request leaves and the window can be forgotten
+}
+
+// NewMemoryWindowLimiter creates an in-memory sliding window limiter
+// now drives the windows; nil uses the wall clock.
+func NewMemoryWindowLimiter(now func() time.Time) *MemoryWindowLimiter {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryWindowLimiter{
+		now:     now,
+		windows: make(map[string]*memoryWindow),
+	}
+}
+
+// Hit counts a request in every window if each has room for it
+// Otherwise it is counted in none, and the usage says how long until there is room.
+func (l *MemoryWindowLimiter) Hit(ctx context.Context, windows []domain.SlidingWindow) (domain.WindowUsage, error) {
+	if len(windows) == 0 {
+		return domain.WindowUsage{Allowed: true}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, w := range l.windows {
+		if !now.Before(w.expires) {
+			delete(l.windows, key)
+		}
+	}
+
+	allowed := true
+	current := make([]*memoryWindow, len(windows))
+	for i, window := range windows {
+		w, ok := l.windows[window.Key]
+		if !ok {
+			w = &memoryWindow{}
+		}
+
+		// Drop the requests that left the window
+		start := now.Add(-window.Limit.Window)
+		kept := 0
+		for kept < len(w.hits) && !w.hits[kept].After(start) {
+			kept++
+		}
+		w.hits = w.hits[kept:]
+
+		current[i] = w
+		if len(w.hits) >= window.Limit.Limit {
+			allowed = false
+		}
+	}
+
+	counts := make([]int, len(windows))
+	resets := make([]time.Duration, len(windows))
+	for i, window := range windows {
+		w := current[i]
+		if allowed {
+			w.hits = append(w.hits, now)
+			w.expires = now.Add(window.Limit.Window)
+			l.windows[window.Key] = w
+		}
+
+		counts[i] = len(w.hits)
+		resets[i] = window.Limit.Window
+		if len(w.hits) > 0 {
+			resets[i] = w.hits[0].Add(window.Limit.Window).Sub(now)
+		}
+	}
+
+	return windowUsage(windows, allowed, counts, resets), nil
+}
@@ -0,0 +1,35 @@
+// Package ratelimit keeps token buckets that bound how often clients may send frames,
+// and sliding windows that bound how often they may call the REST API.
+package ratelimit
+
+import (
+	"asocial/internal/domain"
+	"math"
+	"time"
+)
+
+// refill returns a bucket's tokens after elapsed time, capped at its burst
+func refill(tokens float64, elapsed time.Duration, limit domain.RateLimit) float64 {
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// waitFor returns how long a bucket holding tokens takes to have one
+func waitFor(tokens float64, limit domain.RateLimit) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+}
+
+// windowUsage picks the window with the least room left to report a request against
+// counts and resets hold each window's requests after this one, and how long until its oldest leaves.
+func windowUsage(windows []domain.SlidingWindow, allowed bool, counts []int, resets []time.Duration) domain.WindowUsage {
+	usage := domain.WindowUsage{Allowed: allowed, Remaining: -1}
+	for i, window := range windows {
+		remaining := max(0, window.Limit.Limit-counts[i])
+		if usage.Remaining < 0 || remaining < usage.Remaining || (remaining == usage.Remaining && resets[i] > usage.Reset) {
+			usage.Limit, usage.Remaining, usage.Reset = window.Limit.Limit, remaining, resets[i]
+		}
+	}
+	return usage
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript draws a token from every bucket, or from none if any is empty
+// KEYS: one per bucket. ARGV: now (ms), then rate (per second) and burst per bucket.
+// Each key is a hash of its tokens and when they were counted, kept until it would be full again.
+// Returns 0 when the tokens were taken, otherwise the milliseconds until they all have one.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local tokens = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+	local state = redis.call('HMGET', key, 'tokens', 'at')
+	local t = burst
+	if state[1] then
+		local elapsed = math.max(0, now - tonumber(state[2]))
+		t = math.min(burst, tonumber(state[1]) + elapsed * rate / 1000)
+	end
+	tokens[i] = t
+	if t < 1 then
+		wait = math.max(wait, math.ceil((1 - t) * 1000 / rate))
+	end
+end
+if wait > 0 then
+	return wait
+end
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+	local left = tokens[i] - 1
+	redis.call('HSET', key, 'tokens', tostring(left), 'at', now)
+	redis.call('PEXPIRE', key, math.ceil((burst - left) * 1000 / rate))
+end
+return 0
+`)
+
+// RedisLimiter keeps token buckets in Redis so every node draws from the same budgets
+// Buckets are chat:ratelimit:<key> hashes. Each draw is one script call however many
+// buckets it covers, so all of them are checked and drawn from atomically.
+type RedisLimiter struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewRedisLimiter creates a Redis limiter
+// now drives refills; nil uses the wall clock. Nodes' clocks should roughly agree.
+func NewRedisLimiter(client *redis.Client, now func() time.Time) *RedisLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &RedisLimiter{client: client, now: now}
+}
+
+// bucketKey returns the key holding a bucket
+func bucketKey(key string) string {
+	return fmt.Sprintf("chat:ratelimit:%s", key)
+}
+
+// Take removes a token from each bucket if every one has a token
+// Otherwise nothing is taken, and retryAfter is how long until they all have one.
+func (l *RedisLimiter) Take(ctx context.Context, buckets []domain.TokenBucket) (bool, time.Duration, error) {
+	if len(buckets) == 0 {
+		return true, 0, nil
+	}
+
+	keys := make([]string, len(buckets))
+	args := make([]any, 0, 1+2*len(buckets))
+	args = append(args, l.now().UnixMilli())
+	for i, bucket := range buckets {
+		keys[i] = bucketKey(bucket.Key)
+		args = append(args, bucket.Limit.Rate, bucket.Limit.Burst)
+	}
+
+	wait, err := takeScript.Run(ctx, l.client, keys, args...).Int64()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take rate limit tokens: %w", err)
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
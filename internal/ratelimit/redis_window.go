@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// hitScript counts a request in every window, or in none if any is full
+// KEYS: one per window. ARGV: now (ms), a unique member for the request, then window (ms) and limit per window.
+// Each key is a sorted set of its requests scored by when they were made, kept until the newest leaves.
+// Returns 1 or 0 for whether the request was counted, then each window's count and ms until its oldest request leaves.
+var hitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local counts = {}
+local allowed = 1
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[i * 2 + 1])
+	local limit = tonumber(ARGV[i * 2 + 2])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	counts[i] = redis.call('ZCARD', key)
+	if counts[i] >= limit then
+		allowed = 0
+	end
+end
+local result = {allowed}
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[i * 2 + 1])
+	if allowed == 1 then
+		redis.call('ZADD', key, now, member)
+		redis.call('PEXPIRE', key, window)
+		counts[i] = counts[i] + 1
+	end
+	local reset = window
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+	table.insert(result, counts[i])
+	table.insert(result, reset)
+end
+return result
+`)
+
+// RedisWindowLimiter keeps sliding windows in Redis so every node counts the same requests
+// Windows are chat:ratelimit:http:<key> sorted sets. Each request is one script call however
+// many windows it is counted in, so all of them are checked and counted in atomically.
+type RedisWindowLimiter struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewRedisWindowLimiter creates a Redis sliding window limiter
+// now drives the windows; nil uses the wall clock. Nodes' clocks should roughly agree.
+func NewRedisWindowLimiter(client *redis.Client, now func() time.Time) *RedisWindowLimiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &RedisWindowLimiter{client: client, now: now}
+}
+
+// windowKey returns the key holding a sliding window
+func windowKey(key string) string {
+	return fmt.Sprintf("chat:ratelimit:http:%s", key)
+}
+
+// Hit counts a request in every window if each has room for it
+// Otherwise it is counted in none, and the usage says how long until there is room.
+func (l *RedisWindowLimiter) Hit(ctx context.Context, windows []domain.SlidingWindow) (domain.WindowUsage, error) {
+	if len(windows) == 0 {
+		return domain.WindowUsage{Allowed: true}, nil
+	}
+
+	keys := make([]string, len(windows))
+	args := make([]any, 0, 2+2*len(windows))
+	args = append(args, l.now().UnixMilli(), uuid.NewString())
+	for i, window := range windows {
+		keys[i] = windowKey(window.Key)
+		args = append(args, window.Limit.Window.Milliseconds(), window.Limit.Limit)
+	}
+
+	result, err := hitScript.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return domain.WindowUsage{}, fmt.Errorf("failed to count request: %w", err)
+	}
+	if len(result) != 1+2*len(windows) {
+		return domain.WindowUsage{}, fmt.Errorf("failed to count request: unexpected script result %v", result)
+	}
+
+	counts := make([]int, len(windows))
+	resets := make([]time.Duration, len(windows))
+	for i := range windows {
+		counts[i] = int(result[1+2*i])
+		resets[i] = time.Duration(result[2+2*i]) * time.Millisecond
+	}
+	return windowUsage(windows, result[0] == 1, counts, resets), nil
+}
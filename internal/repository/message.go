@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageRepository handles message history database operations
+type MessageRepository struct {
+	db *sql.DB
+}
+
+// NewMessageRepository creates a new message repository
+func NewMessageRepository(db *sql.DB) *MessageRepository {
+	return &MessageRepository{db: db}
+}
+
+// Save inserts a committed message, or updates it if the author commits it again
+// Message IDs are chosen by clients, so a message is keyed by room, author and ID; a
+// client reusing someone else's ID saves a message of its own instead of overwriting theirs
+func (r *MessageRepository) Save(ctx context.Context, msg *domain.ChatMessage) error {
+	now := time.Now()
+
+	query := `
+		INSERT INTO messages (id, room_id, user_id, username, color, payload, pos_x, pos_y, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (room_id, user_id, id)
+		DO UPDATE SET
+			username = EXCLUDED.username,
+			color = EXCLUDED.color,
+			payload = EXCLUDED.payload,
+			pos_x = EXCLUDED.pos_x,
+			pos_y = EXCLUDED.pos_y,
+			updated_at = EXCLUDED.updated_at
+		RETURNING seq, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		msg.ID,
+		msg.RoomID,
+		msg.UserID,
+		msg.Username,
+		msg.Color,
+		msg.Payload,
+		msg.Position.X,
+		msg.Position.Y,
+		now,
+	).Scan(
+		&msg.Seq,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	return nil
+}
+
+// ListByRoom retrieves a page of a room's messages, newest first
+func (r *MessageRepository) ListByRoom(ctx context.Context, params domain.ListMessagesParams) ([]*domain.ChatMessage, error) {
+	conditions := []string{"room_id = $1"}
+	args := []any{params.RoomID}
+
+	if params.Before != nil {
+		args = append(args, *params.Before)
+		conditions = append(conditions, fmt.Sprintf("seq < $%d", len(args)))
+	}
+
+	if params.Bounds != nil {
+		args = append(args, params.Bounds.MinX, params.Bounds.MaxX, params.Bounds.MinY, params.Bounds.MaxY)
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("pos_x BETWEEN $%d AND $%d AND pos_y BETWEEN $%d AND $%d", n-3, n-2, n-1, n))
+	}
+
+	args = append(args, params.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, seq, room_id, user_id, username, color, payload, pos_x, pos_y, created_at, updated_at
+		FROM messages
+		WHERE %s
+		ORDER BY seq DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// ListUpdatedSince retrieves a room's messages edited at or after the given time, oldest edit first
+func (r *MessageRepository) ListUpdatedSince(ctx context.Context, roomID uuid.UUID, since time.Time, limit int) ([]*domain.ChatMessage, error) {
+	query := `
+		SELECT id, seq, room_id, user_id, username, color, payload, pos_x, pos_y, created_at, updated_at
+		FROM messages
+		WHERE room_id = $1 AND updated_at >= $2
+		ORDER BY updated_at ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, roomID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// scanMessages scans message rows
+func scanMessages(rows *sql.Rows) ([]*domain.ChatMessage, error) {
+	var messages []*domain.ChatMessage
+	for rows.Next() {
+		msg := &domain.ChatMessage{}
+		err := rows.Scan(
+			&msg.ID,
+			&msg.Seq,
+			&msg.RoomID,
+			&msg.UserID,
+			&msg.Username,
+			&msg.Color,
+			&msg.Payload,
+			&msg.Position.X,
+			&msg.Position.Y,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
@@ -4,12 +4,17 @@ import (
 	"asocial/internal/domain"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// uniqueViolation is Postgres' error code for a duplicate key, e.g. a room slug
+const uniqueViolation = "23505"
+
 // RoomRepository handles room-related database operations
 type RoomRepository struct {
 	db *sql.DB
@@ -21,6 +26,7 @@ func NewRoomRepository(db *sql.DB) *RoomRepository {
 }
 
 // Create creates a new room
+// The owner, if any, becomes a member of it with the owner role.
 func (r *RoomRepository) Create(ctx context.Context, params domain.CreateRoomParams) (*domain.Room, error) {
 	room := &domain.Room{
 		ID:          uuid.New(),
@@ -34,9 +40,15 @@ func (r *RoomRepository) Create(ctx context.Context, params domain.CreateRoomPar
 	}
 
 	query := `
-		INSERT INTO rooms (id, name, slug, description, owner_id, is_public, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, name, slug, description, owner_id, is_public, created_at, updated_at
+		WITH room AS (
+			INSERT INTO rooms (id, name, slug, description, owner_id, is_public, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, name, slug, description, owner_id, is_public, created_at, updated_at
+		), owner AS (
+			INSERT INTO room_members (room_id, user_id, role, created_at)
+			SELECT id, owner_id, 'owner', created_at FROM room WHERE owner_id IS NOT NULL
+		)
+		SELECT id, name, slug, description, owner_id, is_public, created_at, updated_at FROM room
 	`
 
 	err := r.db.QueryRowContext(
@@ -61,6 +73,10 @@ func (r *RoomRepository) Create(ctx context.Context, params domain.CreateRoomPar
 		&room.UpdatedAt,
 	)
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return nil, fmt.Errorf("failed to create room: %w", domain.ErrRoomSlugTaken)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create room: %w", err)
 	}
@@ -205,6 +221,46 @@ func (r *RoomRepository) ListUserRooms(ctx context.Context, userID uuid.UUID) ([
 	return rooms, nil
 }
 
+// ListByIDs retrieves the rooms with the given IDs; IDs without a room are skipped
+func (r *RoomRepository) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*domain.Room, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, name, slug, description, owner_id, is_public, created_at, updated_at
+		FROM rooms
+		WHERE id = ANY($1)
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rooms by id: %w", err)
+	}
+	defer rows.Close()
+
+	var rooms []*domain.Room
+	for rows.Next() {
+		room := &domain.Room{}
+		err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Slug,
+			&room.Description,
+			&room.OwnerID,
+			&room.IsPublic,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room: %w", err)
+		}
+		rooms = append(rooms, room)
+	}
+
+	return rooms, nil
+}
+
 // Update updates a room
 func (r *RoomRepository) Update(ctx context.Context, id uuid.UUID, name, description *string, isPublic *bool) error {
 	query := `
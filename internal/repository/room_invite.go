@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomInviteRepository handles room invite-related database operations
+type RoomInviteRepository struct {
+	db *sql.DB
+}
+
+// NewRoomInviteRepository creates a new room invite repository
+func NewRoomInviteRepository(db *sql.DB) *RoomInviteRepository {
+	return &RoomInviteRepository{db: db}
+}
+
+// Create creates a new room invite
+func (r *RoomInviteRepository) Create(ctx context.Context, params domain.CreateRoomInviteParams) (*domain.RoomInvite, error) {
+	invite := &domain.RoomInvite{
+		ID:        uuid.New(),
+		RoomID:    params.RoomID,
+		CreatedBy: &params.CreatedBy,
+		Role:      params.Role,
+		MaxUses:   params.MaxUses,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	query := `
+		INSERT INTO room_invites (id, room_id, created_by, role, max_uses, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		invite.ID,
+		invite.RoomID,
+		invite.CreatedBy,
+		invite.Role,
+		invite.MaxUses,
+		invite.ExpiresAt,
+		invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create room invite: %w", err)
+	}
+
+	return invite, nil
+}
+
+// ListActive retrieves a room's invites that are neither revoked, expired nor used up, newest first
+func (r *RoomInviteRepository) ListActive(ctx context.Context, roomID uuid.UUID) ([]*domain.RoomInvite, error) {
+	query := `
+		SELECT id, room_id, created_by, role, max_uses, uses, expires_at, revoked_at, created_at
+		FROM room_invites
+		WHERE room_id = $1 AND revoked_at IS NULL AND expires_at > $2
+			AND (max_uses IS NULL OR uses < max_uses)
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, roomID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*domain.RoomInvite
+	for rows.Next() {
+		invite := &domain.RoomInvite{}
+		err := rows.Scan(
+			&invite.ID,
+			&invite.RoomID,
+			&invite.CreatedBy,
+			&invite.Role,
+			&invite.MaxUses,
+			&invite.Uses,
+			&invite.ExpiresAt,
+			&invite.RevokedAt,
+			&invite.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+// Revoke stops a room's invite from being redeemed
+// It reports whether the room had an unrevoked invite with that ID.
+func (r *RoomInviteRepository) Revoke(ctx context.Context, roomID, inviteID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE room_invites
+		SET revoked_at = $3
+		WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, inviteID, roomID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke room invite: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke room invite: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// Redeem makes a user a member of the invite's room with the invite's role, using up one of its uses
+// Users who are already members keep their membership and role without using the invite.
+// An invite that was revoked, has expired or has no uses left fails with domain.ErrInviteUnavailable.
+func (r *RoomInviteRepository) Redeem(ctx context.Context, inviteID, roomID, userID uuid.UUID) (*domain.RoomMember, error) {
+	member := &domain.RoomMember{}
+
+	// One statement, so a use is only counted if the membership is written with it
+	query := `
+		WITH existing AS (
+			SELECT room_id, user_id, role, created_at
+			FROM room_members
+			WHERE room_id = $2 AND user_id = $3
+		), used AS (
+			UPDATE room_invites
+			SET uses = uses + 1
+			WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL AND expires_at > $4
+				AND (max_uses IS NULL OR uses < max_uses)
+				AND NOT EXISTS (SELECT 1 FROM existing)
+			RETURNING role
+		), joined AS (
+			INSERT INTO room_members (room_id, user_id, role, created_at)
+			SELECT $2, $3, role, $4 FROM used
+			ON CONFLICT (room_id, user_id) DO UPDATE SET role = room_members.role
+			RETURNING room_id, user_id, role, created_at
+		)
+		SELECT room_id, user_id, role, created_at FROM existing
+		UNION ALL
+		SELECT room_id, user_id, role, created_at FROM joined
+	`
+
+	err := r.db.QueryRowContext(ctx, query, inviteID, roomID, userID, time.Now()).Scan(
+		&member.RoomID,
+		&member.UserID,
+		&member.Role,
+		&member.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to redeem room invite: %w", domain.ErrInviteUnavailable)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem room invite: %w", err)
+	}
+
+	return member, nil
+}
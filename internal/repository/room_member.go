@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// RoomMemberRepository handles room membership-related database operations
+type RoomMemberRepository struct {
+	db *sql.DB
+}
+
+// NewRoomMemberRepository creates a new room member repository
+func NewRoomMemberRepository(db *sql.DB) *RoomMemberRepository {
+	return &RoomMemberRepository{db: db}
+}
+
+// Get retrieves a user's membership of a room, or nil if they aren't a member
+func (r *RoomMemberRepository) Get(ctx context.Context, roomID, userID uuid.UUID) (*domain.RoomMember, error) {
+	member := &domain.RoomMember{}
+
+	query := `
+		SELECT room_id, user_id, role, created_at
+		FROM room_members
+		WHERE room_id = $1 AND user_id = $2
+	`
+
+	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(
+		&member.RoomID,
+		&member.UserID,
+		&member.Role,
+		&member.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room member: %w", err)
+	}
+
+	return member, nil
+}
+
+// ListByRoom retrieves all of a room's members
+func (r *RoomMemberRepository) ListByRoom(ctx context.Context, roomID uuid.UUID) ([]*domain.RoomMember, error) {
+	query := `
+		SELECT room_id, user_id, role, created_at
+		FROM room_members
+		WHERE room_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*domain.RoomMember
+	for rows.Next() {
+		member := &domain.RoomMember{}
+		err := rows.Scan(
+			&member.RoomID,
+			&member.UserID,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// ListByUser retrieves all of a user's room memberships
+func (r *RoomMemberRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.RoomMember, error) {
+	query := `
+		SELECT room_id, user_id, role, created_at
+		FROM room_members
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user room memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*domain.RoomMember
+	for rows.Next() {
+		member := &domain.RoomMember{}
+		err := rows.Scan(
+			&member.RoomID,
+			&member.UserID,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
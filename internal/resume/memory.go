@@ -0,0 +1,136 @@
+package resume
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps parked sessions in process memory
+// Only this node can claim them, so it suits single-node mode.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	parked map[string]memoryParked
+}
+
+// memoryParked is a parked session and when it stops being claimable
+type memoryParked struct {
+	state     domain.ResumeState
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an in-memory resume store
+// now drives expiry; nil uses the wall clock.
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MemoryStore{
+		now:    now,
+		parked: make(map[string]memoryParked),
+	}
+}
+
+// Park stores a session under its resume token until ttl passes
+func (s *MemoryStore) Park(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for t, p := range s.parked {
+		if !now.Before(p.expiresAt) {
+			delete(s.parked, t)
+		}
+	}
+
+	s.parked[token] = memoryParked{state: state, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Claim removes and returns a parked session; nil, nil when the token is unknown or expired
+func (s *MemoryStore) Claim(ctx context.Context, token string) (*domain.ResumeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.parked[token]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.parked, token)
+
+	if !s.now().Before(p.expiresAt) {
+		return nil, nil
+	}
+	return &p.state, nil
+}
+
+// MemoryBuffer keeps each channel's most recent messages in process memory
+type MemoryBuffer struct {
+	size int
+
+	mu       sync.Mutex
+	channels map[string][]memoryEntry
+}
+
+// memoryEntry is a buffered message, encoded so callers never share pointers
+type memoryEntry struct {
+	seq  int64
+	data []byte
+}
+
+// NewMemoryBuffer creates an in-memory buffer keeping the last size messages per channel
+func NewMemoryBuffer(size int) *MemoryBuffer {
+	return &MemoryBuffer{
+		size:     size,
+		channels: make(map[string][]memoryEntry),
+	}
+}
+
+// Append adds a sequenced message to its channel's buffer, dropping the oldest once full
+// Messages may be appended slightly out of order, so entries are kept sorted by sequence number.
+func (b *MemoryBuffer) Append(ctx context.Context, msg *domain.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := b.channels[msg.ChannelID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].seq > msg.Seq })
+	entries = slices.Insert(entries, i, memoryEntry{seq: msg.Seq, data: msg.Encode()})
+	if len(entries) > b.size {
+		entries = slices.Delete(entries, 0, len(entries)-b.size)
+	}
+	b.channels[msg.ChannelID] = entries
+	return nil
+}
+
+// Since returns the channel's messages after a sequence number, oldest first
+func (b *MemoryBuffer) Since(ctx context.Context, channelID string, seq int64) ([]*domain.Message, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := b.channels[channelID]
+	msgs := []*domain.Message{}
+	if len(entries) == 0 {
+		return msgs, true, nil
+	}
+
+	// Complete if the buffer still reaches back to the first message after seq
+	complete := entries[0].seq <= seq+1
+	for _, entry := range entries {
+		if entry.seq <= seq {
+			continue
+		}
+
+		msg, err := domain.DecodeMessage(entry.data)
+		if err != nil {
+			return nil, false, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, complete, nil
+}
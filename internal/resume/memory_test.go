@@ -0,0 +1,86 @@
+package resume
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_ParkAndClaim(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(func() time.Time { return now })
+	ctx := context.Background()
+
+	state := domain.ResumeState{SessionID: "tab-1", UserID: "user-a", ChannelID: "room", Position: 4}
+	s.Park(ctx, "token-1", state, time.Minute)
+	s.Park(ctx, "token-2", state, time.Minute)
+
+	got, err := s.Claim(ctx, "token-1")
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if got == nil || *got != state {
+		t.Errorf("Expected %+v, got %+v", state, got)
+	}
+
+	// A token can only be claimed once
+	if got, _ := s.Claim(ctx, "token-1"); got != nil {
+		t.Errorf("Expected claimed token to be gone, got %+v", got)
+	}
+
+	// Nor after it expires
+	now = now.Add(time.Minute)
+	if got, _ := s.Claim(ctx, "token-2"); got != nil {
+		t.Errorf("Expected expired token to be gone, got %+v", got)
+	}
+}
+
+// sequenced returns a chat message carrying a sequence number
+func sequenced(seq int64, channelID string) *domain.Message {
+	msg := domain.NewMessage(fmt.Sprintf("msg-%d", seq), channelID, "user-a", "hi", domain.Position{})
+	msg.Seq = seq
+	return msg
+}
+
+func TestMemoryBuffer_Since(t *testing.T) {
+	b := NewMemoryBuffer(3)
+	ctx := context.Background()
+
+	if msgs, complete, _ := b.Since(ctx, "room", 0); !complete || len(msgs) != 0 {
+		t.Errorf("Expected nothing for an empty channel, got %d", len(msgs))
+	}
+
+	// Appended out of order, as concurrent publishers may
+	b.Append(ctx, sequenced(2, "room"))
+	b.Append(ctx, sequenced(1, "room"))
+	b.Append(ctx, sequenced(1, "elsewhere"))
+
+	msgs, complete, err := b.Since(ctx, "room", 1)
+	if err != nil {
+		t.Fatalf("Since() error = %v", err)
+	}
+	if !complete || len(msgs) != 1 || *msgs[0].MessageID != "msg-2" {
+		t.Errorf("Expected msg-2 only, got %d messages (complete %v)", len(msgs), complete)
+	}
+
+	// Overflow the buffer: msg-1 and msg-2 are dropped
+	for seq := int64(3); seq <= 5; seq++ {
+		b.Append(ctx, sequenced(seq, "room"))
+	}
+
+	msgs, complete, _ = b.Since(ctx, "room", 2)
+	if !complete || len(msgs) != 3 || *msgs[0].MessageID != "msg-3" || *msgs[2].MessageID != "msg-5" {
+		t.Errorf("Expected msg-3 to msg-5 in order, got %d messages (complete %v)", len(msgs), complete)
+	}
+
+	msgs, complete, _ = b.Since(ctx, "room", 1)
+	if complete || len(msgs) != 3 {
+		t.Errorf("Expected an incomplete catch-up of 3 messages, got %d (complete %v)", len(msgs), complete)
+	}
+
+	if msgs, complete, _ := b.Since(ctx, "room", 5); !complete || len(msgs) != 0 {
+		t.Errorf("Expected nothing missed at the latest sequence number, got %d", len(msgs))
+	}
+}
@@ -0,0 +1,171 @@
+package resume
+
+import (
+	"asocial/internal/domain"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps parked sessions in Redis so a client can resume on any node
+// Each session is a chat:resume:session:<token> key holding its JSON ResumeState.
+type RedisStore struct {
+	client *redis.Client
+	logger *slog.Logger
+}
+
+// NewRedisStore creates a Redis resume store
+func NewRedisStore(client *redis.Client, logger *slog.Logger) *RedisStore {
+	return &RedisStore{
+		client: client,
+		logger: logger,
+	}
+}
+
+// sessionKey returns the key holding a parked session
+func sessionKey(token string) string {
+	return fmt.Sprintf("chat:resume:session:%s", token)
+}
+
+// Park stores a session under its resume token until ttl passes
+func (s *RedisStore) Park(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resume state: %w", err)
+	}
+
+	if err := s.client.Set(ctx, sessionKey(token), data, ttl).Err(); err != nil {
+		s.logger.Error("Failed to park session", "error", err, "session_id", state.SessionID)
+		return err
+	}
+	return nil
+}
+
+// Claim removes and returns a parked session; nil, nil when the token is unknown or expired
+// GETDEL makes the claim atomic, so of several nodes racing for a token only one wins.
+func (s *RedisStore) Claim(ctx context.Context, token string) (*domain.ResumeState, error) {
+	data, err := s.client.GetDel(ctx, sessionKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to claim session", "error", err)
+		return nil, err
+	}
+
+	var state domain.ResumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode resume state: %w", err)
+	}
+	return &state, nil
+}
+
+// appendScript pushes a sequenced message and trims the buffer to its size
+// KEYS: buffer. ARGV: entry JSON, size, ttl (ms)
+var appendScript = redis.NewScript(`
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[2]), -1)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// RedisBuffer keeps each channel's most recent messages in Redis
+// Every node appends the messages its own sessions send, so the buffer holds the whole
+// room no matter which node a client resumes on.
+//
+// Each channel has a chat:resume:<channel>:buffer list of {"seq": n, "message": {...}},
+// roughly oldest first: nodes append in the order they publish, which may differ
+// slightly from sequence order, so readers sort it.
+//
+// The buffer expires once a channel has been quiet for the retention period, which must
+// outlast a parked session.
+type RedisBuffer struct {
+	client    *redis.Client
+	size      int
+	retention time.Duration
+	logger    *slog.Logger
+}
+
+// bufferEntry is one buffered message and its sequence number
+type bufferEntry struct {
+	Seq     int64           `json:"seq"`
+	Message json.RawMessage `json:"message"`
+}
+
+// NewRedisBuffer creates a Redis buffer keeping the last size messages per channel
+func NewRedisBuffer(client *redis.Client, size int, retention time.Duration, logger *slog.Logger) *RedisBuffer {
+	return &RedisBuffer{
+		client:    client,
+		size:      size,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+// bufferKey returns the key holding a channel's buffered messages
+func bufferKey(channelID string) string {
+	return fmt.Sprintf("chat:resume:%s:buffer", channelID)
+}
+
+// Append adds a sequenced message to its channel's buffer, dropping the oldest once full
+func (b *RedisBuffer) Append(ctx context.Context, msg *domain.Message) error {
+	entry, err := json.Marshal(bufferEntry{Seq: msg.Seq, Message: msg.Encode()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal buffer entry: %w", err)
+	}
+
+	err = appendScript.Run(ctx, b.client,
+		[]string{bufferKey(msg.ChannelID)},
+		entry, b.size, b.retention.Milliseconds(),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to buffer message: %w", err)
+	}
+	return nil
+}
+
+// Since returns the channel's messages after a sequence number, oldest first
+func (b *RedisBuffer) Since(ctx context.Context, channelID string, seq int64) ([]*domain.Message, bool, error) {
+	values, err := b.client.LRange(ctx, bufferKey(channelID), 0, -1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read message buffer: %w", err)
+	}
+
+	entries := make([]bufferEntry, 0, len(values))
+	for _, value := range values {
+		var entry bufferEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, false, fmt.Errorf("failed to decode buffer entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortStableFunc(entries, func(a, b bufferEntry) int { return cmp.Compare(a.Seq, b.Seq) })
+
+	msgs := []*domain.Message{}
+	if len(entries) == 0 {
+		return msgs, true, nil
+	}
+
+	// Complete if the buffer still reaches back to the first message after seq
+	complete := entries[0].Seq <= seq+1
+	for _, entry := range entries {
+		if entry.Seq <= seq {
+			continue
+		}
+
+		msg, err := domain.DecodeMessage(entry.Message)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode buffered message: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, complete, nil
+}
@@ -0,0 +1,2 @@
+// Package resume holds disconnected sessions and recent messages so clients can resume.
+package resume
@@ -0,0 +1,37 @@
+package sequence
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySequencer numbers messages in process memory
+// Numbers are only unique within this node, so it suits single-node mode.
+type MemorySequencer struct {
+	mu       sync.Mutex
+	channels map[string]int64
+}
+
+// NewMemorySequencer creates an in-memory sequencer
+func NewMemorySequencer() *MemorySequencer {
+	return &MemorySequencer{
+		channels: make(map[string]int64),
+	}
+}
+
+// Next reserves the channel's next sequence number
+func (s *MemorySequencer) Next(ctx context.Context, channelID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels[channelID]++
+	return s.channels[channelID], nil
+}
+
+// Current returns the channel's latest sequence number, 0 if none
+func (s *MemorySequencer) Current(ctx context.Context, channelID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.channels[channelID], nil
+}
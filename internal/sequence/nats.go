@@ -0,0 +1,122 @@
+package sequence
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBucket is the JetStream KV bucket holding each channel's latest sequence number
+const natsBucket = "chat_sequence"
+
+const (
+	// maxNATSAttempts bounds how often Next retries after losing a race with another node
+	maxNATSAttempts = 50
+	// natsRetryBackoff is the longest pause before a retry, scaled by the attempt number
+	// Random pauses keep the losers of a race from colliding again on their next try.
+	natsRetryBackoff = time.Millisecond
+)
+
+// NATSSequencer numbers messages with one counter per channel in a JetStream KV bucket
+// KV has no increment, so Next reads the counter and writes it back only if nobody
+// changed it meanwhile, retrying otherwise.
+type NATSSequencer struct {
+	kv jetstream.KeyValue
+}
+
+// NewNATSSequencer creates a NATS sequencer, creating its bucket if needed
+func NewNATSSequencer(conn *nats.Conn) (*NATSSequencer, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// File storage, so counters survive a NATS restart
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:  natsBucket,
+		Storage: jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sequence bucket: %w", err)
+	}
+
+	return &NATSSequencer{kv: kv}, nil
+}
+
+// natsKey returns the key holding a channel's counter
+func natsKey(channelID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(channelID))
+}
+
+// Next reserves the channel's next sequence number
+func (s *NATSSequencer) Next(ctx context.Context, channelID string) (int64, error) {
+	key := natsKey(channelID)
+
+	for attempt := 0; attempt < maxNATSAttempts; attempt++ {
+		current, revision, err := s.get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		next := current + 1
+		value := []byte(strconv.FormatInt(next, 10))
+		if revision == 0 {
+			_, err = s.kv.Create(ctx, key, value)
+		} else {
+			_, err = s.kv.Update(ctx, key, value, revision)
+		}
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, jetstream.ErrKeyExists) && !isWrongSequence(err) {
+			return 0, fmt.Errorf("failed to store sequence: %w", err)
+		}
+		// Another node took this number; read again after a pause
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(rand.N(natsRetryBackoff * time.Duration(attempt+1))):
+		}
+	}
+
+	return 0, fmt.Errorf("failed to reserve sequence for channel %s: too much contention", channelID)
+}
+
+// Current returns the channel's latest sequence number, 0 if none
+func (s *NATSSequencer) Current(ctx context.Context, channelID string) (int64, error) {
+	current, _, err := s.get(ctx, natsKey(channelID))
+	return current, err
+}
+
+// get returns a counter and its revision, 0 and 0 if it doesn't exist yet
+func (s *NATSSequencer) get(ctx context.Context, key string) (int64, uint64, error) {
+	entry, err := s.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get sequence: %w", err)
+	}
+
+	current, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode sequence: %w", err)
+	}
+	return current, entry.Revision(), nil
+}
+
+// isWrongSequence reports whether an update lost to a concurrent write
+func isWrongSequence(err error) bool {
+	var apiErr *jetstream.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence
+}
@@ -0,0 +1,47 @@
+package sequence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSequencer numbers messages with one counter per channel in Redis
+// INCR is atomic, so every node draws from the same sequence. Counters never expire:
+// a sequence that restarted would look to clients like messages they had already seen.
+type RedisSequencer struct {
+	client *redis.Client
+}
+
+// NewRedisSequencer creates a Redis sequencer
+func NewRedisSequencer(client *redis.Client) *RedisSequencer {
+	return &RedisSequencer{client: client}
+}
+
+// seqKey returns the key holding a channel's latest sequence number
+func seqKey(channelID string) string {
+	return fmt.Sprintf("chat:seq:%s", channelID)
+}
+
+// Next reserves the channel's next sequence number
+func (s *RedisSequencer) Next(ctx context.Context, channelID string) (int64, error) {
+	seq, err := s.client.Incr(ctx, seqKey(channelID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// Current returns the channel's latest sequence number, 0 if none
+func (s *RedisSequencer) Current(ctx context.Context, channelID string) (int64, error) {
+	seq, err := s.client.Get(ctx, seqKey(channelID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sequence: %w", err)
+	}
+	return seq, nil
+}
@@ -0,0 +1,2 @@
+// Package sequence numbers each room's messages so clients can order them and spot gaps.
+package sequence
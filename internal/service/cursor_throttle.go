@@ -0,0 +1,116 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCursorInterval is the shortest time between two published cursor positions of a user
+const DefaultCursorInterval = 50 * time.Millisecond
+
+// CursorStore keeps each user's last pointer position in a channel for new joiners
+type CursorStore interface {
+	// Move records a user's pointer position
+	Move(ctx context.Context, channelID, userID string, position domain.Position) error
+	// Cursors returns the last position of every user in the channel who shared one
+	Cursors(ctx context.Context, channelID string) (map[string]domain.Position, error)
+	// Remove forgets a user's position, e.g. once they left
+	Remove(ctx context.Context, channelID, userID string) error
+}
+
+// cursorThrottle limits how often each user's cursor position is published
+// A pointer moves far more often than peers need to hear about it, so a move within the
+// interval of the last published one is held back, and only the latest held-back move
+// is published when the interval ends.
+type cursorThrottle struct {
+	publish  func(*domain.Message)
+	interval time.Duration
+	mu       sync.Mutex
+	users    map[cursorKey]*throttledCursor
+}
+
+// cursorKey identifies a user's cursor in a channel
+type cursorKey struct {
+	channelID string
+	userID    string
+}
+
+// throttledCursor is when a user's cursor was last published and the move waiting to be
+type throttledCursor struct {
+	published time.Time
+	pending   *domain.Message // Nil unless a timer is waiting to publish it
+	timer     *time.Timer
+}
+
+// newCursorThrottle creates a throttle handing at most one move per user and interval to publish
+func newCursorThrottle(publish func(*domain.Message), interval time.Duration) *cursorThrottle {
+	return &cursorThrottle{
+		publish:  publish,
+		interval: interval,
+		users:    make(map[cursorKey]*throttledCursor),
+	}
+}
+
+// move publishes a cursor move now if the user's interval has passed, otherwise at its end
+func (t *cursorThrottle) move(msg *domain.Message) {
+	key := cursorKey{channelID: msg.ChannelID, userID: msg.UserID}
+
+	t.mu.Lock()
+	c, ok := t.users[key]
+	if !ok {
+		c = &throttledCursor{}
+		t.users[key] = c
+	}
+
+	// Coalesce with the move already waiting
+	if c.pending != nil {
+		c.pending = msg
+		t.mu.Unlock()
+		return
+	}
+
+	wait := t.interval - time.Since(c.published)
+	if wait <= 0 {
+		c.published = time.Now()
+		t.mu.Unlock()
+		t.publish(msg)
+		return
+	}
+
+	c.pending = msg
+	c.timer = time.AfterFunc(wait, func() { t.flush(key, c) })
+	t.mu.Unlock()
+}
+
+// flush publishes the move held back for a user when their interval ends
+func (t *cursorThrottle) flush(key cursorKey, c *throttledCursor) {
+	t.mu.Lock()
+	if t.users[key] != c || c.pending == nil {
+		// Forgotten meanwhile
+		t.mu.Unlock()
+		return
+	}
+	msg := c.pending
+	c.pending = nil
+	c.published = time.Now()
+	t.mu.Unlock()
+
+	t.publish(msg)
+}
+
+// forget drops a user's state and any move still held back, e.g. once they left
+func (t *cursorThrottle) forget(channelID, userID string) {
+	key := cursorKey{channelID: channelID, userID: userID}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.users[key]; ok {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		delete(t.users, key)
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cursorRecorder collects what a cursor throttle publishes
+type cursorRecorder struct {
+	mu   sync.Mutex
+	msgs []*domain.Message
+}
+
+func (p *cursorRecorder) publish(msg *domain.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+}
+
+func (p *cursorRecorder) published() []*domain.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*domain.Message(nil), p.msgs...)
+}
+
+func cursorAt(userID string, x float64) *domain.Message {
+	return domain.NewCursorMovedMessage("room", userID, domain.Position{X: x, Y: 10})
+}
+
+func TestCursorThrottle_CoalescesMovesWithinInterval(t *testing.T) {
+	p := &cursorRecorder{}
+	throttle := newCursorThrottle(p.publish, 50*time.Millisecond)
+
+	// The first move goes out straight away, the burst after it as one latest move
+	throttle.move(cursorAt("alice", 1))
+	throttle.move(cursorAt("alice", 2))
+	throttle.move(cursorAt("alice", 3))
+	throttle.move(cursorAt("bob", 7))
+
+	if got := p.published(); len(got) != 2 {
+		t.Fatalf("Expected alice's and bob's first moves published, got %d", len(got))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	got := p.published()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 moves published, got %d", len(got))
+	}
+	if got[2].UserID != "alice" || got[2].Position.X != 3 {
+		t.Errorf("Expected alice's latest move last, got %s at %v", got[2].UserID, got[2].Position)
+	}
+}
+
+func TestCursorThrottle_ForgetDropsHeldMove(t *testing.T) {
+	p := &cursorRecorder{}
+	throttle := newCursorThrottle(p.publish, 30*time.Millisecond)
+
+	throttle.move(cursorAt("alice", 1))
+	throttle.move(cursorAt("alice", 2))
+	throttle.forget("room", "alice")
+
+	time.Sleep(60 * time.Millisecond)
+	if got := p.published(); len(got) != 1 {
+		t.Fatalf("Expected only the first move published, got %d", len(got))
+	}
+
+	// A user who comes back starts a fresh interval
+	throttle.move(cursorAt("alice", 5))
+	if got := p.published(); len(got) != 2 {
+		t.Errorf("Expected the move to go out straight away, got %d published", len(got))
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RateLimitCloseCode closes sessions that keep sending frames over their limits
+const RateLimitCloseCode = 4002
+
+// otherFrames names the budget of message types without limits of their own
+const otherFrames = "other"
+
+// RateLimiter keeps token buckets, shared by every node when backed by Redis
+type RateLimiter interface {
+	// Take removes a token from each bucket if every one has a token
+	// Otherwise nothing is taken, and retryAfter is how long until they all have one.
+	Take(ctx context.Context, buckets []domain.TokenBucket) (ok bool, retryAfter time.Duration, err error)
+}
+
+// FrameLimits is how often frames of one message type may be sent
+// Every frame draws from the sending session's, user's and client IP's bucket, so a user
+// can't get around the session limit by opening tabs, nor a script by rotating guests.
+type FrameLimits struct {
+	Session domain.RateLimit
+	User    domain.RateLimit
+	IP      domain.RateLimit
+}
+
+// FrameLimiter decides whether a session may send another frame
+// Each message type has its own budget, so chatting never eats into cursor moves. Types
+// without limits of their own share the other budget, held to chat's limits. A session
+// whose frames are rejected maxStrikes times within strikeWindow should be disconnected.
+type FrameLimiter struct {
+	limiter      RateLimiter
+	limits       map[domain.MessageType]FrameLimits
+	maxStrikes   int
+	strikeWindow time.Duration
+	logger       *slog.Logger
+
+	mu      sync.Mutex
+	strikes map[string][]time.Time // Session ID -> when its recent frames were rejected
+}
+
+// NewFrameLimiter creates a frame limiter
+// maxStrikes 0 never disconnects anyone.
+func NewFrameLimiter(limiter RateLimiter, limits map[domain.MessageType]FrameLimits, maxStrikes int, strikeWindow time.Duration, logger *slog.Logger) *FrameLimiter {
+	return &FrameLimiter{
+		limiter:      limiter,
+		limits:       limits,
+		maxStrikes:   maxStrikes,
+		strikeWindow: strikeWindow,
+		logger:       logger,
+		strikes:      make(map[string][]time.Time),
+	}
+}
+
+// Allow takes a frame of msgType from the session's, user's and IP's budgets
+// If any is spent, nothing is taken and retryAfter is how long to wait. A failing
+// limiter lets frames through rather than silencing every room.
+func (l *FrameLimiter) Allow(ctx context.Context, msgType domain.MessageType, sessionID, userID, ip string) (bool, time.Duration) {
+	budget := string(msgType)
+	limits, ok := l.limits[msgType]
+	if !ok {
+		budget, limits = otherFrames, l.limits[domain.MessageTypeChat]
+	}
+
+	buckets := make([]domain.TokenBucket, 0, 3)
+	for _, b := range []struct {
+		scope, id string
+		limit     domain.RateLimit
+	}{
+		{"session", sessionID, limits.Session},
+		{"user", userID, limits.User},
+		{"ip", ip, limits.IP},
+	} {
+		if b.limit.Rate > 0 && b.id != "" {
+			buckets = append(buckets, domain.TokenBucket{Key: budget + ":" + b.scope + ":" + b.id, Limit: b.limit})
+		}
+	}
+	if len(buckets) == 0 {
+		return true, 0
+	}
+
+	allowed, retryAfter, err := l.limiter.Take(ctx, buckets)
+	if err != nil {
+		l.logger.Warn("Failed to check rate limit", "error", err, "type", msgType, "session_id", sessionID)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// Strike records a rejected frame and reports whether the session has now had too many
+func (l *FrameLimiter) Strike(sessionID string) bool {
+	if l.maxStrikes <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	recent := l.strikes[sessionID][:0]
+	for _, at := range l.strikes[sessionID] {
+		if now.Sub(at) < l.strikeWindow {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	l.strikes[sessionID] = recent
+
+	return len(recent) >= l.maxStrikes
+}
+
+// Forget drops a session's strikes, e.g. once it disconnected
+func (l *FrameLimiter) Forget(sessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.strikes, sessionID)
+}
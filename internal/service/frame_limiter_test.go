@@ -0,0 +1,114 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/ratelimit"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestFrameLimiter(now *time.Time, maxStrikes int) *FrameLimiter {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limits := map[domain.MessageType]FrameLimits{
+		domain.MessageTypeChat: {
+			Session: domain.RateLimit{Rate: 1, Burst: 2},
+			User:    domain.RateLimit{Rate: 1, Burst: 3},
+			IP:      domain.RateLimit{Rate: 1, Burst: 4},
+		},
+		domain.MessageTypeCursorMoved: {
+			Session: domain.RateLimit{Rate: 1, Burst: 1},
+		},
+	}
+	limiter := ratelimit.NewMemoryLimiter(func() time.Time { return *now })
+	return NewFrameLimiter(limiter, limits, maxStrikes, 10*time.Second, logger)
+}
+
+func TestFrameLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l := newTestFrameLimiter(&now, 0)
+	ctx := context.Background()
+
+	allow := func(msgType domain.MessageType, sessionID, userID, ip string) bool {
+		allowed, _ := l.Allow(ctx, msgType, sessionID, userID, ip)
+		return allowed
+	}
+
+	// A session's burst is spent first
+	for i := 0; i < 2; i++ {
+		if !allow(domain.MessageTypeChat, "tab-1", "alice", "10.0.0.1") {
+			t.Fatalf("Expected chat %d within the session burst", i+1)
+		}
+	}
+	allowed, retryAfter := l.Allow(ctx, domain.MessageTypeChat, "tab-1", "alice", "10.0.0.1")
+	if allowed || retryAfter != time.Second {
+		t.Errorf("Expected the session to wait 1s, got allowed %v, retry after %v", allowed, retryAfter)
+	}
+
+	// Other message types have budgets of their own
+	if !allow(domain.MessageTypeCursorMoved, "tab-1", "alice", "10.0.0.1") {
+		t.Error("Expected cursor moves to have their own budget")
+	}
+
+	// A second tab only gets what is left of the user's budget
+	if !allow(domain.MessageTypeChat, "tab-2", "alice", "10.0.0.1") {
+		t.Error("Expected the user's third chat to pass")
+	}
+	if allow(domain.MessageTypeChat, "tab-2", "alice", "10.0.0.1") {
+		t.Error("Expected the user's budget to be spent")
+	}
+
+	// And another user behind the same address only what is left of the IP's
+	if !allow(domain.MessageTypeChat, "tab-3", "bob", "10.0.0.1") {
+		t.Error("Expected the address's fourth chat to pass")
+	}
+	if allow(domain.MessageTypeChat, "tab-3", "bob", "10.0.0.1") {
+		t.Error("Expected the address's budget to be spent")
+	}
+
+	// Budgets refill over time
+	now = now.Add(time.Second)
+	if !allow(domain.MessageTypeChat, "tab-1", "alice", "10.0.0.1") {
+		t.Error("Expected the budgets to have refilled a token")
+	}
+
+	// Types without limits of their own share one budget held to chat's
+	for _, msgType := range []domain.MessageType{"made_up", "another"} {
+		if !allow(msgType, "tab-4", "carol", "10.0.0.2") {
+			t.Errorf("Expected %s within the other budget", msgType)
+		}
+	}
+	if allow("made_up", "tab-4", "carol", "10.0.0.2") {
+		t.Error("Expected unknown types to share a budget")
+	}
+}
+
+func TestFrameLimiter_Strike(t *testing.T) {
+	now := time.Now()
+	l := newTestFrameLimiter(&now, 3)
+
+	if l.Strike("tab-1") || l.Strike("tab-1") {
+		t.Fatal("Expected the first strikes to be tolerated")
+	}
+	if l.Strike("tab-2") {
+		t.Error("Expected strikes to be counted per session")
+	}
+	if !l.Strike("tab-1") {
+		t.Error("Expected the third strike to disconnect")
+	}
+
+	l.Forget("tab-1")
+	if l.Strike("tab-1") {
+		t.Error("Expected a forgotten session to start over")
+	}
+
+	// Without a maximum nobody is disconnected
+	unlimited := newTestFrameLimiter(&now, 0)
+	for i := 0; i < 10; i++ {
+		if unlimited.Strike("tab-1") {
+			t.Fatal("Expected no disconnect without max strikes")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultCommitDelay is how long a chat message must go without edits before it is committed
+// It is shorter than the frontend's fade-out so history matches what people saw
+const DefaultCommitDelay = 3 * time.Second
+
+// MessageStore persists committed chat messages
+type MessageStore interface {
+	Save(ctx context.Context, msg *domain.ChatMessage) error
+}
+
+// messageCommitter tracks in-progress chat messages and persists their final version
+// Every keystroke re-publishes the whole message, so only the last version is written:
+// either when the client marks it final, or once it has been idle for the commit delay
+type messageCommitter struct {
+	store   MessageStore
+	delay   time.Duration
+	logger  *slog.Logger
+	mu      sync.Mutex
+	pending map[commitKey]*pendingCommit
+}
+
+// commitKey identifies a message by its author as well as its ID
+// Message IDs come from clients, so a bare ID would let one user supersede another's draft
+type commitKey struct {
+	channelID string
+	userID    string
+	messageID string
+}
+
+// pendingCommit is the latest unsaved version of a message and its idle timer
+type pendingCommit struct {
+	msg   *domain.Message
+	timer *time.Timer
+}
+
+// newMessageCommitter creates a committer writing to the given store
+func newMessageCommitter(store MessageStore, delay time.Duration, logger *slog.Logger) *messageCommitter {
+	return &messageCommitter{
+		store:   store,
+		delay:   delay,
+		logger:  logger,
+		pending: make(map[commitKey]*pendingCommit),
+	}
+}
+
+// track records a new version of a chat message, committing it now if final
+func (c *messageCommitter) track(msg *domain.Message) {
+	if msg.MessageID == nil || *msg.MessageID == "" {
+		return
+	}
+	id := commitKey{channelID: msg.ChannelID, userID: msg.UserID, messageID: *msg.MessageID}
+
+	c.mu.Lock()
+	if p, ok := c.pending[id]; ok {
+		p.timer.Stop()
+		delete(c.pending, id)
+	}
+
+	if msg.Final {
+		c.mu.Unlock()
+		c.commit(msg)
+		return
+	}
+
+	p := &pendingCommit{msg: msg}
+	p.timer = time.AfterFunc(c.delay, func() {
+		c.mu.Lock()
+		current, ok := c.pending[id]
+		if !ok || current != p {
+			// Superseded by a newer version
+			c.mu.Unlock()
+			return
+		}
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		c.commit(p.msg)
+	})
+	c.pending[id] = p
+	c.mu.Unlock()
+}
+
+// flush commits every pending message immediately
+func (c *messageCommitter) flush() {
+	c.mu.Lock()
+	pending := make([]*domain.Message, 0, len(c.pending))
+	for id, p := range c.pending {
+		p.timer.Stop()
+		pending = append(pending, p.msg)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	for _, msg := range pending {
+		c.commit(msg)
+	}
+}
+
+// commit writes a message to the store
+// Empty messages (the author deleted all text) and messages without a position are skipped
+func (c *messageCommitter) commit(msg *domain.Message) {
+	if msg.Payload == nil || *msg.Payload == "" || msg.Position == nil {
+		return
+	}
+
+	roomID, err := uuid.Parse(msg.ChannelID)
+	if err != nil {
+		c.logger.Warn("Not committing message for non-room channel", "channel", msg.ChannelID, "message_id", *msg.MessageID)
+		return
+	}
+
+	stored := &domain.ChatMessage{
+		ID:       *msg.MessageID,
+		RoomID:   roomID,
+		UserID:   msg.UserID,
+		Username: msg.Username,
+		Color:    msg.Color,
+		Payload:  *msg.Payload,
+		Position: *msg.Position,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.store.Save(ctx, stored); err != nil {
+		c.logger.Error("Failed to commit message", "error", err, "message_id", stored.ID)
+		return
+	}
+
+	c.logger.Debug("Committed message", "message_id", stored.ID, "seq", stored.Seq, "channel", msg.ChannelID)
+}
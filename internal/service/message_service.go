@@ -3,17 +3,24 @@ package service
 import (
 	"asocial/internal/domain"
 	"context"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/olahol/melody"
 )
 
 // MessageService handles message business logic
 type MessageService struct {
-	pubsub PubSubClient
-	melody *melody.Melody
-	logger *slog.Logger
+	pubsub    PubSubClient
+	sequencer Sequencer
+	committer *messageCommitter
+	canvas    CanvasSnapshotter
+	buffer    MessageBuffer
+	cursors   CursorStore
+	throttle  *cursorThrottle
+	outbound  *Outbound
+	logger    *slog.Logger
 }
 
 // PubSubClient is an interface for pub/sub operations
@@ -21,23 +28,63 @@ type PubSubClient interface {
 	Publish(ctx context.Context, msg *domain.Message) error
 	Subscribe(ctx context.Context, handler func(*domain.Message) error) error
 	HealthCheck(ctx context.Context) error
-	// Presence operations
-	AddUserToChannel(ctx context.Context, channelID, userID string, username, color *string) error
-	RemoveUserFromChannel(ctx context.Context, channelID, userID string) error
-	RefreshUserPresence(ctx context.Context, channelID, userID string) error
-	GetChannelUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error)
+	// Room subscriptions, reference-counted per local session
+	JoinChannel(ctx context.Context, channelID string) error
+	LeaveChannel(ctx context.Context, channelID string) error
+}
+
+// Sequencer numbers each channel's messages in the order they are published
+// Numbers start at 1 and are shared by every node, so clients can spot messages they missed.
+type Sequencer interface {
+	// Next reserves the channel's next sequence number
+	Next(ctx context.Context, channelID string) (int64, error)
+	// Current returns the channel's latest sequence number, 0 if none
+	Current(ctx context.Context, channelID string) (int64, error)
+}
+
+// Replayer is implemented by pub/sub backends that keep room history
+type Replayer interface {
+	Replay(ctx context.Context, channelID, since string, limit int) ([]*domain.Message, error)
+}
+
+// MaxReplayMessages bounds how many messages one replay request returns
+const MaxReplayMessages = 1000
+
+// CanvasSnapshotter records chat messages and returns what is currently visible in a channel
+type CanvasSnapshotter interface {
+	Record(ctx context.Context, msg *domain.Message) error
+	Snapshot(ctx context.Context, channelID string) ([]domain.CanvasItem, error)
 }
 
 // NewMessageService creates a new message service
-func NewMessageService(pubsub PubSubClient, m *melody.Melody, logger *slog.Logger) *MessageService {
-	return &MessageService{
-		pubsub: pubsub,
-		melody: m,
-		logger: logger,
+// sequencer may be nil, in which case messages carry no sequence number and nothing is buffered
+// store may be nil, in which case chat messages are not persisted
+// canvas may be nil, in which case new joiners get an empty canvas snapshot
+// buffer may be nil, in which case resumed and backfilling sessions get a canvas snapshot instead of what they missed
+// cursors may be nil, in which case new joiners don't see where others are pointing
+func NewMessageService(pubsub PubSubClient, sequencer Sequencer, store MessageStore, canvas CanvasSnapshotter, buffer MessageBuffer, cursors CursorStore, outbound *Outbound, logger *slog.Logger) *MessageService {
+	var committer *messageCommitter
+	if store != nil {
+		committer = newMessageCommitter(store, DefaultCommitDelay, logger)
+	}
+
+	s := &MessageService{
+		pubsub:    pubsub,
+		sequencer: sequencer,
+		committer: committer,
+		canvas:    canvas,
+		buffer:    buffer,
+		cursors:   cursors,
+		outbound:  outbound,
+		logger:    logger,
 	}
+	s.throttle = newCursorThrottle(s.publishCursor, DefaultCursorInterval)
+	return s
 }
 
 // PublishMessage publishes a message to the pub/sub system
+// The message is stamped with the server's time and the channel's next sequence number,
+// whatever the client sent.
 func (s *MessageService) PublishMessage(ctx context.Context, msg *domain.Message) error {
 	// Generate message ID if not provided (for chat messages only)
 	if msg.Type == domain.MessageTypeChat && (msg.MessageID == nil || *msg.MessageID == "") {
@@ -45,16 +92,175 @@ func (s *MessageService) PublishMessage(ctx context.Context, msg *domain.Message
 		msg.MessageID = &id
 	}
 
+	msg.Timestamp = time.Now().UnixMilli()
+	msg.Seq = 0
+	if s.sequencer != nil {
+		seq, err := s.sequencer.Next(ctx, msg.ChannelID)
+		if err != nil {
+			s.logger.Error("Failed to sequence message", "error", err, "channel", msg.ChannelID)
+			return fmt.Errorf("failed to sequence message: %w", err)
+		}
+		msg.Seq = seq
+	}
+
 	// Publish to Redis
 	if err := s.pubsub.Publish(ctx, msg); err != nil {
 		s.logger.Error("Failed to publish message", "error", err, "message_id", msg.MessageID)
 		return err
 	}
 
-	s.logger.Info("Published message", "message_id", msg.MessageID, "user_id", msg.UserID, "channel", msg.ChannelID)
+	s.logger.Info("Published message", "message_id", msg.MessageID, "user_id", msg.UserID, "channel", msg.ChannelID, "seq", msg.Seq)
+
+	// Chat messages from local sessions are committed to history once final
+	if msg.Type == domain.MessageTypeChat && s.committer != nil {
+		s.committer.track(msg)
+	}
+
+	// A failed canvas write only costs late joiners this message, so don't fail the publish
+	if msg.Type == domain.MessageTypeChat && s.canvas != nil {
+		if err := s.canvas.Record(ctx, msg); err != nil {
+			s.logger.Warn("Failed to record canvas message", "error", err, "message_id", msg.MessageID)
+		}
+	}
+
+	// Likewise a failed buffer write only costs resumed and backfilling sessions this message
+	if msg.Seq > 0 && s.buffer != nil {
+		if err := s.buffer.Append(ctx, msg); err != nil {
+			s.logger.Warn("Failed to buffer message", "error", err, "message_id", msg.MessageID)
+		}
+	}
+
+	// Users who left no longer point anywhere
+	if msg.Type == domain.MessageTypeUserLeft && s.cursors != nil {
+		if err := s.cursors.Remove(ctx, msg.ChannelID, msg.UserID); err != nil {
+			s.logger.Warn("Failed to remove cursor", "error", err, "user_id", msg.UserID)
+		}
+	}
+
+	return nil
+}
+
+// CurrentSeq returns a channel's latest sequence number, 0 if none
+func (s *MessageService) CurrentSeq(ctx context.Context, channelID string) (int64, error) {
+	if s.sequencer == nil {
+		return 0, nil
+	}
+	return s.sequencer.Current(ctx, channelID)
+}
+
+// Backfill returns a channel's buffered messages after a sequence number, oldest first
+// seq is the channel's sequence number before the buffer was read, so every message up
+// to it that is still buffered is included. complete is false when some of them were
+// already dropped from the buffer, or there is no buffer.
+func (s *MessageService) Backfill(ctx context.Context, channelID string, since int64) (msgs []*domain.Message, complete bool, seq int64, err error) {
+	if s.sequencer == nil {
+		return []*domain.Message{}, true, 0, nil
+	}
+
+	seq, err = s.sequencer.Current(ctx, channelID)
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("failed to get sequence: %w", err)
+	}
+	if since >= seq {
+		return []*domain.Message{}, true, seq, nil
+	}
+	if s.buffer == nil {
+		return []*domain.Message{}, false, seq, nil
+	}
+
+	buffered, complete, err := s.buffer.Since(ctx, channelID, since)
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("failed to read message buffer: %w", err)
+	}
+
+	// Published after seq was read; the client gets them live
+	msgs = make([]*domain.Message, 0, len(buffered))
+	for _, msg := range buffered {
+		if msg.Seq <= seq {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, complete, seq, nil
+}
+
+// CloseRoom disconnects every session in a channel, on every node, e.g. once its room was deleted
+func (s *MessageService) CloseRoom(ctx context.Context, channelID string) error {
+	if err := s.pubsub.Publish(ctx, domain.NewRoomDeletedMessage(channelID)); err != nil {
+		return fmt.Errorf("failed to publish room deletion: %w", err)
+	}
+	return nil
+}
+
+// RestrictRoom disconnects the sessions of everyone but memberIDs in a channel, on every node,
+// e.g. once its room was made private
+func (s *MessageService) RestrictRoom(ctx context.Context, channelID string, memberIDs []string) error {
+	if err := s.pubsub.Publish(ctx, domain.NewRoomRestrictedMessage(channelID, memberIDs)); err != nil {
+		return fmt.Errorf("failed to publish room restriction: %w", err)
+	}
 	return nil
 }
 
+// MoveCursor shares a user's pointer position with their peers
+// Moves are throttled per user, so only the latest of a burst may be published.
+// Cursor positions are never persisted beyond the last one per user.
+func (s *MessageService) MoveCursor(msg *domain.Message) {
+	s.throttle.move(msg)
+}
+
+// publishCursor publishes a cursor move the throttle let through and records it for joiners
+func (s *MessageService) publishCursor(msg *domain.Message) {
+	ctx := context.Background()
+
+	if err := s.pubsub.Publish(ctx, msg); err != nil {
+		s.logger.Error("Failed to publish cursor", "error", err, "user_id", msg.UserID)
+		return
+	}
+
+	// A failed write only shows joiners a stale position until the next move
+	if s.cursors != nil {
+		if err := s.cursors.Move(ctx, msg.ChannelID, msg.UserID, *msg.Position); err != nil {
+			s.logger.Warn("Failed to record cursor", "error", err, "user_id", msg.UserID)
+		}
+	}
+}
+
+// Cursors returns the last shared pointer position of each user in a channel
+func (s *MessageService) Cursors(ctx context.Context, channelID string) (map[string]domain.Position, error) {
+	if s.cursors == nil {
+		return map[string]domain.Position{}, nil
+	}
+	return s.cursors.Cursors(ctx, channelID)
+}
+
+// CanvasSnapshot returns the messages currently visible in a channel
+func (s *MessageService) CanvasSnapshot(ctx context.Context, channelID string) ([]domain.CanvasItem, error) {
+	if s.canvas == nil {
+		return []domain.CanvasItem{}, nil
+	}
+	return s.canvas.Snapshot(ctx, channelID)
+}
+
+// FlushCommits persists every chat message still waiting for its commit delay
+func (s *MessageService) FlushCommits() {
+	if s.committer != nil {
+		s.committer.flush()
+	}
+}
+
+// Replay returns the messages of a channel published after the given stream ID
+func (s *MessageService) Replay(ctx context.Context, channelID, since string) ([]*domain.Message, error) {
+	replayer, ok := s.pubsub.(Replayer)
+	if !ok {
+		return nil, domain.ErrReplayUnsupported
+	}
+	return replayer.Replay(ctx, channelID, since, MaxReplayMessages)
+}
+
+// Outbound returns the per-session queues that frames to WebSocket clients go through
+func (s *MessageService) Outbound() *Outbound {
+	return s.outbound
+}
+
 // GetPubSubClient returns the underlying PubSubClient for presence operations
 func (s *MessageService) GetPubSubClient() PubSubClient {
 	return s.pubsub
@@ -65,46 +271,47 @@ func (s *MessageService) StartSubscriber(ctx context.Context) error {
 	s.logger.Info("Starting message subscriber")
 
 	return s.pubsub.Subscribe(ctx, func(msg *domain.Message) error {
+		// A deleted room's sessions are closed on every node that has some
+		if msg.Type == domain.MessageTypeRoomDeleted {
+			closed := s.outbound.CloseRoom(msg.ChannelID, RoomDeletedCloseCode, "room deleted")
+			s.logger.Info("Closed deleted room's sessions", "channel", msg.ChannelID, "sessions", closed)
+			return nil
+		}
+
+		// So is a room's non-members' once it was made private
+		if msg.Type == domain.MessageTypeRoomRestricted {
+			keep := make(map[string]bool, len(msg.Users))
+			for _, user := range msg.Users {
+				keep[user.UserID] = true
+			}
+			closed := s.outbound.CloseRoomExcept(msg.ChannelID, keep, RoomRestrictedCloseCode, "room made private")
+			s.logger.Info("Closed non-members' sessions in private room", "channel", msg.ChannelID, "sessions", closed)
+			return nil
+		}
+
+		// Whichever node announced the departure, drop the user's throttle state here
+		if msg.Type == domain.MessageTypeUserLeft {
+			s.throttle.forget(msg.ChannelID, msg.UserID)
+		}
+
 		// Broadcast to all WebSocket connections except the sender
 		return s.broadcastMessage(msg)
 	})
 }
 
 // broadcastMessage broadcasts a message to WebSocket clients
-// For chat messages: filters out the sender, sends only to users in the same channel
+// For chat messages and cursor moves: filters out the sender, sends only to users in the same channel
 // For presence events: sends to all users in the channel (including sender)
 func (s *MessageService) broadcastMessage(msg *domain.Message) error {
-	data := msg.Encode()
-
-	s.melody.BroadcastFilter(data, func(sess *melody.Session) bool {
-		// Get session channel ID
-		channelID, exists := sess.Get("channel_id")
-		if !exists {
-			return false
-		}
-
-		// Get session user ID
-		userID, exists := sess.Get("user_id")
-		if !exists {
-			return false
-		}
+	skipUserID := msg.UserID
 
-		// Only send to users in the same channel
-		channelMatch := channelID == msg.ChannelID
-		if !channelMatch {
-			return false
-		}
-
-		// For presence events (join/leave/username_changed/color_changed), send to everyone including sender
-		if msg.Type == domain.MessageTypeUserJoined || msg.Type == domain.MessageTypeUserLeft ||
-			msg.Type == domain.MessageTypeUsernameChanged || msg.Type == domain.MessageTypeColorChanged {
-			return true
-		}
+	// For presence events (join/leave/username_changed/color_changed), send to everyone including sender
+	if msg.Type == domain.MessageTypeUserJoined || msg.Type == domain.MessageTypeUserLeft ||
+		msg.Type == domain.MessageTypeUsernameChanged || msg.Type == domain.MessageTypeColorChanged {
+		skipUserID = ""
+	}
 
-		// For chat messages, don't send to sender
-		differentUser := userID != msg.UserID
-		return differentUser
-	})
+	s.outbound.Broadcast(msg, skipUserID)
 
 	s.logger.Debug("Broadcast message", "type", msg.Type, "message_id", msg.MessageID, "channel", msg.ChannelID)
 	return nil
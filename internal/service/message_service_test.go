@@ -0,0 +1,185 @@
+package service
+
+import (
+	"asocial/internal/canvas"
+	"asocial/internal/domain"
+	"asocial/internal/pubsub"
+	"asocial/internal/resume"
+	"asocial/internal/sequence"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/olahol/melody"
+)
+
+// recordingStore is a MessageStore that keeps saved messages in memory
+type recordingStore struct {
+	mu    sync.Mutex
+	saved []*domain.ChatMessage
+}
+
+func (s *recordingStore) Save(ctx context.Context, msg *domain.ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, msg)
+	return nil
+}
+
+func (s *recordingStore) messages() []*domain.ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*domain.ChatMessage(nil), s.saved...)
+}
+
+func newTestService(store MessageStore, canvas CanvasSnapshotter) *MessageService {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewMessageService(pubsub.NewMemoryPubSub(logger), nil, store, canvas, nil, nil, NewOutbound(melody.New(), 256, 5*time.Second, 400, logger), logger)
+}
+
+func TestMessageService_PublishAssignsMessageID(t *testing.T) {
+	svc := newTestService(nil, nil)
+
+	msg := &domain.Message{Type: domain.MessageTypeChat, ChannelID: "room", UserID: "user-1"}
+	if err := svc.PublishMessage(context.Background(), msg); err != nil {
+		t.Fatalf("PublishMessage() error = %v", err)
+	}
+	if msg.MessageID == nil || *msg.MessageID == "" {
+		t.Error("Expected a generated message ID")
+	}
+
+	// Presence events keep having no message ID
+	joined := domain.NewUserJoinedMessage("room", "user-1", nil, nil)
+	if err := svc.PublishMessage(context.Background(), joined); err != nil {
+		t.Fatalf("PublishMessage() error = %v", err)
+	}
+	if joined.MessageID != nil {
+		t.Errorf("Expected no message ID on presence event, got %s", *joined.MessageID)
+	}
+}
+
+func TestMessageService_CommitsLatestVersion(t *testing.T) {
+	store := &recordingStore{}
+	svc := newTestService(store, nil)
+	ctx := context.Background()
+	roomID := uuid.New()
+
+	// Drafts wait for the commit delay; the final version is written at once
+	for _, text := range []string{"h", "he", "hello"} {
+		msg := domain.NewMessage("msg-1", roomID.String(), "user-1", text, domain.Position{X: 1, Y: 2})
+		msg.Final = text == "hello"
+		svc.PublishMessage(ctx, msg)
+	}
+
+	saved := store.messages()
+	if len(saved) != 1 {
+		t.Fatalf("Expected 1 saved message, got %d", len(saved))
+	}
+	if saved[0].Payload != "hello" || saved[0].RoomID != roomID {
+		t.Errorf("Saved message mismatch: got %+v", saved[0])
+	}
+
+	// Unfinished drafts are written on flush
+	svc.PublishMessage(ctx, domain.NewMessage("msg-2", roomID.String(), "user-1", "draft", domain.Position{}))
+	svc.FlushCommits()
+	if saved := store.messages(); len(saved) != 2 || saved[1].Payload != "draft" {
+		t.Errorf("Expected draft to be flushed, got %d saved", len(saved))
+	}
+}
+
+func TestMessageService_CommitsPerAuthor(t *testing.T) {
+	store := &recordingStore{}
+	svc := newTestService(store, nil)
+	ctx := context.Background()
+	roomID := uuid.New()
+
+	// Another user reusing the message ID must not cancel the author's draft
+	svc.PublishMessage(ctx, domain.NewMessage("msg-1", roomID.String(), "user-1", "mine", domain.Position{}))
+	svc.PublishMessage(ctx, domain.NewMessage("msg-1", roomID.String(), "user-2", "", domain.Position{}))
+	svc.FlushCommits()
+
+	saved := store.messages()
+	if len(saved) != 1 {
+		t.Fatalf("Expected 1 saved message, got %d", len(saved))
+	}
+	if saved[0].UserID != "user-1" || saved[0].Payload != "mine" {
+		t.Errorf("Expected the author's draft to be saved, got %+v", saved[0])
+	}
+}
+
+func TestMessageService_CanvasSnapshot(t *testing.T) {
+	now := time.Now()
+	cache := canvas.NewMemoryCache(5*time.Second, func() time.Time { return now })
+	svc := newTestService(nil, cache)
+	ctx := context.Background()
+
+	svc.PublishMessage(ctx, domain.NewMessage("msg-1", "room", "user-1", "hello", domain.Position{X: 1, Y: 2}))
+	now = now.Add(time.Second)
+
+	items, err := svc.CanvasSnapshot(ctx, "room")
+	if err != nil {
+		t.Fatalf("CanvasSnapshot() error = %v", err)
+	}
+	if len(items) != 1 || items[0].Payload != "hello" || items[0].AgeMs != 1000 {
+		t.Fatalf("Unexpected snapshot: %+v", items)
+	}
+
+	// Faded messages are gone
+	now = now.Add(5 * time.Second)
+	if items, _ := svc.CanvasSnapshot(ctx, "room"); len(items) != 0 {
+		t.Errorf("Expected empty snapshot, got %d items", len(items))
+	}
+
+	// Without a snapshot source the canvas is simply empty
+	if items, err := newTestService(nil, nil).CanvasSnapshot(ctx, "room"); err != nil || len(items) != 0 {
+		t.Errorf("Expected empty snapshot, got %v, %v", items, err)
+	}
+}
+
+func TestMessageService_ReplayUnsupported(t *testing.T) {
+	svc := newTestService(nil, nil)
+
+	if _, err := svc.Replay(context.Background(), "room", "0-0"); !errors.Is(err, domain.ErrReplayUnsupported) {
+		t.Errorf("Expected ErrReplayUnsupported, got %v", err)
+	}
+}
+
+func TestMessageService_SequencesMessages(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	buffer := resume.NewMemoryBuffer(3)
+	svc := NewMessageService(pubsub.NewMemoryPubSub(logger), sequence.NewMemorySequencer(), nil, nil, buffer, nil, NewOutbound(melody.New(), 256, 5*time.Second, 400, logger), logger)
+	ctx := context.Background()
+
+	// Whatever the client claims, the server numbers and timestamps the message
+	before := time.Now().UnixMilli()
+	msg := domain.NewMessage("msg-1", "room", "user-1", "hi", domain.Position{})
+	msg.Seq, msg.Timestamp = 99, 1
+	svc.PublishMessage(ctx, msg)
+	if msg.Seq != 1 || msg.Timestamp < before {
+		t.Errorf("Expected seq 1 and a server timestamp, got seq %d at %d", msg.Seq, msg.Timestamp)
+	}
+
+	svc.PublishMessage(ctx, domain.NewUserJoinedMessage("room", "user-2", nil, nil))
+	svc.PublishMessage(ctx, domain.NewMessage("msg-2", "room", "user-1", "hi", domain.Position{}))
+
+	msgs, complete, seq, err := svc.Backfill(ctx, "room", 1)
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	if !complete || seq != 3 || len(msgs) != 2 || msgs[0].Type != domain.MessageTypeUserJoined || msgs[1].Seq != 3 {
+		t.Errorf("Expected the join and msg-2 up to seq 3, got %d messages up to %d (complete %v)", len(msgs), seq, complete)
+	}
+
+	// Once the buffer dropped what was missed, the client needs a snapshot instead
+	for i := 0; i < 3; i++ {
+		svc.PublishMessage(ctx, domain.NewUserLeftMessage("room", "user-2"))
+	}
+	if _, complete, seq, _ := svc.Backfill(ctx, "room", 1); complete || seq != 6 {
+		t.Errorf("Expected an incomplete backfill up to seq 6, got complete %v up to %d", complete, seq)
+	}
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+// SlowConsumerCloseCode closes sessions that can't keep up with their room
+const SlowConsumerCloseCode = 4001
+
+// RoomDeletedCloseCode closes the sessions of a room that was deleted
+const RoomDeletedCloseCode = 4003
+
+// RoomRestrictedCloseCode closes the sessions of non-members in a room that was made private
+const RoomRestrictedCloseCode = 4004
+
+// outboundWindow is how many frames a session may have handed to melody but not yet
+// written to the socket. It stays well under melody's own buffer, which drops frames
+// silently once full.
+const outboundWindow = 32
+
+// OutboundStats is a snapshot of the outbound queues for monitoring
+type OutboundStats struct {
+	Sessions        int   `json:"sessions"`
+	Queued          int   `json:"queued"`           // Frames waiting across all sessions
+	MaxQueued       int   `json:"max_queued"`       // Frames waiting for the most backed-up session
+	Saturated       int   `json:"saturated"`        // Sessions whose queue is full
+	Coalesced       int64 `json:"coalesced"`        // Chat updates replaced by a newer version before sending
+	Dropped         int64 `json:"dropped"`          // Frames dropped because a queue was full
+	SlowDisconnects int64 `json:"slow_disconnects"` // Sessions closed for staying saturated
+}
+
+// frameWriter is the part of a melody session an outbox writes to
+type frameWriter interface {
+	Write(msg []byte) error
+	CloseWithMsg(msg []byte) error
+}
+
+// Outbound queues frames for each WebSocket session in front of melody
+// Every session gets its own queue and writer, so one slow client never holds up the
+// rest. Queues are indexed by room, so a broadcast only visits the room's own sessions,
+// and within a room by viewport, so a chat frame only goes to sessions that can see
+// it. A chat update still waiting in a queue is replaced by a newer version of the
+// same message, since only the latest text matters. A session whose queue stays full
+// longer than slowAfter is disconnected with SlowConsumerCloseCode.
+type Outbound struct {
+	queueSize      int
+	slowAfter      time.Duration
+	viewportMargin float64 // Screen pixels around a viewport that still receive chat frames
+	logger         *slog.Logger
+
+	mu    sync.RWMutex
+	boxes map[*melody.Session]*outbox
+	rooms map[string]*roomIndex // Channel ID -> its sessions' queues
+
+	coalesced       atomic.Int64
+	dropped         atomic.Int64
+	slowDisconnects atomic.Int64
+}
+
+// NewOutbound creates outbound queues holding up to queueSize frames per session
+// It registers melody's sent handler to learn when frames reach the socket.
+func NewOutbound(m *melody.Melody, queueSize int, slowAfter time.Duration, viewportMargin float64, logger *slog.Logger) *Outbound {
+	o := &Outbound{
+		queueSize:      queueSize,
+		slowAfter:      slowAfter,
+		viewportMargin: viewportMargin,
+		logger:         logger,
+		boxes:          make(map[*melody.Session]*outbox),
+		rooms:          make(map[string]*roomIndex),
+	}
+
+	m.HandleSentMessage(o.sent)
+	return o
+}
+
+// Open starts the queue of a user's session in a channel
+// Frames for sessions that aren't open are discarded.
+func (o *Outbound) Open(sess *melody.Session, channelID, userID string) {
+	box := newOutbox(sess, o)
+	box.channelID = channelID
+	box.userID = userID
+
+	o.add(sess, box)
+	go box.run()
+}
+
+// add indexes a session's queue by session and by channel
+func (o *Outbound) add(sess *melody.Session, box *outbox) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.boxes[sess] = box
+	room, ok := o.rooms[box.channelID]
+	if !ok {
+		room = newRoomIndex()
+		o.rooms[box.channelID] = room
+	}
+	room.add(box)
+}
+
+// Close stops a session's queue and discards what it still holds
+func (o *Outbound) Close(sess *melody.Session) {
+	o.mu.Lock()
+	box, ok := o.boxes[sess]
+	if ok {
+		delete(o.boxes, sess)
+		room := o.rooms[box.channelID]
+		room.remove(box)
+		if room.empty() {
+			delete(o.rooms, box.channelID)
+		}
+	}
+	o.mu.Unlock()
+
+	if ok {
+		box.stop()
+	}
+}
+
+// Send queues a message for one session
+// Direct replies (syncs, snapshots, replays) are bounded by their callers, so they are
+// never dropped and may take a queue past its size; only broadcasts are.
+func (o *Outbound) Send(sess *melody.Session, msg *domain.Message) {
+	o.mu.RLock()
+	box, ok := o.boxes[sess]
+	o.mu.RUnlock()
+
+	if ok {
+		box.enqueue(coalesceKey(msg), msg.Encode(), false)
+	}
+}
+
+// SetViewport limits the chat frames a session receives to those positioned within its
+// viewport, widened by the margin
+func (o *Outbound) SetViewport(sess *melody.Session, viewport domain.Viewport) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	box, ok := o.boxes[sess]
+	if !ok {
+		return
+	}
+	o.rooms[box.channelID].setBounds(box, boundsFor(viewport, o.viewportMargin))
+}
+
+// Sees reports whether a broadcast of the message would reach the session's viewport
+// Replies that resend broadcasts, like backfills, use it to leave out what the session
+// wouldn't have received live.
+func (o *Outbound) Sees(sess *melody.Session, msg *domain.Message) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	box, ok := o.boxes[sess]
+	if !ok {
+		return false
+	}
+	if msg.Type != domain.MessageTypeChat || msg.Position == nil || box.bounds == nil {
+		return true
+	}
+	return box.bounds.contains(*msg.Position)
+}
+
+// Broadcast queues a message for every open session in its channel
+// Sessions of skipUserID are left out, unless it is empty, and chat frames skip sessions
+// whose viewport is elsewhere. A session whose queue is full drops the message.
+func (o *Outbound) Broadcast(msg *domain.Message, skipUserID string) {
+	o.mu.RLock()
+	var boxes []*outbox
+	if room, ok := o.rooms[msg.ChannelID]; ok {
+		boxes = room.recipients(msg, skipUserID)
+	}
+	o.mu.RUnlock()
+
+	key, data := coalesceKey(msg), msg.Encode()
+	for _, box := range boxes {
+		if !box.enqueue(key, data, true) && msg.Seq > 0 {
+			box.lost(msg.Seq)
+		}
+	}
+}
+
+// CloseRoom closes every open session in a channel with the given close code and reason
+// It returns how many sessions were closed.
+func (o *Outbound) CloseRoom(channelID string, code int, reason string) int {
+	return o.CloseRoomExcept(channelID, nil, code, reason)
+}
+
+// CloseRoomExcept closes the open sessions in a channel of users not in keep
+// It returns how many sessions were closed.
+func (o *Outbound) CloseRoomExcept(channelID string, keep map[string]bool, code int, reason string) int {
+	o.mu.RLock()
+	var boxes []*outbox
+	if room, ok := o.rooms[channelID]; ok {
+		boxes = make([]*outbox, 0, len(room.sessions))
+		for box := range room.sessions {
+			if !keep[box.userID] {
+				boxes = append(boxes, box)
+			}
+		}
+	}
+	o.mu.RUnlock()
+
+	closeMsg := melody.FormatCloseMessage(code, reason)
+	for _, box := range boxes {
+		if err := box.sess.CloseWithMsg(closeMsg); err != nil {
+			o.logger.Debug("Failed to close session", "error", err, "channel", channelID)
+		}
+	}
+	return len(boxes)
+}
+
+// Stats returns the current queue depths and counters
+func (o *Outbound) Stats() OutboundStats {
+	o.mu.RLock()
+	boxes := make([]*outbox, 0, len(o.boxes))
+	for _, box := range o.boxes {
+		boxes = append(boxes, box)
+	}
+	o.mu.RUnlock()
+
+	stats := OutboundStats{
+		Sessions:        len(boxes),
+		Coalesced:       o.coalesced.Load(),
+		Dropped:         o.dropped.Load(),
+		SlowDisconnects: o.slowDisconnects.Load(),
+	}
+	for _, box := range boxes {
+		depth, saturated := box.depth()
+		stats.Queued += depth
+		stats.MaxQueued = max(stats.MaxQueued, depth)
+		if saturated {
+			stats.Saturated++
+		}
+	}
+	return stats
+}
+
+// sent is melody's sent handler: one of a session's frames reached the socket
+func (o *Outbound) sent(sess *melody.Session, _ []byte) {
+	o.mu.RLock()
+	box, ok := o.boxes[sess]
+	o.mu.RUnlock()
+
+	if ok {
+		box.written()
+	}
+}
+
+// coalesceKey returns the key under which a queued message is superseded by a newer one
+// Chat messages coalesce because each keystroke resends the whole text, and cursor
+// moves because only a user's latest position matters. Clients choose message IDs, so
+// chat keys include the author; otherwise one user could replace another's draft.
+func coalesceKey(msg *domain.Message) string {
+	switch {
+	case msg.Type == domain.MessageTypeChat && msg.MessageID != nil:
+		return "chat:" + msg.UserID + ":" + *msg.MessageID
+	case msg.Type == domain.MessageTypeCursorMoved:
+		return "cursor:" + msg.UserID
+	}
+	return ""
+}
+
+// outboundFrame is an encoded frame waiting in an outbox
+type outboundFrame struct {
+	key  string // Non-empty if a later frame with the same key replaces this one
+	data []byte
+}
+
+// outbox is one session's queue and the state of its writer
+type outbox struct {
+	sess      frameWriter
+	outbound  *Outbound
+	wake      chan struct{}
+	channelID string
+	userID    string
+
+	// Guarded by Outbound.mu
+	bounds *viewBounds // Nil while the session receives the whole room
+	cells  []gridCell
+
+	mu             sync.Mutex
+	pending        []outboundFrame
+	inflight       int       // Handed to melody, not yet written to the socket
+	saturatedSince time.Time // Zero unless the queue is full
+	gap            bool      // Sequenced broadcasts were dropped; a gap frame is owed
+	gapSince       int64     // Sequence number the session has everything up to, as far as we know
+	closed         bool
+}
+
+func newOutbox(sess frameWriter, o *Outbound) *outbox {
+	return &outbox{
+		sess:     sess,
+		outbound: o,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// enqueue adds a frame, replacing a pending frame with the same key
+// A bounded frame is dropped if the queue is full. It reports whether the frame was queued.
+func (b *outbox) enqueue(key string, data []byte, bounded bool) bool {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return false
+	}
+
+	if key != "" {
+		for i := range b.pending {
+			if b.pending[i].key == key {
+				b.pending[i].data = data
+				b.mu.Unlock()
+				b.outbound.coalesced.Add(1)
+				return true
+			}
+		}
+	}
+
+	if bounded && len(b.pending) >= b.outbound.queueSize {
+		now := time.Now()
+		if b.saturatedSince.IsZero() {
+			b.saturatedSince = now
+		}
+		slow := now.Sub(b.saturatedSince) >= b.outbound.slowAfter
+		if slow {
+			b.closed = true
+		}
+		b.mu.Unlock()
+
+		b.outbound.dropped.Add(1)
+		if slow {
+			b.disconnectSlow()
+		}
+		return false
+	}
+
+	b.pending = append(b.pending, outboundFrame{key: key, data: data})
+	b.mu.Unlock()
+	b.signal()
+	return true
+}
+
+// lost records that the broadcast numbered seq was dropped, so the session is owed a gap frame
+// The gap starts before the earliest message dropped since the last one was sent.
+func (b *outbox) lost(seq int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.gap || seq-1 < b.gapSince {
+		b.gapSince = seq - 1
+	}
+	b.gap = true
+}
+
+// disconnectSlow closes a session that stayed saturated too long
+func (b *outbox) disconnectSlow() {
+	b.outbound.slowDisconnects.Add(1)
+	b.outbound.logger.Warn("Disconnecting slow consumer", "queue_size", b.outbound.queueSize, "saturated_for", b.outbound.slowAfter)
+
+	closeMsg := melody.FormatCloseMessage(SlowConsumerCloseCode, "slow consumer")
+	if err := b.sess.CloseWithMsg(closeMsg); err != nil {
+		b.outbound.logger.Debug("Failed to close slow consumer", "error", err)
+	}
+	b.signal()
+}
+
+// run hands queued frames to melody, keeping at most outboundWindow in flight
+func (b *outbox) run() {
+	for {
+		b.mu.Lock()
+		for !b.closed && ((len(b.pending) == 0 && !b.gap) || b.inflight >= outboundWindow) {
+			b.mu.Unlock()
+			<-b.wake
+			b.mu.Lock()
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return
+		}
+
+		var data []byte
+		if b.gap && len(b.pending) < b.outbound.queueSize {
+			// Once there is room again, tell the client what it missed before anything newer
+			data = domain.NewGapMessage(b.channelID, b.gapSince).Encode()
+			b.gap = false
+		} else {
+			data = b.pending[0].data
+			b.pending[0] = outboundFrame{}
+			b.pending = b.pending[1:]
+		}
+		b.inflight++
+		if len(b.pending) < b.outbound.queueSize {
+			b.saturatedSince = time.Time{}
+		}
+		b.mu.Unlock()
+
+		if err := b.sess.Write(data); err != nil {
+			// Session closed; Close will clean up
+			return
+		}
+	}
+}
+
+// written records that melody wrote one of this session's frames to the socket
+func (b *outbox) written() {
+	b.mu.Lock()
+	if b.inflight > 0 {
+		b.inflight--
+	}
+	b.mu.Unlock()
+	b.signal()
+}
+
+// depth returns how many frames are waiting and whether the queue is full
+func (b *outbox) depth() (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) + b.inflight, !b.saturatedSince.IsZero()
+}
+
+// stop ends the writer and discards pending frames
+func (b *outbox) stop() {
+	b.mu.Lock()
+	b.closed = true
+	b.pending = nil
+	b.mu.Unlock()
+	b.signal()
+}
+
+// signal wakes the writer without blocking
+func (b *outbox) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+// recordingWriter is a frameWriter that keeps written frames and the close payload
+type recordingWriter struct {
+	mu     sync.Mutex
+	frames []string
+	closed []byte
+}
+
+func (w *recordingWriter) Write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.frames = append(w.frames, string(msg))
+	return nil
+}
+
+func (w *recordingWriter) CloseWithMsg(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = msg
+	return nil
+}
+
+func (w *recordingWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.frames)
+}
+
+func newTestOutbound(queueSize int, slowAfter time.Duration) *Outbound {
+	return &Outbound{
+		queueSize: queueSize,
+		slowAfter: slowAfter,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		boxes:     make(map[*melody.Session]*outbox),
+		rooms:     make(map[string]*roomIndex),
+	}
+}
+
+// waitForWrites waits until the writer has written n frames
+func waitForWrites(t *testing.T, w *recordingWriter, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for w.written() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d frames written, got %d", n, w.written())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutbox_CoalescesPendingChatUpdates(t *testing.T) {
+	o := newTestOutbound(8, time.Second)
+	w := &recordingWriter{}
+	box := newOutbox(w, o)
+
+	// Queued before the writer starts, as if the client were behind
+	box.enqueue("msg-1", []byte("h"), true)
+	box.enqueue("", []byte("joined"), true)
+	box.enqueue("msg-1", []byte("hi"), true)
+	box.enqueue("msg-1", []byte("hi!"), true)
+
+	if depth, _ := box.depth(); depth != 2 {
+		t.Errorf("Expected 2 queued frames, got %d", depth)
+	}
+	if n := o.coalesced.Load(); n != 2 {
+		t.Errorf("Expected 2 coalesced updates, got %d", n)
+	}
+
+	go box.run()
+	defer box.stop()
+	waitForWrites(t, w, 2)
+
+	// The update keeps its place in the queue with the latest text
+	if w.frames[0] != "hi!" || w.frames[1] != "joined" {
+		t.Errorf("Expected [hi! joined], got %v", w.frames)
+	}
+}
+
+func TestOutbox_CoalescesPerAuthor(t *testing.T) {
+	o := newTestOutbound(8, time.Second)
+	w := &recordingWriter{}
+	box := newOutbox(w, o)
+
+	// Message IDs are chosen by clients, so two authors can pick the same one
+	messageID := "msg-1"
+	for _, userID := range []string{"alice", "bob"} {
+		payload := "from " + userID
+		msg := &domain.Message{Type: domain.MessageTypeChat, MessageID: &messageID, UserID: userID, Payload: &payload}
+		box.enqueue(coalesceKey(msg), msg.Encode(), true)
+	}
+
+	if n := o.coalesced.Load(); n != 0 {
+		t.Errorf("Expected no coalesced updates, got %d", n)
+	}
+
+	go box.run()
+	defer box.stop()
+	waitForWrites(t, w, 2)
+
+	for i, userID := range []string{"alice", "bob"} {
+		var got domain.Message
+		if err := json.Unmarshal([]byte(w.frames[i]), &got); err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if got.UserID != userID {
+			t.Errorf("Expected frame %d from %s, got %s", i, userID, got.UserID)
+		}
+	}
+}
+
+func TestOutbox_KeepsWindowInFlight(t *testing.T) {
+	o := newTestOutbound(100, time.Second)
+	w := &recordingWriter{}
+	box := newOutbox(w, o)
+	go box.run()
+	defer box.stop()
+
+	for i := 0; i < outboundWindow+8; i++ {
+		box.enqueue("", []byte(fmt.Sprint(i)), true)
+	}
+
+	// Melody hasn't reported any frame written to the socket yet
+	waitForWrites(t, w, outboundWindow)
+	time.Sleep(20 * time.Millisecond)
+	if n := w.written(); n != outboundWindow {
+		t.Fatalf("Expected %d frames in flight, got %d", outboundWindow, n)
+	}
+
+	for i := 0; i < 8; i++ {
+		box.written()
+	}
+	waitForWrites(t, w, outboundWindow+8)
+}
+
+func TestOutbox_DisconnectsSlowConsumers(t *testing.T) {
+	o := newTestOutbound(2, 20*time.Millisecond)
+	w := &recordingWriter{}
+	box := newOutbox(w, o)
+
+	box.enqueue("", []byte("1"), true)
+	box.enqueue("", []byte("2"), true)
+
+	// Full: broadcasts are dropped but direct replies still get through
+	box.enqueue("", []byte("3"), true)
+	box.enqueue("", []byte("sync"), false)
+	if depth, saturated := box.depth(); depth != 3 || !saturated {
+		t.Errorf("Expected 3 queued and saturated, got %d (saturated %v)", depth, saturated)
+	}
+	if n := o.dropped.Load(); n != 1 {
+		t.Errorf("Expected 1 dropped frame, got %d", n)
+	}
+	if w.closed != nil {
+		t.Fatal("Expected the session to stay open within the slow consumer timeout")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	box.enqueue("", []byte("4"), true)
+
+	if w.closed == nil {
+		t.Fatal("Expected the slow consumer to be closed")
+	}
+	if code := binary.BigEndian.Uint16(w.closed); code != SlowConsumerCloseCode {
+		t.Errorf("Expected close code %d, got %d", SlowConsumerCloseCode, code)
+	}
+	if n := o.slowDisconnects.Load(); n != 1 {
+		t.Errorf("Expected 1 slow disconnect, got %d", n)
+	}
+}
+
+func TestOutbound_ReportsDroppedBroadcasts(t *testing.T) {
+	o := newTestOutbound(2, time.Second)
+	w := &recordingWriter{}
+	box := newOutbox(w, o)
+	box.channelID = "room-a"
+	o.add(&melody.Session{}, box)
+
+	// The writer isn't running yet, so the queue fills up and seq 3 and 4 are dropped
+	for seq := int64(1); seq <= 4; seq++ {
+		msg := domain.NewUserJoinedMessage("room-a", fmt.Sprint("user-", seq), nil, nil)
+		msg.Seq = seq
+		o.Broadcast(msg, "")
+	}
+
+	go box.run()
+	defer box.stop()
+	waitForWrites(t, w, 3)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var gap domain.Message
+	if err := json.Unmarshal([]byte(w.frames[1]), &gap); err != nil {
+		t.Fatalf("Failed to decode frame: %v", err)
+	}
+	if gap.Type != domain.MessageTypeGap || gap.SinceSeq != 2 {
+		t.Errorf("Expected a gap since seq 2 once the queue had room, got %s", w.frames[1])
+	}
+}
+
+func TestOutbound_BroadcastsToRoom(t *testing.T) {
+	o := newTestOutbound(8, time.Second)
+
+	writers := map[string]*recordingWriter{}
+	for _, s := range []struct{ name, channelID, userID string }{
+		{"alice", "room-a", "alice"},
+		{"alice-tab", "room-a", "alice"},
+		{"bob", "room-a", "bob"},
+		{"carol", "room-b", "carol"},
+	} {
+		w := &recordingWriter{}
+		box := newOutbox(w, o)
+		box.channelID, box.userID = s.channelID, s.userID
+		o.add(&melody.Session{}, box)
+		writers[s.name] = w
+
+		go box.run()
+		defer box.stop()
+	}
+
+	o.Broadcast(domain.NewMessage("msg-1", "room-a", "alice", "hi", domain.Position{}), "alice")
+	o.Broadcast(domain.NewUserJoinedMessage("room-a", "bob", nil, nil), "")
+
+	waitForWrites(t, writers["alice"], 1)
+	waitForWrites(t, writers["alice-tab"], 1)
+	waitForWrites(t, writers["bob"], 2)
+	time.Sleep(20 * time.Millisecond)
+
+	if n := writers["alice"].written(); n != 1 {
+		t.Errorf("Expected alice to receive only the join, got %d frames", n)
+	}
+	if n := writers["carol"].written(); n != 0 {
+		t.Errorf("Expected carol in another room to receive nothing, got %d frames", n)
+	}
+}
+
+func TestOutbound_CloseRoom(t *testing.T) {
+	o := newTestOutbound(8, time.Second)
+
+	writers := map[string]*recordingWriter{}
+	for _, s := range []struct{ name, channelID string }{
+		{"alice", "room-a"},
+		{"bob", "room-a"},
+		{"carol", "room-b"},
+	} {
+		w := &recordingWriter{}
+		box := newOutbox(w, o)
+		box.channelID, box.userID = s.channelID, s.name
+		o.add(&melody.Session{}, box)
+		writers[s.name] = w
+	}
+
+	if n := o.CloseRoom("room-a", RoomDeletedCloseCode, "room deleted"); n != 2 {
+		t.Errorf("Expected 2 sessions closed, got %d", n)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		closed := writers[name].closed
+		if closed == nil {
+			t.Fatalf("Expected %s's session to be closed", name)
+		}
+		if code := binary.BigEndian.Uint16(closed); code != RoomDeletedCloseCode {
+			t.Errorf("Expected close code %d for %s, got %d", RoomDeletedCloseCode, name, code)
+		}
+	}
+	if writers["carol"].closed != nil {
+		t.Error("Expected carol in another room to stay connected")
+	}
+	if n := o.CloseRoom("room-c", RoomDeletedCloseCode, "room deleted"); n != 0 {
+		t.Errorf("Expected no sessions closed in an empty room, got %d", n)
+	}
+}
+
+func TestOutbound_CloseRoomExcept(t *testing.T) {
+	o := newTestOutbound(8, time.Second)
+
+	writers := map[string]*recordingWriter{}
+	for _, s := range []struct{ name, userID string }{
+		{"alice", "alice"},
+		{"alice-tab", "alice"},
+		{"bob", "bob"},
+	} {
+		w := &recordingWriter{}
+		box := newOutbox(w, o)
+		box.channelID, box.userID = "room-a", s.userID
+		o.add(&melody.Session{}, box)
+		writers[s.name] = w
+	}
+
+	// Every tab of a user who may stay is kept
+	if n := o.CloseRoomExcept("room-a", map[string]bool{"alice": true}, RoomRestrictedCloseCode, "room made private"); n != 1 {
+		t.Errorf("Expected 1 session closed, got %d", n)
+	}
+	if closed := writers["bob"].closed; closed == nil || binary.BigEndian.Uint16(closed) != RoomRestrictedCloseCode {
+		t.Errorf("Expected bob's session closed with code %d, got %v", RoomRestrictedCloseCode, closed)
+	}
+	for _, name := range []string{"alice", "alice-tab"} {
+		if writers[name].closed != nil {
+			t.Errorf("Expected %s to stay connected", name)
+		}
+	}
+}
+
+// discardWriter reports every frame written straight away, like a client keeping up
+type discardWriter struct {
+	box *outbox
+}
+
+func (w *discardWriter) Write(msg []byte) error {
+	w.box.written()
+	return nil
+}
+
+func (w *discardWriter) CloseWithMsg(msg []byte) error {
+	return nil
+}
+
+// benchSession stands in for a melody session's keys, which Get reads under a lock
+type benchSession struct {
+	mu   sync.RWMutex
+	keys map[string]any
+	box  *outbox
+}
+
+func (s *benchSession) Get(key string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+// newBenchOutbound opens sessions spread evenly over rooms, tagged like the handler tags them
+func newBenchOutbound(b *testing.B, sessions, rooms int) (*Outbound, []*benchSession) {
+	b.Helper()
+
+	o := newTestOutbound(256, time.Hour)
+	all := make([]*benchSession, 0, sessions)
+	for i := 0; i < sessions; i++ {
+		channelID, userID := fmt.Sprintf("room-%d", i%rooms), fmt.Sprintf("user-%d", i)
+
+		w := &discardWriter{}
+		box := newOutbox(w, o)
+		w.box = box
+		box.channelID, box.userID = channelID, userID
+		o.add(&melody.Session{}, box)
+
+		all = append(all, &benchSession{
+			keys: map[string]any{"channel_id": channelID, "user_id": userID},
+			box:  box,
+		})
+
+		go box.run()
+		b.Cleanup(box.stop)
+	}
+	return o, all
+}
+
+// BenchmarkBroadcast compares broadcasting through the room index with the filter it
+// replaced, which ran over every session on the node: 10k sessions in 500 rooms.
+func BenchmarkBroadcast(b *testing.B) {
+	const sessions, rooms = 10000, 500
+
+	msgs := make([]*domain.Message, rooms)
+	for i := range msgs {
+		msgs[i] = domain.NewMessage(fmt.Sprintf("msg-%d", i), fmt.Sprintf("room-%d", i), "nobody", "hi", domain.Position{})
+	}
+
+	b.Run("room_index", func(b *testing.B) {
+		o, _ := newBenchOutbound(b, sessions, rooms)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			msg := msgs[i%rooms]
+			o.Broadcast(msg, msg.UserID)
+		}
+	})
+
+	b.Run("scan_all_sessions", func(b *testing.B) {
+		o, all := newBenchOutbound(b, sessions, rooms)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			msg := msgs[i%rooms]
+
+			o.mu.RLock()
+			boxes := make([]*outbox, 0)
+			for _, sess := range all {
+				channelID, _ := sess.Get("channel_id")
+				userID, _ := sess.Get("user_id")
+				if channelID == msg.ChannelID && userID != msg.UserID {
+					boxes = append(boxes, sess.box)
+				}
+			}
+			o.mu.RUnlock()
+
+			key, data := coalesceKey(msg), msg.Encode()
+			for _, box := range boxes {
+				box.enqueue(key, data, true)
+			}
+		}
+	})
+}
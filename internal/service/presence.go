@@ -0,0 +1,31 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+)
+
+// PresenceStore tracks the sessions connected to each channel
+// Every WebSocket connection is its own session, so a user with several tabs open
+// stays present until the last one closes. Sessions that stop heartbeating expire.
+type PresenceStore interface {
+	// Join adds a session and returns how many sessions its user now has in the channel
+	Join(ctx context.Context, channelID string, session domain.PresenceSession) (int, error)
+	// Leave removes a session and returns how many sessions its user still has in the channel
+	Leave(ctx context.Context, channelID, userID, sessionID string) (int, error)
+	// Touch keeps a session alive; active also records user activity
+	Touch(ctx context.Context, channelID, sessionID string, active bool) error
+	// UpdateUser changes the name and color on all of a user's sessions in the channel
+	UpdateUser(ctx context.Context, channelID, userID string, username, color *string) error
+	// ListUsers returns the channel's users, one entry per user, with their status
+	ListUsers(ctx context.Context, channelID string) ([]domain.UserInfo, error)
+	// Sweep removes lapsed sessions and returns the users left with none in their channel
+	// Lapsed sessions are hidden from ListUsers but kept until swept, so no departure is missed.
+	Sweep(ctx context.Context) ([]domain.PresenceDeparture, error)
+}
+
+// LeaderLock elects one node to run cluster-wide background jobs
+type LeaderLock interface {
+	// TryAcquire takes or renews the lock, reporting whether this node holds it
+	TryAcquire(ctx context.Context) (bool, error)
+}
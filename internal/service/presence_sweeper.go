@@ -0,0 +1,87 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MessagePublisher publishes messages to a room's subscribers
+type MessagePublisher interface {
+	PublishMessage(ctx context.Context, msg *domain.Message) error
+}
+
+// PresenceSweeper announces users whose sessions lapsed without a disconnect
+// Sessions normally leave through the WebSocket handler, but when a node crashes its
+// sessions just stop heartbeating. The sweeper removes them once their TTL runs out and
+// publishes user_left, so other clients don't keep showing ghost users. Only the node
+// holding the leader lock sweeps, so each departure is announced once.
+type PresenceSweeper struct {
+	store     PresenceStore
+	leader    LeaderLock
+	publisher MessagePublisher
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+// NewPresenceSweeper creates a presence sweeper
+// leader may be nil on a single node, in which case it always sweeps
+func NewPresenceSweeper(store PresenceStore, leader LeaderLock, publisher MessagePublisher, interval time.Duration, logger *slog.Logger) *PresenceSweeper {
+	return &PresenceSweeper{
+		store:     store,
+		leader:    leader,
+		publisher: publisher,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run sweeps every interval until ctx is cancelled
+func (s *PresenceSweeper) Run(ctx context.Context) error {
+	s.logger.Info("Starting presence sweeper", "interval", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Presence sweeper stopped")
+			return ctx.Err()
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+// sweep removes lapsed sessions and announces each departed user, if this node is the leader
+func (s *PresenceSweeper) sweep(ctx context.Context) {
+	if s.leader != nil {
+		leading, err := s.leader.TryAcquire(ctx)
+		if err != nil {
+			s.logger.Error("Failed to acquire presence sweeper lock", "error", err)
+			return
+		}
+		if !leading {
+			return
+		}
+	}
+
+	departures, err := s.store.Sweep(ctx)
+	if err != nil {
+		s.logger.Error("Failed to sweep presence", "error", err)
+		return
+	}
+
+	for _, d := range departures {
+		leaveMsg := domain.NewUserLeftMessage(d.ChannelID, d.UserID)
+		if err := s.publisher.PublishMessage(ctx, leaveMsg); err != nil {
+			s.logger.Error("Failed to publish leave event", "error", err, "user_id", d.UserID, "channel_id", d.ChannelID)
+		}
+	}
+
+	if len(departures) > 0 {
+		s.logger.Info("Swept lapsed presence", "departures", len(departures))
+	}
+}
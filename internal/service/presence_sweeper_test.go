@@ -0,0 +1,62 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/presence"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// recordingPublisher is a MessagePublisher that keeps published messages
+type recordingPublisher struct {
+	published []*domain.Message
+}
+
+func (p *recordingPublisher) PublishMessage(ctx context.Context, msg *domain.Message) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+// fixedLock is a LeaderLock that is either always or never held
+type fixedLock bool
+
+func (l fixedLock) TryAcquire(ctx context.Context) (bool, error) {
+	return bool(l), nil
+}
+
+func TestPresenceSweeper_AnnouncesLapsedUsers(t *testing.T) {
+	now := time.Now()
+	store := presence.NewMemoryStore(func() time.Time { return now })
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	store.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-1", UserID: "user-a"})
+	now = now.Add(presence.SessionTTL)
+
+	// A follower leaves the sweeping to the leader
+	publisher := &recordingPublisher{}
+	NewPresenceSweeper(store, fixedLock(false), publisher, time.Minute, logger).sweep(ctx)
+	if len(publisher.published) != 0 {
+		t.Fatalf("Expected follower not to sweep, got %d messages", len(publisher.published))
+	}
+
+	NewPresenceSweeper(store, fixedLock(true), publisher, time.Minute, logger).sweep(ctx)
+	if len(publisher.published) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(publisher.published))
+	}
+	left := publisher.published[0]
+	if left.Type != domain.MessageTypeUserLeft || left.UserID != "user-a" || left.ChannelID != "room" {
+		t.Errorf("Expected user_left for user-a in room, got %+v", left)
+	}
+
+	// A single node sweeps without a lock
+	store.Join(ctx, "room", domain.PresenceSession{SessionID: "tab-2", UserID: "user-b"})
+	now = now.Add(presence.SessionTTL)
+	NewPresenceSweeper(store, nil, publisher, time.Minute, logger).sweep(ctx)
+	if len(publisher.published) != 2 || publisher.published[1].UserID != "user-b" {
+		t.Errorf("Expected user_left for user-b, got %+v", publisher.published)
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ResumeStore holds parked sessions so a client reconnecting to any node can claim its own
+type ResumeStore interface {
+	// Park stores a session under its resume token until ttl passes
+	Park(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error
+	// Claim removes and returns a parked session; nil, nil when the token is unknown or expired
+	Claim(ctx context.Context, token string) (*domain.ResumeState, error)
+}
+
+// MessageBuffer keeps each channel's most recent messages so resumed and backfilling sessions can catch up
+type MessageBuffer interface {
+	// Append adds a sequenced message to its channel's buffer, dropping the oldest once full
+	Append(ctx context.Context, msg *domain.Message) error
+	// Since returns the channel's messages after a sequence number, oldest first
+	// complete is false when some of them were already dropped from the buffer.
+	Since(ctx context.Context, channelID string, seq int64) (msgs []*domain.Message, complete bool, err error)
+}
+
+// SessionResumer lets clients that drop their connection pick their session back up
+// A disconnected session is parked instead of leaving presence. If its client reconnects
+// with the resume token from its user_sync within the grace window, it keeps its presence
+// entry without a user_left/user_joined pair and gets the messages it missed. Otherwise
+// the node that parked it finishes the departure once the window closes.
+type SessionResumer struct {
+	store     ResumeStore
+	buffer    MessageBuffer
+	sequencer Sequencer
+	grace     time.Duration
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]*parkedSession
+}
+
+// parkedSession is a session parked by this node, waiting for its grace window to close
+type parkedSession struct {
+	timer  *time.Timer
+	expire func(domain.ResumeState)
+}
+
+// NewSessionResumer creates a session resumer
+func NewSessionResumer(store ResumeStore, buffer MessageBuffer, sequencer Sequencer, grace time.Duration, logger *slog.Logger) *SessionResumer {
+	return &SessionResumer{
+		store:     store,
+		buffer:    buffer,
+		sequencer: sequencer,
+		grace:     grace,
+		logger:    logger,
+		pending:   make(map[string]*parkedSession),
+	}
+}
+
+// NewResumeToken returns a random, unguessable resume token
+func NewResumeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate resume token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Park holds a disconnected session for the grace window
+// expire is called with the session if nobody has claimed it when the window closes.
+// The store keeps the token for twice the window, so this node's claim at expiry
+// can't lose to the store's own TTL.
+func (r *SessionResumer) Park(ctx context.Context, token string, state domain.ResumeState, expire func(domain.ResumeState)) error {
+	seq, err := r.sequencer.Current(ctx, state.ChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to get sequence: %w", err)
+	}
+	state.Position = seq
+
+	if err := r.store.Park(ctx, token, state, 2*r.grace); err != nil {
+		return fmt.Errorf("failed to park session: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending[token] = &parkedSession{
+		timer:  time.AfterFunc(r.grace, func() { r.expire(token) }),
+		expire: expire,
+	}
+
+	r.logger.Debug("Parked session", "session_id", state.SessionID, "channel_id", state.ChannelID, "grace", r.grace)
+	return nil
+}
+
+// expire finishes a parked session's departure unless it was resumed, possibly on another node
+func (r *SessionResumer) expire(token string) {
+	r.mu.Lock()
+	parked, ok := r.pending[token]
+	delete(r.pending, token)
+	r.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	state, err := r.store.Claim(context.Background(), token)
+	if err != nil {
+		// Left for the presence sweeper once the session's TTL runs out
+		r.logger.Error("Failed to claim expired session", "error", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	parked.expire(*state)
+}
+
+// Claim takes a parked session for a reconnecting client; nil, nil when it can't be resumed
+func (r *SessionResumer) Claim(ctx context.Context, token string) (*domain.ResumeState, error) {
+	state, err := r.store.Claim(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim session: %w", err)
+	}
+
+	// Parked here: the departure no longer needs finishing
+	r.mu.Lock()
+	if parked, ok := r.pending[token]; ok {
+		parked.timer.Stop()
+		delete(r.pending, token)
+	}
+	r.mu.Unlock()
+
+	return state, nil
+}
+
+// Missed returns the channel's messages a resumed session didn't receive
+// complete is false when the buffer no longer has all of them.
+func (r *SessionResumer) Missed(ctx context.Context, state domain.ResumeState) ([]*domain.Message, bool, error) {
+	return r.buffer.Since(ctx, state.ChannelID, state.Position)
+}
+
+// ExpireAll closes every grace window this node is waiting on, e.g. before shutting down
+func (r *SessionResumer) ExpireAll() {
+	r.mu.Lock()
+	tokens := make([]string, 0, len(r.pending))
+	for token, parked := range r.pending {
+		if parked.timer.Stop() {
+			tokens = append(tokens, token)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, token := range tokens {
+		r.expire(token)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/resume"
+	"asocial/internal/sequence"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSessionResumer_ExpiresUnclaimedSessions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := NewSessionResumer(resume.NewMemoryStore(nil), resume.NewMemoryBuffer(8), sequence.NewMemorySequencer(), 20*time.Millisecond, logger)
+	ctx := context.Background()
+
+	expired := make(chan domain.ResumeState, 1)
+	state := domain.ResumeState{SessionID: "tab-1", UserID: "user-a", ChannelID: "room"}
+	if err := r.Park(ctx, "token", state, func(s domain.ResumeState) { expired <- s }); err != nil {
+		t.Fatalf("Park() error = %v", err)
+	}
+
+	select {
+	case got := <-expired:
+		if got.SessionID != "tab-1" {
+			t.Errorf("Expected tab-1 to expire, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the session to expire after the grace window")
+	}
+
+	if got, _ := r.Claim(ctx, "token"); got != nil {
+		t.Errorf("Expected an expired session not to be claimable, got %+v", got)
+	}
+}
+
+func TestSessionResumer_ClaimOnAnotherNode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := resume.NewMemoryStore(nil)
+	buffer := resume.NewMemoryBuffer(8)
+	sequencer := sequence.NewMemorySequencer()
+	parking := NewSessionResumer(store, buffer, sequencer, 20*time.Millisecond, logger)
+	resuming := NewSessionResumer(store, buffer, sequencer, 20*time.Millisecond, logger)
+	ctx := context.Background()
+
+	publish := func(messageID string) {
+		msg := domain.NewMessage(messageID, "room", "user-b", "hi", domain.Position{})
+		msg.Seq, _ = sequencer.Next(ctx, "room")
+		buffer.Append(ctx, msg)
+	}
+
+	publish("before")
+
+	expired := make(chan domain.ResumeState, 1)
+	state := domain.ResumeState{SessionID: "tab-1", UserID: "user-a", ChannelID: "room"}
+	parking.Park(ctx, "token", state, func(s domain.ResumeState) { expired <- s })
+
+	publish("during")
+
+	claimed, err := resuming.Claim(ctx, "token")
+	if err != nil || claimed == nil {
+		t.Fatalf("Claim() = %+v, %v", claimed, err)
+	}
+
+	// Only what was sent after the disconnect is missed
+	missed, complete, err := resuming.Missed(ctx, *claimed)
+	if err != nil {
+		t.Fatalf("Missed() error = %v", err)
+	}
+	if !complete || len(missed) != 1 || *missed[0].MessageID != "during" {
+		t.Errorf("Expected only the message sent while away, got %d (complete %v)", len(missed), complete)
+	}
+
+	// The parking node's window closes without ending the resumed session
+	select {
+	case got := <-expired:
+		t.Errorf("Expected a resumed session not to expire, got %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSessionResumer_ExpireAll(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := NewSessionResumer(resume.NewMemoryStore(nil), resume.NewMemoryBuffer(8), sequence.NewMemorySequencer(), time.Hour, logger)
+	ctx := context.Background()
+
+	var expired []string
+	for _, token := range []string{"token-1", "token-2"} {
+		state := domain.ResumeState{SessionID: token, UserID: "user-a", ChannelID: "room"}
+		r.Park(ctx, token, state, func(s domain.ResumeState) { expired = append(expired, s.SessionID) })
+	}
+	r.Claim(ctx, "token-2")
+
+	r.ExpireAll()
+	if len(expired) != 1 || expired[0] != "token-1" {
+		t.Errorf("Expected only the unclaimed session to expire, got %v", expired)
+	}
+}
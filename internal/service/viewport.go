@@ -0,0 +1,170 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"math"
+)
+
+// viewportCellSize is the side of a spatial grid cell, in canvas units
+const viewportCellSize = 512
+
+// maxViewportCells caps the grid cells one viewport is filed under
+// A session zoomed out further than that receives the whole room.
+const maxViewportCells = 256
+
+// gridCell identifies a square of the canvas in a room's spatial grid
+type gridCell struct {
+	x, y int64
+}
+
+// cellAt returns the grid cell containing a canvas position
+func cellAt(x, y float64) gridCell {
+	return gridCell{
+		x: int64(math.Floor(x / viewportCellSize)),
+		y: int64(math.Floor(y / viewportCellSize)),
+	}
+}
+
+// viewBounds is the part of the canvas a session receives chat frames for
+type viewBounds struct {
+	minX, minY, maxX, maxY float64
+}
+
+// boundsFor returns a viewport's bounds, widened by margin screen pixels on every side
+func boundsFor(v domain.Viewport, margin float64) viewBounds {
+	m := margin / v.Zoom
+	return viewBounds{
+		minX: v.X - m,
+		minY: v.Y - m,
+		maxX: v.X + v.Width + m,
+		maxY: v.Y + v.Height + m,
+	}
+}
+
+func (b viewBounds) contains(p domain.Position) bool {
+	return p.X >= b.minX && p.X <= b.maxX && p.Y >= b.minY && p.Y <= b.maxY
+}
+
+// cells returns the grid cells the bounds overlap; nil, false if there are more than
+// maxViewportCells
+func (b viewBounds) cells() ([]gridCell, bool) {
+	// Counted before converting, so far-off coordinates can't overflow
+	columns := math.Floor(b.maxX/viewportCellSize) - math.Floor(b.minX/viewportCellSize) + 1
+	rows := math.Floor(b.maxY/viewportCellSize) - math.Floor(b.minY/viewportCellSize) + 1
+	if columns*rows > maxViewportCells {
+		return nil, false
+	}
+
+	lo, hi := cellAt(b.minX, b.minY), cellAt(b.maxX, b.maxY)
+	cells := make([]gridCell, 0, (hi.x-lo.x+1)*(hi.y-lo.y+1))
+	for x := lo.x; x <= hi.x; x++ {
+		for y := lo.y; y <= hi.y; y++ {
+			cells = append(cells, gridCell{x: x, y: y})
+		}
+	}
+	return cells, true
+}
+
+// roomIndex holds the queues of a room's sessions, filed by what part of the canvas they see
+// Sessions that haven't sent a viewport, or see too much of the canvas to file by cell,
+// are unbounded and receive every chat frame.
+type roomIndex struct {
+	sessions  map[*outbox]struct{}
+	unbounded map[*outbox]struct{}
+	cells     map[gridCell]map[*outbox]struct{}
+}
+
+func newRoomIndex() *roomIndex {
+	return &roomIndex{
+		sessions:  make(map[*outbox]struct{}),
+		unbounded: make(map[*outbox]struct{}),
+		cells:     make(map[gridCell]map[*outbox]struct{}),
+	}
+}
+
+// add files a new session as unbounded until it sends its viewport
+func (r *roomIndex) add(box *outbox) {
+	r.sessions[box] = struct{}{}
+	r.unbounded[box] = struct{}{}
+}
+
+// remove forgets a session
+func (r *roomIndex) remove(box *outbox) {
+	r.unfile(box)
+	delete(r.sessions, box)
+}
+
+// empty reports whether the room has no sessions left
+func (r *roomIndex) empty() bool {
+	return len(r.sessions) == 0
+}
+
+// setBounds refiles a session under the cells its new bounds overlap
+func (r *roomIndex) setBounds(box *outbox, bounds viewBounds) {
+	r.unfile(box)
+
+	cells, ok := bounds.cells()
+	if !ok {
+		r.unbounded[box] = struct{}{}
+		return
+	}
+
+	box.bounds = &bounds
+	box.cells = cells
+	for _, cell := range cells {
+		boxes, ok := r.cells[cell]
+		if !ok {
+			boxes = make(map[*outbox]struct{})
+			r.cells[cell] = boxes
+		}
+		boxes[box] = struct{}{}
+	}
+}
+
+// unfile takes a session out of the unbounded set and its cells
+func (r *roomIndex) unfile(box *outbox) {
+	delete(r.unbounded, box)
+	for _, cell := range box.cells {
+		boxes := r.cells[cell]
+		delete(boxes, box)
+		if len(boxes) == 0 {
+			delete(r.cells, cell)
+		}
+	}
+	box.bounds = nil
+	box.cells = nil
+}
+
+// recipients returns the sessions a message goes to, leaving out skipUserID's unless it
+// is empty
+// Chat frames with a position only go to sessions that can see it; everything else goes
+// to the whole room.
+func (r *roomIndex) recipients(msg *domain.Message, skipUserID string) []*outbox {
+	keep := func(box *outbox) bool {
+		return skipUserID == "" || box.userID != skipUserID
+	}
+
+	if msg.Type != domain.MessageTypeChat || msg.Position == nil {
+		boxes := make([]*outbox, 0, len(r.sessions))
+		for box := range r.sessions {
+			if keep(box) {
+				boxes = append(boxes, box)
+			}
+		}
+		return boxes
+	}
+
+	cell := r.cells[cellAt(msg.Position.X, msg.Position.Y)]
+	boxes := make([]*outbox, 0, len(r.unbounded)+len(cell))
+	for box := range r.unbounded {
+		if keep(box) {
+			boxes = append(boxes, box)
+		}
+	}
+	for box := range cell {
+		if keep(box) && box.bounds.contains(*msg.Position) {
+			boxes = append(boxes, box)
+		}
+	}
+	return boxes
+}
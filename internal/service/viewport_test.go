@@ -0,0 +1,93 @@
+package service
+
+import (
+	"asocial/internal/domain"
+	"testing"
+	"time"
+)
+
+// newIndexedBox files a queue for a user into a room index
+func newIndexedBox(room *roomIndex, userID string) *outbox {
+	box := newOutbox(&recordingWriter{}, newTestOutbound(8, time.Second))
+	box.userID = userID
+	room.add(box)
+	return box
+}
+
+func recipientsOf(room *roomIndex, msg *domain.Message) map[string]bool {
+	got := map[string]bool{}
+	for _, box := range room.recipients(msg, "") {
+		got[box.userID] = true
+	}
+	return got
+}
+
+func TestRoomIndex_DeliversChatByViewport(t *testing.T) {
+	room := newRoomIndex()
+	newIndexedBox(room, "newcomer")
+	topLeft := newIndexedBox(room, "top-left")
+	zoomedOut := newIndexedBox(room, "zoomed-out")
+	overview := newIndexedBox(room, "overview")
+
+	room.setBounds(topLeft, boundsFor(domain.Viewport{Width: 800, Height: 600, Zoom: 2}, 200))
+	room.setBounds(zoomedOut, boundsFor(domain.Viewport{Width: 800, Height: 600, Zoom: 0.5}, 200))
+	room.setBounds(overview, boundsFor(domain.Viewport{Width: 20000, Height: 20000, Zoom: 0.1}, 200))
+
+	tests := []struct {
+		name     string
+		position domain.Position
+		want     []string
+	}{
+		// The margin is 100 canvas units at zoom 2 and 400 at zoom 0.5
+		{"inside both viewports", domain.Position{X: 400, Y: 300}, []string{"top-left", "zoomed-out"}},
+		{"within the zoomed in margin", domain.Position{X: 890, Y: 300}, []string{"top-left", "zoomed-out"}},
+		{"within the zoomed out margin", domain.Position{X: 1100, Y: -300}, []string{"zoomed-out"}},
+		{"beyond every margin", domain.Position{X: 5000, Y: 5000}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := domain.NewMessage("msg-1", "room", "author", "hi", tt.position)
+			got := recipientsOf(room, msg)
+
+			// Sessions without a viewport, or too far out to file by cell, get everything
+			want := map[string]bool{"newcomer": true, "overview": true}
+			for _, userID := range tt.want {
+				want[userID] = true
+			}
+			if len(got) != len(want) {
+				t.Fatalf("Expected %v, got %v", want, got)
+			}
+			for userID := range want {
+				if !got[userID] {
+					t.Errorf("Expected %s to receive the message, got %v", userID, got)
+				}
+			}
+		})
+	}
+
+	// Presence events go to the whole room
+	if got := recipientsOf(room, domain.NewUserLeftMessage("room", "author")); len(got) != 4 {
+		t.Errorf("Expected presence to reach all 4 sessions, got %v", got)
+	}
+}
+
+func TestRoomIndex_RefilesMovedViewports(t *testing.T) {
+	room := newRoomIndex()
+	box := newIndexedBox(room, "alice")
+
+	room.setBounds(box, boundsFor(domain.Viewport{Width: 100, Height: 100, Zoom: 1}, 0))
+	room.setBounds(box, boundsFor(domain.Viewport{X: 5000, Y: 5000, Width: 100, Height: 100, Zoom: 1}, 0))
+
+	if got := recipientsOf(room, domain.NewMessage("msg-1", "room", "bob", "hi", domain.Position{X: 50, Y: 50})); len(got) != 0 {
+		t.Errorf("Expected the old viewport to receive nothing, got %v", got)
+	}
+	if got := recipientsOf(room, domain.NewMessage("msg-2", "room", "bob", "hi", domain.Position{X: 5050, Y: 5050})); !got["alice"] {
+		t.Errorf("Expected the new viewport to receive the message, got %v", got)
+	}
+
+	room.remove(box)
+	if !room.empty() || len(room.cells) != 0 || len(room.unbounded) != 0 {
+		t.Errorf("Expected an empty index, got %d cells and %d unbounded", len(room.cells), len(room.unbounded))
+	}
+}
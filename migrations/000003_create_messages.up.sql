@@ -0,0 +1,21 @@
+-- Messages table: stores committed canvas messages so late joiners can see history
+-- id is the client-generated message_id, unique only per room and author; seq gives a
+-- stable order for cursor pagination
+CREATE TABLE messages (
+    id TEXT NOT NULL,
+    seq BIGSERIAL UNIQUE NOT NULL,
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    username TEXT,
+    color TEXT,
+    payload TEXT NOT NULL,
+    pos_x DOUBLE PRECISION NOT NULL,
+    pos_y DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id, id)
+);
+
+CREATE INDEX idx_messages_room_seq ON messages(room_id, seq DESC);
+CREATE INDEX idx_messages_room_position ON messages(room_id, pos_x, pos_y);
+CREATE INDEX idx_messages_room_updated ON messages(room_id, updated_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS room_invites;
+DROP TABLE IF EXISTS room_members;
@@ -0,0 +1,31 @@
+-- Room members table: who may enter a private room, and what they may do there
+-- Roles: owner (manages the room), admin (manages invites), member
+CREATE TABLE room_members (
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX idx_room_members_user_id ON room_members(user_id);
+
+-- Existing owners become members of their rooms
+INSERT INTO room_members (room_id, user_id, role)
+SELECT id, owner_id, 'owner' FROM rooms WHERE owner_id IS NOT NULL;
+
+-- Room invites table: invite links are signed tokens naming a row here, which tracks uses and revocation
+-- max_uses NULL means the invite can be used until it expires or is revoked
+CREATE TABLE room_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member')),
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_room_invites_room_id ON room_invites(room_id, created_at DESC);
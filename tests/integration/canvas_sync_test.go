@@ -0,0 +1,134 @@
+package integration
+
+import (
+	"asocial/internal/auth"
+	"asocial/internal/canvas"
+	"asocial/internal/domain"
+	"asocial/internal/handler"
+	"asocial/internal/presence"
+	"asocial/internal/pubsub"
+	"asocial/internal/service"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCanvasSync_NewJoinerSeesVisibleMessages tests that a late joiner receives the messages still on screen
+func TestCanvasSync_NewJoinerSeesVisibleMessages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping E2E test in short mode")
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	redisPubSub, err := pubsub.NewRedisPubSub(redisAddr, "", "test:canvas", 0, logger)
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	room := &domain.Room{
+		ID:       uuid.New(),
+		Name:     "General",
+		Slug:     "general",
+		IsPublic: true,
+	}
+	channelID := room.ID.String()
+
+	m := melody.New()
+	cache := canvas.NewRedisCache(redisPubSub.Client(), 5*time.Second, logger)
+	msgService := service.NewMessageService(redisPubSub, nil, nil, cache, nil, nil, service.NewOutbound(m, 256, 5*time.Second, 400, logger), logger)
+	guestTokens, err := auth.NewGuestTokenService([]byte(strings.Repeat("k", 32)), time.Hour)
+	require.NoError(t, err)
+	wsHandler := handler.NewWebSocketHandler(m, msgService, presence.NewRedisStore(redisPubSub.Client(), logger), nil, nil, staticRooms{room}, nil, nil, nil, guestTokens, logger)
+
+	go msgService.StartSubscriber(ctx)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", wsHandler.HandleUpgrade)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	dial := func(id string) *websocket.Conn {
+		u := fmt.Sprintf("%s/ws?uid=%s&guest_token=%s&username=%s", wsURL, id, issueGuestToken(t, guestTokens, id), id)
+		ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+		require.NoError(t, err)
+		return ws
+	}
+
+	// Writer joins and drains user_sync, canvas_sync and its own user_joined
+	writer := dial("writer")
+	defer writer.Close()
+	for range 3 {
+		readMessage(t, writer, 2*time.Second)
+	}
+
+	// Writer types two messages, then deletes the second
+	send := func(id, text string) {
+		messageID := id
+		payload := text
+		msg := &domain.Message{
+			Type:      domain.MessageTypeChat,
+			UserID:    "guest:writer",
+			MessageID: &messageID,
+			Payload:   &payload,
+			Position:  &domain.Position{X: 10, Y: 20},
+		}
+		require.NoError(t, writer.WriteMessage(websocket.TextMessage, msg.Encode()))
+	}
+	send("msg-1", "hel")
+	send("msg-1", "hello")
+	send("msg-2", "gone")
+	send("msg-2", "")
+
+	// Give the server time to record the messages
+	require.Eventually(t, func() bool {
+		items, err := cache.Snapshot(ctx, channelID)
+		return err == nil && len(items) == 1 && items[0].Payload == "hello"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// Reader joins and gets the visible canvas right after the user list
+	reader := dial("reader")
+	defer reader.Close()
+
+	sync := readMessage(t, reader, 2*time.Second)
+	assert.Equal(t, domain.MessageTypeUserSync, sync.Type)
+
+	snapshot := readMessage(t, reader, 2*time.Second)
+	require.Equal(t, domain.MessageTypeCanvasSync, snapshot.Type)
+	require.Len(t, snapshot.Messages, 1)
+
+	item := snapshot.Messages[0]
+	assert.Equal(t, "msg-1", item.MessageID)
+	assert.Equal(t, "guest:writer", item.UserID)
+	assert.Equal(t, "hello", item.Payload)
+	assert.Equal(t, domain.Position{X: 10, Y: 20}, item.Position)
+	assertStringPtr(t, item.Username, "writer", "username in canvas")
+	assert.GreaterOrEqual(t, item.AgeMs, int64(0))
+	assert.Less(t, item.AgeMs, int64(5000))
+}
@@ -0,0 +1,64 @@
+package integration
+
+import (
+	"asocial/internal/canvas"
+	"asocial/internal/domain"
+	"asocial/internal/pubsub"
+	"asocial/internal/service"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every cursor store to keep them interchangeable
+
+func TestCursorStore_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	runCursorStoreSuite(t, canvas.NewRedisCursors(redisPubSub.Client(), testLogger()))
+}
+
+func TestCursorStore_Memory(t *testing.T) {
+	runCursorStoreSuite(t, canvas.NewMemoryCursors())
+}
+
+// runCursorStoreSuite checks the behavior every cursor store must share
+func runCursorStoreSuite(t *testing.T, store service.CursorStore) {
+	ctx := context.Background()
+	channelID := "cursors-" + uuid.NewString()
+
+	cursors, err := store.Cursors(ctx, channelID)
+	require.NoError(t, err)
+	assert.Empty(t, cursors)
+
+	require.NoError(t, store.Move(ctx, channelID, "user-a", domain.Position{X: 10, Y: 20}))
+	require.NoError(t, store.Move(ctx, channelID, "user-b", domain.Position{X: 30, Y: 40}))
+	require.NoError(t, store.Move(ctx, channelID, "user-a", domain.Position{X: 15, Y: 25}))
+	require.NoError(t, store.Move(ctx, "other-"+channelID, "user-c", domain.Position{X: 1, Y: 1}))
+
+	// Only each user's latest position in this channel
+	cursors, err = store.Cursors(ctx, channelID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]domain.Position{
+		"user-a": {X: 15, Y: 25},
+		"user-b": {X: 30, Y: 40},
+	}, cursors)
+
+	require.NoError(t, store.Remove(ctx, channelID, "user-a"))
+	require.NoError(t, store.Remove(ctx, channelID, "never-moved"))
+
+	cursors, err = store.Cursors(ctx, channelID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]domain.Position{"user-b": {X: 30, Y: 40}}, cursors)
+}
@@ -38,7 +38,13 @@ func setupTestDB(t *testing.T) *db.DB {
 }
 
 func cleanupUsers(t *testing.T, database *db.DB) {
-	_, err := database.Exec("DELETE FROM room_user_settings")
+	_, err := database.Exec("DELETE FROM messages")
+	require.NoError(t, err)
+	_, err = database.Exec("DELETE FROM room_user_settings")
+	require.NoError(t, err)
+	_, err = database.Exec("DELETE FROM room_invites")
+	require.NoError(t, err)
+	_, err = database.Exec("DELETE FROM room_members")
 	require.NoError(t, err)
 	_, err = database.Exec("DELETE FROM rooms")
 	require.NoError(t, err)
@@ -271,6 +277,11 @@ func TestRoomRepository_Create(t *testing.T) {
 		assert.NotNil(t, room.OwnerID)
 		assert.Equal(t, user.ID, *room.OwnerID)
 		assert.True(t, room.IsPublic)
+
+		member, err := repository.NewRoomMemberRepository(database.DB).Get(ctx, room.ID, user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, member, "Owner should be a member")
+		assert.Equal(t, domain.RoomRoleOwner, member.Role)
 	})
 
 	t.Run("duplicate slug should fail", func(t *testing.T) {
@@ -288,7 +299,214 @@ func TestRoomRepository_Create(t *testing.T) {
 			IsPublic: true,
 		}
 		_, err = roomRepo.Create(ctx, params2)
-		assert.Error(t, err, "Duplicate slug should fail")
+		assert.ErrorIs(t, err, domain.ErrRoomSlugTaken, "Duplicate slug should fail")
+	})
+
+	t.Run("rooms are listed by id", func(t *testing.T) {
+		room, err := roomRepo.Create(ctx, domain.CreateRoomParams{
+			Name:     "Listed Room",
+			Slug:     "listed-room",
+			IsPublic: true,
+		})
+		require.NoError(t, err)
+
+		rooms, err := roomRepo.ListByIDs(ctx, []uuid.UUID{room.ID, uuid.New()})
+		require.NoError(t, err)
+		require.Len(t, rooms, 1, "IDs without a room should be skipped")
+		assert.Equal(t, "listed-room", rooms[0].Slug)
+	})
+}
+
+func TestRoomInviteRepository_Redeem(t *testing.T) {
+	database := setupTestDB(t)
+	cleanupUsers(t, database)
+
+	roomRepo := repository.NewRoomRepository(database.DB)
+	userRepo := repository.NewUserRepository(database.DB)
+	memberRepo := repository.NewRoomMemberRepository(database.DB)
+	inviteRepo := repository.NewRoomInviteRepository(database.DB)
+	ctx := context.Background()
+
+	owner, err := userRepo.Create(ctx, domain.CreateUserParams{Email: "owner@example.com", Username: "owner"})
+	require.NoError(t, err)
+	room, err := roomRepo.Create(ctx, domain.CreateRoomParams{Name: "Secret", Slug: "secret", OwnerID: &owner.ID})
+	require.NoError(t, err)
+
+	newUser := func(name string) *domain.User {
+		user, err := userRepo.Create(ctx, domain.CreateUserParams{Email: name + "@example.com", Username: name})
+		require.NoError(t, err)
+		return user
+	}
+	maxUses := 2
+	invite, err := inviteRepo.Create(ctx, domain.CreateRoomInviteParams{
+		RoomID:    room.ID,
+		CreatedBy: owner.ID,
+		Role:      domain.RoomRoleMember,
+		MaxUses:   &maxUses,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	t.Run("redeeming makes a member", func(t *testing.T) {
+		alice := newUser("alice")
+		member, err := inviteRepo.Redeem(ctx, invite.ID, room.ID, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.RoomRoleMember, member.Role)
+
+		got, err := memberRepo.Get(ctx, room.ID, alice.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+
+		// Redeeming again doesn't use the invite up
+		_, err = inviteRepo.Redeem(ctx, invite.ID, room.ID, alice.ID)
+		require.NoError(t, err)
+		invites, err := inviteRepo.ListActive(ctx, room.ID)
+		require.NoError(t, err)
+		require.Len(t, invites, 1)
+		assert.Equal(t, 1, invites[0].Uses)
+	})
+
+	t.Run("used up invite fails", func(t *testing.T) {
+		_, err := inviteRepo.Redeem(ctx, invite.ID, room.ID, newUser("bob").ID)
+		require.NoError(t, err)
+
+		_, err = inviteRepo.Redeem(ctx, invite.ID, room.ID, newUser("carol").ID)
+		assert.ErrorIs(t, err, domain.ErrInviteUnavailable)
+	})
+
+	t.Run("revoked invite fails", func(t *testing.T) {
+		other, err := inviteRepo.Create(ctx, domain.CreateRoomInviteParams{
+			RoomID:    room.ID,
+			CreatedBy: owner.ID,
+			Role:      domain.RoomRoleAdmin,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+
+		revoked, err := inviteRepo.Revoke(ctx, room.ID, other.ID)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		_, err = inviteRepo.Redeem(ctx, other.ID, room.ID, newUser("dave").ID)
+		assert.ErrorIs(t, err, domain.ErrInviteUnavailable)
+	})
+
+	t.Run("expired invite fails", func(t *testing.T) {
+		expired, err := inviteRepo.Create(ctx, domain.CreateRoomInviteParams{
+			RoomID:    room.ID,
+			CreatedBy: owner.ID,
+			Role:      domain.RoomRoleMember,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		require.NoError(t, err)
+
+		_, err = inviteRepo.Redeem(ctx, expired.ID, room.ID, newUser("erin").ID)
+		assert.ErrorIs(t, err, domain.ErrInviteUnavailable)
+	})
+
+	t.Run("members are listed", func(t *testing.T) {
+		members, err := memberRepo.ListByRoom(ctx, room.ID)
+		require.NoError(t, err)
+
+		var usernames []string
+		for _, member := range members {
+			user, err := userRepo.GetByID(ctx, member.UserID)
+			require.NoError(t, err)
+			usernames = append(usernames, user.Username)
+		}
+		assert.Equal(t, []string{"owner", "alice", "bob"}, usernames)
+	})
+}
+
+func TestMessageRepository_SaveAndList(t *testing.T) {
+	database := setupTestDB(t)
+	cleanupUsers(t, database)
+
+	roomRepo := repository.NewRoomRepository(database.DB)
+	messageRepo := repository.NewMessageRepository(database.DB)
+	ctx := context.Background()
+
+	room, err := roomRepo.Create(ctx, domain.CreateRoomParams{
+		Name:     "History Room",
+		Slug:     "history-room",
+		IsPublic: true,
+	})
+	require.NoError(t, err)
+
+	// Five messages along a diagonal: (0,0), (100,100), ... (400,400)
+	for i := 0; i < 5; i++ {
+		err := messageRepo.Save(ctx, &domain.ChatMessage{
+			ID:       uuid.New().String(),
+			RoomID:   room.ID,
+			UserID:   "guest:author",
+			Username: stringPtr("Author"),
+			Payload:  "message",
+			Position: domain.Position{X: float64(i * 100), Y: float64(i * 100)},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("pages newest first with a cursor", func(t *testing.T) {
+		page1, err := messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 3})
+		require.NoError(t, err)
+		require.Len(t, page1, 3)
+		assert.Greater(t, page1[0].Seq, page1[1].Seq)
+
+		before := page1[2].Seq
+		page2, err := messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 3, Before: &before})
+		require.NoError(t, err)
+		require.Len(t, page2, 2)
+		assert.Less(t, page2[0].Seq, before)
+	})
+
+	t.Run("filters by bounding box", func(t *testing.T) {
+		bounds := &domain.BoundingBox{MinX: 50, MinY: 50, MaxX: 250, MaxY: 250}
+		messages, err := messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 10, Bounds: bounds})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		for _, msg := range messages {
+			assert.True(t, bounds.Contains(msg.Position))
+		}
+	})
+
+	t.Run("re-saving updates the message", func(t *testing.T) {
+		msg := &domain.ChatMessage{
+			ID:       uuid.New().String(),
+			RoomID:   room.ID,
+			UserID:   "guest:author",
+			Payload:  "draft",
+			Position: domain.Position{X: 1, Y: 1},
+		}
+		require.NoError(t, messageRepo.Save(ctx, msg))
+		seq := msg.Seq
+
+		msg.Payload = "final"
+		require.NoError(t, messageRepo.Save(ctx, msg))
+		assert.Equal(t, seq, msg.Seq, "Seq should not change on update")
+
+		messages, err := messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "final", messages[0].Payload)
+	})
+
+	t.Run("another author reusing an ID saves a separate message", func(t *testing.T) {
+		messages, err := messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		original := messages[0]
+
+		reused := *original
+		reused.UserID = "guest:someone-else"
+		reused.Payload = "reused"
+		require.NoError(t, messageRepo.Save(ctx, &reused))
+		assert.NotEqual(t, original.Seq, reused.Seq)
+
+		messages, err = messageRepo.ListByRoom(ctx, domain.ListMessagesParams{RoomID: room.ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, "reused", messages[0].Payload)
+		assert.Equal(t, "final", messages[1].Payload, "The original author's message should be untouched")
 	})
 }
 
@@ -0,0 +1,204 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/presence"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Compares the original presence layout (a set of user IDs plus a key per member, read
+// with SMEMBERS and one GET per member) with presence.RedisStore's hash and sorted sets
+// read in one Lua script. Run with: go test ./tests/integration -run '^$' -bench Presence
+
+var presenceBenchSizes = []int{10, 1000, 10000}
+
+// legacyUserData is the value the original layout stored per member
+type legacyUserData struct {
+	Username string `json:"username,omitempty"`
+	Color    string `json:"color,omitempty"`
+}
+
+// legacyAdd stores a member the way the original layout did
+func legacyAdd(ctx context.Context, client *redis.Client, channelID, userID, username, color string) error {
+	data, err := json.Marshal(legacyUserData{Username: username, Color: color})
+	if err != nil {
+		return err
+	}
+	if err := client.SAdd(ctx, fmt.Sprintf("chat:channel:%s:users", channelID), userID).Err(); err != nil {
+		return err
+	}
+	return client.SetEx(ctx, fmt.Sprintf("chat:user:%s:%s", channelID, userID), data, 5*time.Minute).Err()
+}
+
+// legacyList reads a channel's members the way the original layout did
+func legacyList(ctx context.Context, client *redis.Client, channelID string) ([]domain.UserInfo, error) {
+	key := fmt.Sprintf("chat:channel:%s:users", channelID)
+	userIDs, err := client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []domain.UserInfo
+	for _, userID := range userIDs {
+		value, err := client.Get(ctx, fmt.Sprintf("chat:user:%s:%s", channelID, userID)).Result()
+		if err != nil {
+			client.SRem(ctx, key, userID)
+			continue
+		}
+
+		var data legacyUserData
+		if err := json.Unmarshal([]byte(value), &data); err != nil {
+			continue
+		}
+		users = append(users, domain.UserInfo{UserID: userID, Username: &data.Username, Color: &data.Color})
+	}
+	return users, nil
+}
+
+// legacyCleanup deletes a channel stored in the original layout
+func legacyCleanup(ctx context.Context, client *redis.Client, channelID string) {
+	key := fmt.Sprintf("chat:channel:%s:users", channelID)
+	userIDs, _ := client.SMembers(ctx, key).Result()
+	for _, userID := range userIDs {
+		client.Del(ctx, fmt.Sprintf("chat:user:%s:%s", channelID, userID))
+	}
+	client.Del(ctx, key)
+}
+
+// newBenchRedisClient connects to Redis, skipping the benchmark if it is not available
+func newBenchRedisClient(b *testing.B) *redis.Client {
+	b.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: testRedisAddr()})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		b.Skipf("Redis not available: %v", err)
+	}
+	b.Cleanup(func() { client.Close() })
+	return client
+}
+
+// fillPresence joins members sessions to a channel in the store
+func fillPresence(b *testing.B, store *presence.RedisStore, channelID string, members int) []domain.PresenceSession {
+	b.Helper()
+
+	ctx := context.Background()
+	username, color := "Alice", "#ef4444"
+	sessions := make([]domain.PresenceSession, members)
+	for i := range sessions {
+		now := time.Now().UnixMilli()
+		sessions[i] = domain.PresenceSession{
+			SessionID:    uuid.NewString(),
+			UserID:       fmt.Sprintf("user-%d", i),
+			Username:     &username,
+			Color:        &color,
+			ConnectedAt:  now,
+			LastActiveAt: now,
+		}
+		if _, err := store.Join(ctx, channelID, sessions[i]); err != nil {
+			b.Fatalf("Failed to join: %v", err)
+		}
+	}
+	return sessions
+}
+
+func BenchmarkPresenceList(b *testing.B) {
+	client := newBenchRedisClient(b)
+	store := presence.NewRedisStore(client, testLogger())
+	ctx := context.Background()
+
+	for _, members := range presenceBenchSizes {
+		b.Run(fmt.Sprintf("legacy/%d", members), func(b *testing.B) {
+			channelID := uuid.NewString()
+			defer legacyCleanup(ctx, client, channelID)
+			for i := 0; i < members; i++ {
+				if err := legacyAdd(ctx, client, channelID, fmt.Sprintf("user-%d", i), "Alice", "#ef4444"); err != nil {
+					b.Fatalf("Failed to add member: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if users, err := legacyList(ctx, client, channelID); err != nil || len(users) != members {
+					b.Fatalf("Expected %d users, got %d (%v)", members, len(users), err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("hash/%d", members), func(b *testing.B) {
+			channelID := uuid.NewString()
+			sessions := fillPresence(b, store, channelID, members)
+			defer func() {
+				for _, s := range sessions {
+					store.Leave(ctx, channelID, s.UserID, s.SessionID)
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if users, err := store.ListUsers(ctx, channelID); err != nil || len(users) != members {
+					b.Fatalf("Expected %d users, got %d (%v)", members, len(users), err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPresenceJoin(b *testing.B) {
+	client := newBenchRedisClient(b)
+	store := presence.NewRedisStore(client, testLogger())
+	ctx := context.Background()
+
+	// A join writes the member and then reads the room for the joiner's user_sync
+	for _, members := range presenceBenchSizes {
+		b.Run(fmt.Sprintf("legacy/%d", members), func(b *testing.B) {
+			channelID := uuid.NewString()
+			defer legacyCleanup(ctx, client, channelID)
+			for i := 0; i < members; i++ {
+				if err := legacyAdd(ctx, client, channelID, fmt.Sprintf("user-%d", i), "Alice", "#ef4444"); err != nil {
+					b.Fatalf("Failed to add member: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := legacyAdd(ctx, client, channelID, "joiner", "Bob", "#10b981"); err != nil {
+					b.Fatalf("Failed to add member: %v", err)
+				}
+				if _, err := legacyList(ctx, client, channelID); err != nil {
+					b.Fatalf("Failed to list: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("hash/%d", members), func(b *testing.B) {
+			channelID := uuid.NewString()
+			sessions := fillPresence(b, store, channelID, members)
+			defer func() {
+				for _, s := range sessions {
+					store.Leave(ctx, channelID, s.UserID, s.SessionID)
+				}
+			}()
+
+			joiner := domain.PresenceSession{SessionID: uuid.NewString(), UserID: "joiner"}
+			defer store.Leave(ctx, channelID, joiner.UserID, joiner.SessionID)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.Join(ctx, channelID, joiner); err != nil {
+					b.Fatalf("Failed to join: %v", err)
+				}
+				if _, err := store.ListUsers(ctx, channelID); err != nil {
+					b.Fatalf("Failed to list: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/presence"
+	"asocial/internal/pubsub"
+	"asocial/internal/service"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every PresenceStore to keep them interchangeable
+
+func TestPresenceStore_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	runPresenceStoreSuite(t, presence.NewRedisStore(redisPubSub.Client(), testLogger()))
+}
+
+func TestPresenceStore_Memory(t *testing.T) {
+	runPresenceStoreSuite(t, presence.NewMemoryStore(nil))
+}
+
+func TestPresenceStore_NATS(t *testing.T) {
+	natsPubSub := newTestNATSPubSub(t)
+
+	store, err := presence.NewNATSStore(natsPubSub.Conn(), testLogger())
+	require.NoError(t, err)
+
+	runPresenceStoreSuite(t, store)
+}
+
+// runPresenceStoreSuite checks the presence behavior every store must share
+func runPresenceStoreSuite(t *testing.T, store service.PresenceStore) {
+	session := func(userID string, username, color *string) domain.PresenceSession {
+		now := time.Now().UnixMilli()
+		return domain.PresenceSession{
+			SessionID:    uuid.NewString(),
+			UserID:       userID,
+			Username:     username,
+			Color:        color,
+			ConnectedAt:  now,
+			LastActiveAt: now,
+		}
+	}
+
+	t.Run("Users", func(t *testing.T) {
+		ctx := context.Background()
+		room := uuid.NewString()
+		alice, bob := "Alice", "Bob"
+		red, green := "#ef4444", "#10b981"
+
+		aliceTab := session("guest:alice", &alice, &red)
+		bobTab := session("user-bob", &bob, &green)
+		_, err := store.Join(ctx, room, aliceTab)
+		require.NoError(t, err)
+		_, err = store.Join(ctx, room, bobTab)
+		require.NoError(t, err)
+		defer store.Leave(ctx, room, "guest:alice", aliceTab.SessionID)
+		defer store.Leave(ctx, room, "user-bob", bobTab.SessionID)
+
+		users, err := store.ListUsers(ctx, room)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		byID := make(map[string]domain.UserInfo)
+		for _, u := range users {
+			byID[u.UserID] = u
+		}
+		assertStringPtr(t, byID["guest:alice"].Username, "Alice", "username")
+		assertStringPtr(t, byID["guest:alice"].Color, "#ef4444", "color")
+		assertStringPtr(t, byID["user-bob"].Username, "Bob", "username")
+		assert.Equal(t, domain.PresenceActive, byID["user-bob"].Status)
+
+		// Updating changes the stored details
+		renamed := "Bobby"
+		require.NoError(t, store.UpdateUser(ctx, room, "user-bob", &renamed, &green))
+		require.NoError(t, store.Touch(ctx, room, bobTab.SessionID, true))
+
+		remaining, err := store.Leave(ctx, room, "guest:alice", aliceTab.SessionID)
+		require.NoError(t, err)
+		assert.Zero(t, remaining)
+
+		users, err = store.ListUsers(ctx, room)
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, "user-bob", users[0].UserID)
+		assertStringPtr(t, users[0].Username, "Bobby", "username")
+		assertStringPtr(t, users[0].Color, "#10b981", "color")
+
+		// Other channels are unaffected
+		users, err = store.ListUsers(ctx, uuid.NewString())
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		ctx := context.Background()
+		room := uuid.NewString()
+		alice := "Alice"
+
+		tab1, tab2 := session("guest:alice", &alice, nil), session("guest:alice", &alice, nil)
+		joined, err := store.Join(ctx, room, tab1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, joined)
+		joined, err = store.Join(ctx, room, tab2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, joined)
+
+		users, err := store.ListUsers(ctx, room)
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, 2, users[0].Sessions)
+
+		remaining, err := store.Leave(ctx, room, "guest:alice", tab1.SessionID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, remaining)
+		remaining, err = store.Leave(ctx, room, "guest:alice", tab2.SessionID)
+		require.NoError(t, err)
+		assert.Zero(t, remaining)
+	})
+}
@@ -0,0 +1,132 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/pubsub"
+	"asocial/internal/service"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every PubSubClient backend to keep them interchangeable
+
+func TestPubSubClient_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	runPubSubClientSuite(t, redisPubSub)
+}
+
+func TestPubSubClient_RedisStreams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisStreams, err := pubsub.NewRedisStreams(testRedisAddr(), "", "test:suite:stream:", 0, 1000, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisStreams.Close()
+
+	runPubSubClientSuite(t, redisStreams)
+}
+
+func TestPubSubClient_Memory(t *testing.T) {
+	runPubSubClientSuite(t, pubsub.NewMemoryPubSub(testLogger()))
+}
+
+func TestPubSubClient_NATS(t *testing.T) {
+	runPubSubClientSuite(t, newTestNATSPubSub(t))
+}
+
+// runPubSubClientSuite checks delivery behavior every backend must share
+func runPubSubClientSuite(t *testing.T, client service.PubSubClient) {
+	t.Run("HealthCheck", func(t *testing.T) {
+		assert.NoError(t, client.HealthCheck(context.Background()))
+	})
+
+	t.Run("DeliversJoinedRoomsOnly", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		received := make(chan *domain.Message, 10)
+		go client.Subscribe(ctx, func(msg *domain.Message) error {
+			received <- msg
+			return nil
+		})
+
+		room, otherRoom := uuid.NewString(), uuid.NewString()
+		require.NoError(t, client.JoinChannel(ctx, room))
+		defer client.LeaveChannel(ctx, room)
+
+		require.NoError(t, client.Publish(ctx, domain.NewMessage("other", otherRoom, "user-1", "other", domain.Position{})))
+		require.NoError(t, client.Publish(ctx, domain.NewMessage("mine", room, "user-1", "mine", domain.Position{X: 1, Y: 2})))
+
+		select {
+		case msg := <-received:
+			require.NotNil(t, msg.MessageID)
+			assert.Equal(t, "mine", *msg.MessageID)
+			assert.Equal(t, room, msg.ChannelID)
+			assert.Equal(t, &domain.Position{X: 1, Y: 2}, msg.Position)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for message")
+		}
+
+		select {
+		case msg := <-received:
+			t.Errorf("Expected no more messages, got %v", *msg.MessageID)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+// testRedisAddr returns the Redis address used by integration tests
+func testRedisAddr() string {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return "localhost:6379"
+}
+
+// newTestNATSPubSub connects a NATS backend to a fresh in-process server with JetStream
+func newTestNATSPubSub(t *testing.T) *pubsub.NATSPubSub {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	server := natstest.RunServer(&opts)
+	t.Cleanup(server.Shutdown)
+
+	natsPubSub, err := pubsub.NewNATSPubSub(server.ClientURL(), "test.suite.", testLogger())
+	require.NoError(t, err)
+	t.Cleanup(func() { natsPubSub.Close() })
+	return natsPubSub
+}
+
+// testLogger returns a logger that only shows errors
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
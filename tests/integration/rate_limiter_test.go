@@ -0,0 +1,159 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/middleware"
+	"asocial/internal/pubsub"
+	"asocial/internal/ratelimit"
+	"asocial/internal/service"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every rate limiter to keep them interchangeable
+
+func TestRateLimiter_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	now := time.Now()
+	runRateLimiterSuite(t, ratelimit.NewRedisLimiter(redisPubSub.Client(), func() time.Time { return now }), &now)
+}
+
+func TestRateLimiter_Memory(t *testing.T) {
+	now := time.Now()
+	runRateLimiterSuite(t, ratelimit.NewMemoryLimiter(func() time.Time { return now }), &now)
+}
+
+// runRateLimiterSuite checks the behavior every rate limiter must share
+// now is the limiter's clock, moved forward to refill buckets.
+func runRateLimiterSuite(t *testing.T, limiter service.RateLimiter, now *time.Time) {
+	ctx := context.Background()
+	prefix := "test:" + uuid.NewString()
+	session := domain.TokenBucket{Key: prefix + ":session", Limit: domain.RateLimit{Rate: 2, Burst: 3}}
+	user := domain.TokenBucket{Key: prefix + ":user", Limit: domain.RateLimit{Rate: 1, Burst: 4}}
+
+	take := func(buckets ...domain.TokenBucket) (bool, time.Duration) {
+		t.Helper()
+		allowed, retryAfter, err := limiter.Take(ctx, buckets)
+		require.NoError(t, err)
+		return allowed, retryAfter
+	}
+
+	// A full bucket allows its burst
+	for i := 0; i < 3; i++ {
+		allowed, _ := take(session, user)
+		require.True(t, allowed, "take %d", i+1)
+	}
+	allowed, retryAfter := take(session, user)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// A refused take draws from none of the buckets
+	allowed, _ = take(user)
+	assert.True(t, allowed, "user bucket should still hold its fourth token")
+
+	// The wait covers the emptiest bucket
+	*now = now.Add(500 * time.Millisecond)
+	allowed, retryAfter = take(session, user)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	*now = now.Add(500 * time.Millisecond)
+	allowed, _ = take(session, user)
+	assert.True(t, allowed)
+
+	// Buckets refill up to their burst, no further
+	*now = now.Add(time.Hour)
+	for i := 0; i < 4; i++ {
+		allowed, _ = take(user)
+		require.True(t, allowed, "take %d after refill", i+1)
+	}
+	allowed, _ = take(user)
+	assert.False(t, allowed)
+
+	// Unlimited buckets never refuse
+	unlimited := domain.TokenBucket{Key: prefix + ":unlimited"}
+	for i := 0; i < 100; i++ {
+		allowed, _ = take(unlimited)
+		require.True(t, allowed)
+	}
+}
+
+func TestWindowLimiter_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	now := time.Now()
+	runWindowLimiterSuite(t, ratelimit.NewRedisWindowLimiter(redisPubSub.Client(), func() time.Time { return now }), &now)
+}
+
+func TestWindowLimiter_Memory(t *testing.T) {
+	now := time.Now()
+	runWindowLimiterSuite(t, ratelimit.NewMemoryWindowLimiter(func() time.Time { return now }), &now)
+}
+
+// runWindowLimiterSuite checks the behavior every sliding window limiter must share
+// now is the limiter's clock, moved forward to slide the windows.
+func runWindowLimiterSuite(t *testing.T, limiter middleware.WindowLimiter, now *time.Time) {
+	ctx := context.Background()
+	prefix := "test:" + uuid.NewString()
+	ip := domain.SlidingWindow{Key: prefix + ":ip", Limit: domain.WindowLimit{Limit: 3, Window: time.Minute}}
+	user := domain.SlidingWindow{Key: prefix + ":user", Limit: domain.WindowLimit{Limit: 5, Window: 10 * time.Second}}
+
+	hit := func(windows ...domain.SlidingWindow) domain.WindowUsage {
+		t.Helper()
+		usage, err := limiter.Hit(ctx, windows)
+		require.NoError(t, err)
+		return usage
+	}
+
+	// The usage reports the window with the least room left
+	usage := hit(ip, user)
+	assert.Equal(t, domain.WindowUsage{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}, usage)
+
+	*now = now.Add(20 * time.Second)
+	hit(ip, user)
+	usage = hit(ip, user)
+	assert.True(t, usage.Allowed)
+	assert.Equal(t, 0, usage.Remaining)
+	assert.Equal(t, 40*time.Second, usage.Reset, "the oldest request leaves 60s after it was made")
+
+	// A full window refuses the request, and it is counted in none of them
+	usage = hit(ip, user)
+	assert.False(t, usage.Allowed)
+	assert.Equal(t, 40*time.Second, usage.Reset)
+
+	usage = hit(user)
+	assert.True(t, usage.Allowed)
+	assert.Equal(t, 2, usage.Remaining, "the two requests 20s ago have left the user's window")
+
+	// The window slides rather than resetting all at once
+	*now = now.Add(40 * time.Second)
+	usage = hit(ip)
+	assert.True(t, usage.Allowed)
+	assert.Equal(t, 0, usage.Remaining)
+	assert.False(t, hit(ip).Allowed)
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, 2, hit(ip).Remaining, "every request has left the window")
+}
@@ -53,8 +53,11 @@ func TestRedisPubSub(t *testing.T) {
 		}
 	}()
 
-	// Give subscriber time to connect
-	time.Sleep(100 * time.Millisecond)
+	// Join the room so this node receives its messages
+	if err := redisPubSub.JoinChannel(ctx, "test-channel"); err != nil {
+		t.Fatalf("Failed to join channel: %v", err)
+	}
+	defer redisPubSub.LeaveChannel(ctx, "test-channel")
 
 	// Publish a test message
 	testMsg := domain.NewMessage(
@@ -131,7 +134,10 @@ func TestRedisPubSubMultipleMessages(t *testing.T) {
 		}
 	}()
 
-	time.Sleep(100 * time.Millisecond)
+	if err := redisPubSub.JoinChannel(ctx, "test-channel"); err != nil {
+		t.Fatalf("Failed to join channel: %v", err)
+	}
+	defer redisPubSub.LeaveChannel(ctx, "test-channel")
 
 	// Publish multiple messages
 	for i := 0; i < messageCount; i++ {
@@ -163,7 +169,154 @@ func TestRedisPubSubMultipleMessages(t *testing.T) {
 	}
 }
 
+// TestRedisPubSub_RoomSubscriptions tests that a node only receives rooms it has joined,
+// and stays subscribed until the last local session leaves
+func TestRedisPubSub_RoomSubscriptions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	redisPubSub, err := pubsub.NewRedisPubSub(redisAddr, "", "test:rooms:", 0, logger)
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan *domain.Message, 10)
+	go redisPubSub.Subscribe(ctx, func(msg *domain.Message) error {
+		received <- msg
+		return nil
+	})
+
+	publish := func(room, id string) {
+		t.Helper()
+		msg := domain.NewMessage(id, room, "test-user", id, domain.Position{})
+		if err := redisPubSub.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish message: %v", err)
+		}
+	}
+	expect := func(id string) {
+		t.Helper()
+		select {
+		case msg := <-received:
+			if msg.MessageID == nil || *msg.MessageID != id {
+				t.Errorf("Expected message %s, got %v", id, msg.MessageID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for message %s", id)
+		}
+	}
+	expectNothing := func() {
+		t.Helper()
+		select {
+		case msg := <-received:
+			t.Errorf("Expected no message, got %s", *msg.MessageID)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	// Two local sessions join room-a
+	for range 2 {
+		if err := redisPubSub.JoinChannel(ctx, "room-a"); err != nil {
+			t.Fatalf("Failed to join channel: %v", err)
+		}
+	}
+
+	// Only joined rooms are delivered
+	publish("room-b", "b-1")
+	publish("room-a", "a-1")
+	expect("a-1")
+	expectNothing()
+
+	// The first session leaving keeps the subscription
+	if err := redisPubSub.LeaveChannel(ctx, "room-a"); err != nil {
+		t.Fatalf("Failed to leave channel: %v", err)
+	}
+	publish("room-a", "a-2")
+	expect("a-2")
+
+	// The last session leaving drops it
+	if err := redisPubSub.LeaveChannel(ctx, "room-a"); err != nil {
+		t.Fatalf("Failed to leave channel: %v", err)
+	}
+	// UNSUBSCRIBE is not acknowledged to the caller, so wait for Redis to drop it
+	deadline := time.Now().Add(time.Second)
+	for {
+		counts, err := redisPubSub.Client().PubSubNumSub(ctx, "test:rooms:room-a").Result()
+		if err != nil {
+			t.Fatalf("Failed to count subscribers: %v", err)
+		}
+		if counts["test:rooms:room-a"] == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for unsubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	publish("room-a", "a-3")
+	expectNothing()
+}
+
 // TestRedisHealthCheck tests the health check functionality
+func TestRedisPubSub_FailedJoinReleasesChannel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	redisPubSub, err := pubsub.NewRedisPubSub(redisAddr, "", "test:failed-join:", 0, logger)
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	// Without a Subscribe loop the confirmation is never read, so the join gives up
+	joinCtx, cancelJoin := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelJoin()
+	if err := redisPubSub.JoinChannel(joinCtx, "room-a"); err == nil {
+		t.Fatal("Expected join to fail without a confirmed subscription")
+	}
+
+	// Its hold is released, so nothing keeps the node subscribed
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		counts, err := redisPubSub.Client().PubSubNumSub(ctx, "test:failed-join:room-a").Result()
+		if err != nil {
+			t.Fatalf("Failed to count subscribers: %v", err)
+		}
+		if counts["test:failed-join:room-a"] == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the failed join to unsubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestRedisHealthCheck(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
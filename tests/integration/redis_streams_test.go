@@ -0,0 +1,156 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/pubsub"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedisStreams connects a streams backend, skipping without Redis
+func newTestRedisStreams(t *testing.T) *pubsub.RedisStreams {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	streams, err := pubsub.NewRedisStreams(redisAddr, "", "test:stream:", 0, 1000, logger)
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	t.Cleanup(func() { streams.Close() })
+	return streams
+}
+
+// subscribeStreams runs a subscriber until the returned cancel is called
+func subscribeStreams(streams *pubsub.RedisStreams) (<-chan *domain.Message, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *domain.Message, 10)
+	go streams.Subscribe(ctx, func(msg *domain.Message) error {
+		received <- msg
+		return nil
+	})
+	return received, cancel
+}
+
+// receiveMessage waits for the next delivered message
+func receiveMessage(t *testing.T, received <-chan *domain.Message) *domain.Message {
+	t.Helper()
+
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for message")
+		return nil
+	}
+}
+
+func TestRedisStreams_PublishAndReplay(t *testing.T) {
+	streams := newTestRedisStreams(t)
+	ctx := context.Background()
+	room := uuid.NewString()
+
+	received, cancel := subscribeStreams(streams)
+	defer cancel()
+
+	require.NoError(t, streams.JoinChannel(ctx, room))
+	defer streams.LeaveChannel(ctx, room)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, streams.Publish(ctx, domain.NewMessage(id, room, "user-1", id, domain.Position{})))
+	}
+
+	var streamIDs []string
+	for _, want := range []string{"a", "b", "c"} {
+		msg := receiveMessage(t, received)
+		require.NotNil(t, msg.MessageID)
+		assert.Equal(t, want, *msg.MessageID)
+		assert.NotEmpty(t, msg.StreamID)
+		streamIDs = append(streamIDs, msg.StreamID)
+	}
+
+	// Replay is exclusive of the given ID
+	replayed, err := streams.Replay(ctx, room, streamIDs[0], 10)
+	require.NoError(t, err)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, "b", *replayed[0].MessageID)
+	assert.Equal(t, streamIDs[1], replayed[0].StreamID)
+	assert.Equal(t, "c", *replayed[1].MessageID)
+
+	// And bounded by the limit
+	replayed, err = streams.Replay(ctx, room, streamIDs[0], 1)
+	require.NoError(t, err)
+	require.Len(t, replayed, 1)
+	assert.Equal(t, "b", *replayed[0].MessageID)
+}
+
+func TestRedisStreams_RestartSkipsOldEntries(t *testing.T) {
+	ctx := context.Background()
+	room := uuid.NewString()
+
+	// The node reads the room and processes one message
+	first := newTestRedisStreams(t)
+	received, cancel := subscribeStreams(first)
+	require.NoError(t, first.JoinChannel(ctx, room))
+	require.NoError(t, first.Publish(ctx, domain.NewMessage("before", room, "user-1", "before", domain.Position{})))
+	assert.Equal(t, "before", *receiveMessage(t, received).MessageID)
+
+	// The node goes away without leaving; another node keeps publishing
+	cancel()
+	first.Close()
+	other := newTestRedisStreams(t)
+	require.NoError(t, other.Publish(ctx, domain.NewMessage("during", room, "user-2", "during", domain.Position{})))
+
+	// Restarted, it has nobody who saw the old entries and starts from the end
+	restarted := newTestRedisStreams(t)
+	received, cancel = subscribeStreams(restarted)
+	defer cancel()
+	require.NoError(t, restarted.JoinChannel(ctx, room))
+	defer restarted.LeaveChannel(ctx, room)
+	require.NoError(t, other.Publish(ctx, domain.NewMessage("after", room, "user-2", "after", domain.Position{})))
+
+	assert.Equal(t, "after", *receiveMessage(t, received).MessageID)
+	select {
+	case msg := <-received:
+		t.Errorf("Expected no more messages, got %s", *msg.MessageID)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRedisStreams_LeaveForgetsPosition(t *testing.T) {
+	streams := newTestRedisStreams(t)
+	ctx := context.Background()
+	room := uuid.NewString()
+
+	received, cancel := subscribeStreams(streams)
+	defer cancel()
+
+	// The last session leaving drops the room, and nothing published meanwhile is replayed on rejoin
+	require.NoError(t, streams.JoinChannel(ctx, room))
+	require.NoError(t, streams.LeaveChannel(ctx, room))
+	require.NoError(t, streams.Publish(ctx, domain.NewMessage("missed", room, "user-1", "missed", domain.Position{})))
+
+	require.NoError(t, streams.JoinChannel(ctx, room))
+	defer streams.LeaveChannel(ctx, room)
+	require.NoError(t, streams.Publish(ctx, domain.NewMessage("live", room, "user-1", "live", domain.Position{})))
+
+	assert.Equal(t, "live", *receiveMessage(t, received).MessageID)
+}
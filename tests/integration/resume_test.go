@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/pubsub"
+	"asocial/internal/resume"
+	"asocial/internal/service"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every resume store and message buffer to keep them interchangeable
+
+func TestResume_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	client := redisPubSub.Client()
+	runResumeSuite(t, resume.NewRedisStore(client, testLogger()), resume.NewRedisBuffer(client, 3, time.Minute, testLogger()))
+}
+
+func TestResume_Memory(t *testing.T) {
+	runResumeSuite(t, resume.NewMemoryStore(nil), resume.NewMemoryBuffer(3))
+}
+
+// runResumeSuite checks the behavior every resume store and message buffer (of size 3) must share
+func runResumeSuite(t *testing.T, store service.ResumeStore, buffer service.MessageBuffer) {
+	ctx := context.Background()
+
+	t.Run("Store", func(t *testing.T) {
+		token, err := service.NewResumeToken()
+		require.NoError(t, err)
+
+		state := domain.ResumeState{SessionID: uuid.NewString(), UserID: "user-a", ChannelID: "room", Position: 7}
+		require.NoError(t, store.Park(ctx, token, state, time.Minute))
+
+		claimed, err := store.Claim(ctx, token)
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		assert.Equal(t, state, *claimed)
+
+		// Claiming is one-shot, so only one node can resume a session
+		claimed, err = store.Claim(ctx, token)
+		require.NoError(t, err)
+		assert.Nil(t, claimed)
+
+		unknown, err := store.Claim(ctx, "no-such-token")
+		require.NoError(t, err)
+		assert.Nil(t, unknown)
+	})
+
+	t.Run("Buffer", func(t *testing.T) {
+		channelID := uuid.NewString()
+		appendMessages := func(from, to int) {
+			for i := from; i <= to; i++ {
+				msg := domain.NewMessage(fmt.Sprintf("msg-%d", i), channelID, "user-a", "hi", domain.Position{})
+				msg.Seq = int64(i)
+				require.NoError(t, buffer.Append(ctx, msg))
+			}
+		}
+
+		msgs, complete, err := buffer.Since(ctx, channelID, 0)
+		require.NoError(t, err)
+		assert.True(t, complete)
+		assert.Empty(t, msgs)
+
+		appendMessages(1, 4)
+		msgs, complete, err = buffer.Since(ctx, channelID, 2)
+		require.NoError(t, err)
+		assert.True(t, complete)
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "msg-3", *msgs[0].MessageID)
+		assert.Equal(t, "msg-4", *msgs[1].MessageID)
+
+		// msg-1 has been dropped to make room
+		msgs, complete, err = buffer.Since(ctx, channelID, 0)
+		require.NoError(t, err)
+		assert.False(t, complete)
+		assert.Len(t, msgs, 3)
+	})
+}
@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"asocial/internal/domain"
+	"asocial/internal/handler"
+	"asocial/internal/repository"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCloser is a RoomSessionCloser that records who may stay in restricted rooms
+type recordingCloser struct {
+	mu         sync.Mutex
+	restricted map[string][]string
+}
+
+func (r *recordingCloser) CloseRoom(ctx context.Context, channelID string) error {
+	return nil
+}
+
+func (r *recordingCloser) RestrictRoom(ctx context.Context, channelID string, memberIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restricted[channelID] = memberIDs
+	return nil
+}
+
+// TestRoomHandler_MadePrivate tests that making a room private removes it for non-members
+func TestRoomHandler_MadePrivate(t *testing.T) {
+	database := setupTestDB(t)
+	cleanupUsers(t, database)
+
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	userRepo := repository.NewUserRepository(database.DB)
+	roomRepo := repository.NewRoomRepository(database.DB)
+	settingsRepo := repository.NewRoomUserSettingsRepository(database.DB)
+	memberRepo := repository.NewRoomMemberRepository(database.DB)
+	closer := &recordingCloser{restricted: make(map[string][]string)}
+	roomHandler := handler.NewRoomHandler(
+		roomRepo,
+		settingsRepo,
+		userRepo,
+		memberRepo,
+		repository.NewRoomInviteRepository(database.DB),
+		nil,
+		closer,
+		logger,
+	)
+
+	newUser := func(username string) *domain.User {
+		user, err := userRepo.Create(ctx, domain.CreateUserParams{Email: username + "@example.com", Username: username})
+		require.NoError(t, err)
+		return user
+	}
+	owner, visitor := newUser("owner"), newUser("visitor")
+
+	room, err := roomRepo.Create(ctx, domain.CreateRoomParams{
+		Name:     "Soon Private",
+		Slug:     "soon-private",
+		OwnerID:  &owner.ID,
+		IsPublic: true,
+	})
+	require.NoError(t, err)
+
+	// The visitor joins while the room is public, so they have settings but no membership
+	_, err = settingsRepo.Upsert(ctx, room.ID, visitor.ID, "Visitor", "#112233")
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID, err := uuid.Parse(c.GetHeader("X-Test-User")); err == nil {
+			c.Set("user_id", userID)
+		}
+		c.Next()
+	})
+	router.GET("/rooms/mine", roomHandler.HandleListMyRooms)
+	router.PATCH("/rooms/:slug", roomHandler.HandleUpdateRoom)
+
+	do := func(method, path string, user *domain.User, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", user.ID.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	listedSlugs := func(user *domain.User) []string {
+		w := do(http.MethodGet, "/rooms/mine", user, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Rooms []struct {
+				Slug string `json:"slug"`
+			} `json:"rooms"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		slugs := []string{}
+		for _, r := range resp.Rooms {
+			slugs = append(slugs, r.Slug)
+		}
+		return slugs
+	}
+
+	assert.Equal(t, []string{"soon-private"}, listedSlugs(visitor), "A public room the visitor joined should be listed")
+
+	w := do(http.MethodPatch, "/rooms/soon-private", owner, `{"is_public": false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	closer.mu.Lock()
+	assert.Contains(t, closer.restricted[room.ID.String()], owner.ID.String())
+	assert.NotContains(t, closer.restricted[room.ID.String()], visitor.ID.String(), "The visitor should be disconnected")
+	closer.mu.Unlock()
+
+	assert.Empty(t, listedSlugs(visitor), "A private room the visitor isn't a member of should not be listed")
+	assert.Equal(t, []string{"soon-private"}, listedSlugs(owner))
+}
@@ -0,0 +1,90 @@
+package integration
+
+import (
+	"asocial/internal/pubsub"
+	"asocial/internal/sequence"
+	"asocial/internal/service"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The same suite runs against every sequencer to keep them interchangeable
+
+func TestSequencer_Redis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:suite:", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	defer redisPubSub.Close()
+
+	runSequencerSuite(t, sequence.NewRedisSequencer(redisPubSub.Client()))
+}
+
+func TestSequencer_Memory(t *testing.T) {
+	runSequencerSuite(t, sequence.NewMemorySequencer())
+}
+
+func TestSequencer_NATS(t *testing.T) {
+	natsPubSub := newTestNATSPubSub(t)
+
+	sequencer, err := sequence.NewNATSSequencer(natsPubSub.Conn())
+	require.NoError(t, err)
+
+	runSequencerSuite(t, sequencer)
+}
+
+// runSequencerSuite checks the behavior every sequencer must share
+func runSequencerSuite(t *testing.T, sequencer service.Sequencer) {
+	ctx := context.Background()
+	channelID := "seq-" + uuid.NewString()
+
+	current, err := sequencer.Current(ctx, channelID)
+	require.NoError(t, err)
+	assert.Zero(t, current)
+
+	// Concurrent publishers never share a number and leave no holes
+	const publishers, perPublisher = 8, 10
+	var (
+		mu   sync.Mutex
+		seqs []int64
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perPublisher; j++ {
+				seq, err := sequencer.Next(ctx, channelID)
+				assert.NoError(t, err)
+				mu.Lock()
+				seqs = append(seqs, seq)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for i, seq := range seqs {
+		require.Equal(t, int64(i+1), seq)
+	}
+
+	current, err = sequencer.Current(ctx, channelID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(publishers*perPublisher), current)
+
+	// Each channel has its own sequence
+	seq, err := sequencer.Next(ctx, "other-"+channelID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq)
+}
@@ -1,68 +1,75 @@
 package integration
 
 import (
+	"asocial/internal/auth"
 	"asocial/internal/domain"
 	"asocial/internal/handler"
+	"asocial/internal/presence"
 	"asocial/internal/pubsub"
 	"asocial/internal/service"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
 	"net/http/httptest"
 	"net/url"
-	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/olahol/melody"
 )
 
-// TestUserSync_TwoUsers tests the full E2E flow of two users connecting and syncing
-func TestUserSync_TwoUsers(t *testing.T) {
+func TestUserSync_Redis(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping E2E test in short mode")
 	}
 
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
+	redisPubSub, err := pubsub.NewRedisPubSub(testRedisAddr(), "", "test:e2e", 0, testLogger())
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
 	}
+	defer redisPubSub.Close()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelError,
-	}))
+	runUserSyncTwoUsers(t, redisPubSub, presence.NewRedisStore(redisPubSub.Client(), testLogger()))
+}
 
-	// Setup Redis PubSub
-	redisPubSub, err := pubsub.NewRedisPubSub(redisAddr, "", "test:e2e", 0, logger)
+func TestUserSync_NATS(t *testing.T) {
+	natsPubSub := newTestNATSPubSub(t)
+	presenceStore, err := presence.NewNATSStore(natsPubSub.Conn(), testLogger())
 	if err != nil {
-		t.Skipf("Redis not available: %v", err)
+		t.Fatalf("Failed to create presence store: %v", err)
 	}
-	defer redisPubSub.Close()
+
+	runUserSyncTwoUsers(t, natsPubSub, presenceStore)
+}
+
+// runUserSyncTwoUsers tests the full E2E flow of two users connecting and syncing
+func runUserSyncTwoUsers(t *testing.T, pubSubClient service.PubSubClient, presenceStore service.PresenceStore) {
+	logger := testLogger()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Note: The websocket handler hardcodes channel to "default"
-	channelID := "default"
-
-	// Clean up before and after test - also clean up any stale users
-	cleanup := func() {
-		users, _ := redisPubSub.GetChannelUsers(ctx, channelID)
-		for _, user := range users {
-			redisPubSub.RemoveUserFromChannel(ctx, channelID, user.UserID)
-		}
+	// The websocket handler resolves the room and uses its ID as the channel
+	room := &domain.Room{
+		ID:       uuid.New(),
+		Name:     "General",
+		Slug:     "general",
+		IsPublic: true,
 	}
-	cleanup()
-	defer cleanup()
+	channelID := room.ID.String()
 
 	// Setup server
 	m := melody.New()
-	msgService := service.NewMessageService(redisPubSub, m, logger)
-	wsHandler := handler.NewWebSocketHandler(m, msgService, logger)
+	msgService := service.NewMessageService(pubSubClient, nil, nil, nil, nil, nil, service.NewOutbound(m, 256, 5*time.Second, 400, logger), logger)
+	guestTokens, err := auth.NewGuestTokenService([]byte(strings.Repeat("k", 32)), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create guest token service: %v", err)
+	}
+	wsHandler := handler.NewWebSocketHandler(m, msgService, presenceStore, nil, nil, staticRooms{room}, nil, nil, nil, guestTokens, logger)
 
 	// Start subscriber in background
 	go msgService.StartSubscriber(ctx)
@@ -78,11 +85,12 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	// Convert http to ws URL
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	// Connect first user
+	// Connect first user (anonymous, so identities live in the guest space)
 	username1 := "Alice"
 	color1 := "#ef4444"
-	ws1URL := fmt.Sprintf("%s/ws?uid=user1&username=%s&color=%s",
+	ws1URL := fmt.Sprintf("%s/ws?uid=user1&guest_token=%s&username=%s&color=%s",
 		wsURL,
+		issueGuestToken(t, guestTokens, "user1"),
 		url.QueryEscape(username1),
 		url.QueryEscape(color1),
 	)
@@ -100,26 +108,36 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	if len(msg1.Users) != 1 {
 		t.Errorf("Expected 1 user in sync, got %d", len(msg1.Users))
 	}
-	if msg1.Users[0].UserID != "user1" {
+	if msg1.Users[0].UserID != "guest:user1" {
 		t.Errorf("Expected user1 in sync, got %s", msg1.Users[0].UserID)
 	}
 	assertStringPtr(t, msg1.Users[0].Username, "Alice", "username in sync")
 	assertStringPtr(t, msg1.Users[0].Color, "#ef4444", "color in sync")
 
+	// Then a canvas_sync, empty since nothing has been written yet
+	canvas1 := readMessage(t, ws1, 2*time.Second)
+	if canvas1.Type != domain.MessageTypeCanvasSync {
+		t.Errorf("Expected canvas_sync, got %s", canvas1.Type)
+	}
+	if len(canvas1.Messages) != 0 {
+		t.Errorf("Expected empty canvas, got %d messages", len(canvas1.Messages))
+	}
+
 	// User1 also receives user_joined for themselves (presence events sent to all)
 	msg1b := readMessage(t, ws1, 2*time.Second)
 	if msg1b.Type != domain.MessageTypeUserJoined {
 		t.Errorf("Expected user_joined, got %s", msg1b.Type)
 	}
-	if msg1b.UserID != "user1" {
+	if msg1b.UserID != "guest:user1" {
 		t.Errorf("Expected user1 joined, got %s", msg1b.UserID)
 	}
 
 	// Connect second user
 	username2 := "Bob"
 	color2 := "#10b981"
-	ws2URL := fmt.Sprintf("%s/ws?uid=user2&username=%s&color=%s",
+	ws2URL := fmt.Sprintf("%s/ws?uid=user2&guest_token=%s&username=%s&color=%s",
 		wsURL,
+		issueGuestToken(t, guestTokens, "user2"),
 		url.QueryEscape(username2),
 		url.QueryEscape(color2),
 	)
@@ -138,12 +156,17 @@ func TestUserSync_TwoUsers(t *testing.T) {
 		t.Errorf("Expected 2 users in sync, got %d", len(msg2.Users))
 	}
 
+	canvas2 := readMessage(t, ws2, 2*time.Second)
+	if canvas2.Type != domain.MessageTypeCanvasSync {
+		t.Errorf("Expected canvas_sync, got %s", canvas2.Type)
+	}
+
 	// User1 should receive user_joined for user2
 	msg3 := readMessage(t, ws1, 2*time.Second)
 	if msg3.Type != domain.MessageTypeUserJoined {
 		t.Errorf("Expected user_joined, got %s", msg3.Type)
 	}
-	if msg3.UserID != "user2" {
+	if msg3.UserID != "guest:user2" {
 		t.Errorf("Expected user2 joined, got %s", msg3.UserID)
 	}
 	assertStringPtr(t, msg3.Username, "Bob", "username in join")
@@ -154,7 +177,7 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	if msg3b.Type != domain.MessageTypeUserJoined {
 		t.Errorf("Expected user_joined for user2, got %s", msg3b.Type)
 	}
-	if msg3b.UserID != "user2" {
+	if msg3b.UserID != "guest:user2" {
 		t.Errorf("Expected user2 in join, got %s", msg3b.UserID)
 	}
 
@@ -163,7 +186,7 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	usernameChangeMsg := &domain.Message{
 		Type:      domain.MessageTypeUsernameChanged,
 		ChannelID: channelID,
-		UserID:    "user2",
+		UserID:    "guest:user2",
 		Username:  &newUsername,
 		Timestamp: time.Now().UnixMilli(),
 	}
@@ -176,16 +199,16 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	if msg4.Type != domain.MessageTypeUsernameChanged {
 		t.Errorf("Expected username_changed, got %s", msg4.Type)
 	}
-	if msg4.UserID != "user2" {
+	if msg4.UserID != "guest:user2" {
 		t.Errorf("Expected user2 username change, got %s", msg4.UserID)
 	}
 	assertStringPtr(t, msg4.Username, "Bob Smith", "new username")
 
-	msg5 := readMessage(t, ws2, 2*time.Second)
+	msg5 := readEvent(t, ws2, 2*time.Second)
 	if msg5.Type != domain.MessageTypeUsernameChanged {
 		t.Errorf("Expected username_changed, got %s", msg5.Type)
 	}
-	if msg5.UserID != "user2" {
+	if msg5.UserID != "guest:user2" {
 		t.Errorf("Expected user2 username change, got %s", msg5.UserID)
 	}
 
@@ -194,7 +217,7 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	colorChangeMsg := &domain.Message{
 		Type:      domain.MessageTypeColorChanged,
 		ChannelID: channelID,
-		UserID:    "user1",
+		UserID:    "guest:user1",
 		Color:     &newColor,
 		Timestamp: time.Now().UnixMilli(),
 	}
@@ -203,20 +226,20 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	}
 
 	// Both users should receive color_changed
-	msg6 := readMessage(t, ws1, 2*time.Second)
+	msg6 := readEvent(t, ws1, 2*time.Second)
 	if msg6.Type != domain.MessageTypeColorChanged {
 		t.Errorf("Expected color_changed, got %s", msg6.Type)
 	}
-	if msg6.UserID != "user1" {
+	if msg6.UserID != "guest:user1" {
 		t.Errorf("Expected user1 color change, got %s", msg6.UserID)
 	}
 	assertStringPtr(t, msg6.Color, "#8b5cf6", "new color")
 
-	msg7 := readMessage(t, ws2, 2*time.Second)
+	msg7 := readEvent(t, ws2, 2*time.Second)
 	if msg7.Type != domain.MessageTypeColorChanged {
 		t.Errorf("Expected color_changed, got %s", msg7.Type)
 	}
-	if msg7.UserID != "user1" {
+	if msg7.UserID != "guest:user1" {
 		t.Errorf("Expected user1 color change, got %s", msg7.UserID)
 	}
 
@@ -224,27 +247,50 @@ func TestUserSync_TwoUsers(t *testing.T) {
 	ws2.Close()
 
 	// User1 should receive user_left
-	msg8 := readMessage(t, ws1, 2*time.Second)
+	msg8 := readEvent(t, ws1, 2*time.Second)
 	if msg8.Type != domain.MessageTypeUserLeft {
 		t.Errorf("Expected user_left, got %s", msg8.Type)
 	}
-	if msg8.UserID != "user2" {
+	if msg8.UserID != "guest:user2" {
 		t.Errorf("Expected user2 left, got %s", msg8.UserID)
 	}
 
-	// Verify only user1 remains in Redis
-	users, err := redisPubSub.GetChannelUsers(ctx, channelID)
+	// Verify only user1 remains in presence
+	users, err := presenceStore.ListUsers(ctx, channelID)
 	if err != nil {
 		t.Fatalf("Failed to get channel users: %v", err)
 	}
 	if len(users) != 1 {
 		t.Errorf("Expected 1 user remaining, got %d", len(users))
 	}
-	if users[0].UserID != "user1" {
+	if users[0].UserID != "guest:user1" {
 		t.Errorf("Expected user1 to remain, got %s", users[0].UserID)
 	}
 }
 
+// staticRooms is a RoomLookup backed by a fixed set of rooms
+type staticRooms []*domain.Room
+
+func (r staticRooms) GetBySlug(ctx context.Context, slug string) (*domain.Room, error) {
+	for _, room := range r {
+		if room.Slug == slug {
+			return room, nil
+		}
+	}
+	return nil, nil
+}
+
+// issueGuestToken signs a guest token for the given guest ID
+func issueGuestToken(t *testing.T, guestTokens *auth.GuestTokenService, guestID string) string {
+	t.Helper()
+
+	token, _, err := guestTokens.Issue(guestID)
+	if err != nil {
+		t.Fatalf("Failed to issue guest token: %v", err)
+	}
+	return token
+}
+
 // readMessage reads and decodes a message from WebSocket with timeout
 func readMessage(t *testing.T, ws *websocket.Conn, timeout time.Duration) *domain.Message {
 	t.Helper()
@@ -263,6 +309,19 @@ func readMessage(t *testing.T, ws *websocket.Conn, timeout time.Duration) *domai
 	return &msg
 }
 
+// readEvent reads the next message that isn't an ack
+// A sender's ack and the broadcast of its own message may arrive in either order.
+func readEvent(t *testing.T, ws *websocket.Conn, timeout time.Duration) *domain.Message {
+	t.Helper()
+
+	for {
+		msg := readMessage(t, ws, timeout)
+		if msg.Type != domain.MessageTypeAck {
+			return msg
+		}
+	}
+}
+
 // assertStringPtr asserts that a string pointer has the expected value
 func assertStringPtr(t *testing.T, ptr *string, expected string, fieldName string) {
 	t.Helper()